@@ -0,0 +1,119 @@
+// Package anilist is a client of the GraphQL API of AniList.co. It reads the
+// anime lists of users as anisync.Anime, matched to MyAnimeList.net by the
+// MyAnimeList.net IDs that AniList keeps for its anime, and saves list entries
+// for the user of an access token.
+//
+// AniList scores are in the score format that each user chooses, from 3
+// smileys to 100 points. They are converted from and to the 0 to 5 ratings
+// of anisync.Anime in steps of 0.5, like the ratings of Kitsu.io.
+package anilist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultBaseURL = "https://graphql.anilist.co/"
+
+// Client sends queries and mutations to the AniList GraphQL API.
+type Client struct {
+	// BaseURL is the URL of the GraphQL endpoint. It can be changed to the
+	// one of a fake server for testing.
+	BaseURL *url.URL
+
+	client *http.Client
+	token  string
+}
+
+// NewClient returns a client that uses httpClient, or http.DefaultClient if it
+// is nil. The access token is only needed to save entries and can be empty to
+// only read lists.
+func NewClient(httpClient *http.Client, token string) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	baseURL, _ := url.Parse(defaultBaseURL)
+	return &Client{BaseURL: baseURL, client: httpClient, token: token}
+}
+
+// Error is an error returned by the API.
+type Error struct {
+	StatusCode int // The HTTP status of the response.
+	Messages   []string
+}
+
+func (e *Error) Error() string {
+	msg := strings.Join(e.Messages, "; ")
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("anilist: %d: %s", e.StatusCode, msg)
+}
+
+// NotFound reports whether the error is about something that does not exist,
+// such as a user or an anime.
+func (e *Error) NotFound() bool { return e.StatusCode == http.StatusNotFound }
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+		Status  int    `json:"status"`
+	} `json:"errors"`
+}
+
+// do sends the named operation of query with the variables and decodes the
+// data of the response into v.
+func (c *Client) do(query, operation string, variables map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(request{Query: query, OperationName: operation, Variables: variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &Error{StatusCode: resp.StatusCode}
+		}
+		return fmt.Errorf("anilist: decoding %s response: %v", operation, err)
+	}
+	if len(r.Errors) != 0 || resp.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: resp.StatusCode}
+		for _, re := range r.Errors {
+			e.Messages = append(e.Messages, re.Message)
+			if e.StatusCode == http.StatusOK && re.Status != 0 {
+				// Errors of GraphQL may come with a 200 OK.
+				e.StatusCode = re.Status
+			}
+		}
+		return e
+	}
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		return fmt.Errorf("anilist: decoding %s data: %v", operation, err)
+	}
+	return nil
+}
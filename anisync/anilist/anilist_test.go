@@ -0,0 +1,152 @@
+package anilist_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/anilist"
+	"github.com/nstratos/anisync/anisync/anisynctest"
+)
+
+func TestAnimeList(t *testing.T) {
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	srv := anisynctest.NewAniListServer()
+	defer srv.Close()
+	// A small chunk makes the list span two chunks.
+	srv.MaxPerChunk = 2
+	srv.AddUser("Fan", "", anilist.Point100,
+		anisynctest.AniListEntry{MALID: 1, Title: "Cowboy Bebop", Episodes: 26, Status: anilist.StatusCompleted, Score: 85, Progress: 26, Repeat: 1, Notes: "Bang", UpdatedAt: updated},
+		anisynctest.AniListEntry{MALID: 6, Title: "Trigun", Episodes: 26, Status: anilist.StatusRepeating, Progress: 3, UpdatedAt: updated},
+		anisynctest.AniListEntry{MALID: 30, Title: "Neon Genesis Evangelion", Status: anilist.StatusPaused, Score: 2, UpdatedAt: updated},
+		anisynctest.AniListEntry{Title: "Only on AniList", Status: anilist.StatusPlanning, UpdatedAt: updated},
+	)
+
+	l, err := srv.Client("").AnimeList("fan")
+	if err != nil {
+		t.Fatalf("AnimeList returned err: %v", err)
+	}
+	if l.User != "Fan" || l.ScoreFormat != anilist.Point100 {
+		t.Errorf("AnimeList user, format = %q, %q, want %q, %q", l.User, l.ScoreFormat, "Fan", anilist.Point100)
+	}
+	want := []anisync.Anime{
+		{ID: 1, Title: "Cowboy Bebop", Episodes: 26, Status: anisync.Completed, Rating: "4.5", EpisodesWatched: 26, TimesRewatched: 1, Notes: "Bang", LastUpdated: &updated},
+		{ID: 6, Title: "Trigun", Episodes: 26, Status: anisync.Current, Rewatching: true, EpisodesWatched: 3, LastUpdated: &updated},
+		{ID: 30, Title: "Neon Genesis Evangelion", Status: anisync.OnHold, Rating: "0.5", LastUpdated: &updated},
+	}
+	if !reflect.DeepEqual(l.Anime, want) {
+		t.Errorf("AnimeList anime = \n%+v, want \n%+v", l.Anime, want)
+	}
+	if len(l.Unmapped) != 1 || l.Unmapped[0].Title != "Only on AniList" || l.Unmapped[0].Status != anisync.Planned {
+		t.Errorf("AnimeList unmapped = %+v, want the anime that is only on AniList", l.Unmapped)
+	}
+}
+
+func TestAnimeListNotFound(t *testing.T) {
+	srv := anisynctest.NewAniListServer()
+	defer srv.Close()
+
+	_, err := srv.Client("").AnimeList("nobody")
+	var e *anilist.Error
+	if !errors.As(err, &e) || !e.NotFound() {
+		t.Fatalf("AnimeList of unknown user returned err %v, want a not found *anilist.Error", err)
+	}
+}
+
+func TestSaveEntry(t *testing.T) {
+	srv := anisynctest.NewAniListServer()
+	defer srv.Close()
+	srv.AddUser("Fan", "secret", anilist.Point10Decimal,
+		anisynctest.AniListEntry{MALID: 1, Title: "Cowboy Bebop", Status: anilist.StatusCurrent, Progress: 3},
+	)
+	srv.AddUser("Other", "", anilist.Point3,
+		anisynctest.AniListEntry{MALID: 6, Title: "Trigun", Status: anilist.StatusPlanning},
+	)
+	c := srv.Client("secret")
+
+	v, err := c.Viewer()
+	if err != nil {
+		t.Fatalf("Viewer returned err: %v", err)
+	}
+	if v.Name != "Fan" || v.ScoreFormat != anilist.Point10Decimal {
+		t.Errorf("Viewer = %+v, want Fan with %s", v, anilist.Point10Decimal)
+	}
+
+	// An update of an anime of the list and an add of one that is not.
+	if _, err := c.SaveEntry(anisync.Anime{ID: 1, Status: anisync.Completed, EpisodesWatched: 26, Rating: "4.5", Notes: "Bang"}, v.ScoreFormat); err != nil {
+		t.Fatalf("SaveEntry update returned err: %v", err)
+	}
+	if _, err := c.SaveEntry(anisync.Anime{ID: 6, Status: anisync.Completed, Rewatching: true, TimesRewatched: 2}, v.ScoreFormat); err != nil {
+		t.Fatalf("SaveEntry add returned err: %v", err)
+	}
+	got := srv.Entries("Fan")
+	if len(got) != 2 {
+		t.Fatalf("list has %d entries after saving, want 2: %+v", len(got), got)
+	}
+	if e := got[0]; e.Status != anilist.StatusCompleted || e.Score != 9 || e.Progress != 26 || e.Notes != "Bang" {
+		t.Errorf("updated entry = %+v, want completed with score 9, progress 26 and the notes", e)
+	}
+	if e := got[1]; e.Status != anilist.StatusRepeating || e.Score != 0 || e.Repeat != 2 {
+		t.Errorf("added entry = %+v, want repeating, not scored and repeated twice", e)
+	}
+
+	if _, err := c.SaveEntry(anisync.Anime{ID: 999, Status: anisync.Current}, v.ScoreFormat); err == nil || !strings.Contains(err.Error(), "no anime with MyAnimeList.net ID 999") {
+		t.Errorf("SaveEntry of unknown anime returned err %v, want no anime", err)
+	}
+	var e *anilist.Error
+	if _, err := srv.Client("wrong").SaveEntry(anisync.Anime{ID: 1, Status: anisync.Current}, v.ScoreFormat); !errors.As(err, &e) || e.StatusCode != 401 {
+		t.Errorf("SaveEntry with wrong token returned err %v, want a 401 *anilist.Error", err)
+	}
+}
+
+func TestScoreFormat(t *testing.T) {
+	tests := []struct {
+		format anilist.ScoreFormat
+		score  float64
+		rating string
+	}{
+		{anilist.Point100, 0, ""},
+		{anilist.Point100, 85, "4.5"},
+		{anilist.Point100, 70, "3.5"},
+		{anilist.Point100, 100, "5.0"},
+		{anilist.Point10Decimal, 7.5, "4.0"},
+		{anilist.Point10Decimal, 9, "4.5"},
+		{anilist.Point10, 7, "3.5"},
+		{anilist.Point5, 4, "4.0"},
+		{anilist.Point3, 1, "2.0"},
+		{anilist.Point3, 2, "3.0"},
+		{anilist.Point3, 3, "4.5"},
+	}
+	for _, tt := range tests {
+		rating, err := tt.format.Rating(tt.score)
+		if err != nil || rating != tt.rating {
+			t.Errorf("%s.Rating(%v) = %q, %v, want %q", tt.format, tt.score, rating, err, tt.rating)
+		}
+	}
+
+	// The scores round trip through ratings, except for Point10Decimal
+	// scores that are not multiples of 0.5.
+	for _, tt := range tests {
+		if tt.format == anilist.Point10Decimal && tt.score == 7.5 {
+			continue
+		}
+		score, err := tt.format.Score(tt.rating)
+		want := tt.score
+		if tt.format == anilist.Point100 && tt.score == 85 {
+			want = 90
+		}
+		if err != nil || score != want {
+			t.Errorf("%s.Score(%q) = %v, %v, want %v", tt.format, tt.rating, score, err, want)
+		}
+	}
+
+	if _, err := anilist.ScoreFormat("POINT_7").Rating(3); err == nil {
+		t.Error("Rating of unknown format returned no error")
+	}
+	if _, err := anilist.Point10.Score("11"); err == nil {
+		t.Error("Score of rating above 5 returned no error")
+	}
+}
@@ -0,0 +1,185 @@
+package anilist
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// The statuses of list entries.
+const (
+	StatusCurrent   = "CURRENT"
+	StatusPlanning  = "PLANNING"
+	StatusCompleted = "COMPLETED"
+	StatusDropped   = "DROPPED"
+	StatusPaused    = "PAUSED"
+	StatusRepeating = "REPEATING"
+)
+
+// perChunk is the number of list entries requested per chunk, the most that
+// AniList allows.
+const perChunk = 500
+
+const listQuery = `query MediaListCollection($userName: String, $chunk: Int, $perChunk: Int) {
+  MediaListCollection(userName: $userName, type: ANIME, chunk: $chunk, perChunk: $perChunk) {
+    user { name mediaListOptions { scoreFormat } }
+    hasNextChunk
+    lists {
+      entries {
+        mediaId status score progress repeat notes updatedAt
+        media { idMal episodes title { romaji } coverImage { medium } }
+      }
+    }
+  }
+}`
+
+type listEntry struct {
+	MediaID   int     `json:"mediaId"`
+	Status    string  `json:"status"`
+	Score     float64 `json:"score"`
+	Progress  int     `json:"progress"`
+	Repeat    int     `json:"repeat"`
+	Notes     string  `json:"notes"`
+	UpdatedAt int64   `json:"updatedAt"`
+	Media     struct {
+		IDMal    int `json:"idMal"`
+		Episodes int `json:"episodes"`
+		Title    struct {
+			Romaji string `json:"romaji"`
+		} `json:"title"`
+		CoverImage struct {
+			Medium string `json:"medium"`
+		} `json:"coverImage"`
+	} `json:"media"`
+}
+
+type listData struct {
+	MediaListCollection struct {
+		User struct {
+			Name             string `json:"name"`
+			MediaListOptions struct {
+				ScoreFormat ScoreFormat `json:"scoreFormat"`
+			} `json:"mediaListOptions"`
+		} `json:"user"`
+		HasNextChunk bool `json:"hasNextChunk"`
+		Lists        []struct {
+			Entries []listEntry `json:"entries"`
+		} `json:"lists"`
+	} `json:"MediaListCollection"`
+}
+
+// List is the anime list of a user.
+type List struct {
+	User        string
+	ScoreFormat ScoreFormat
+	// Anime are the anime of the list with their MyAnimeList.net IDs.
+	Anime []anisync.Anime
+	// Unmapped are the anime that have no MyAnimeList.net ID and cannot be
+	// synced. Their ID is 0.
+	Unmapped []anisync.Anime
+}
+
+// AnimeList returns the anime list of a user, following the chunks until the
+// last one. An anime that is in more than one list of the user, such as in a
+// custom list, is returned once.
+func (c *Client) AnimeList(userName string) (*List, error) {
+	l := &List{}
+	seen := make(map[int]bool)
+	for chunk := 1; ; chunk++ {
+		var data listData
+		vars := map[string]interface{}{"userName": userName, "chunk": chunk, "perChunk": perChunk}
+		if err := c.do(listQuery, "MediaListCollection", vars, &data); err != nil {
+			return nil, err
+		}
+		coll := data.MediaListCollection
+		l.User, l.ScoreFormat = coll.User.Name, coll.User.MediaListOptions.ScoreFormat
+		for _, list := range coll.Lists {
+			for _, e := range list.Entries {
+				if seen[e.MediaID] {
+					continue
+				}
+				seen[e.MediaID] = true
+				a, err := fromEntry(e, l.ScoreFormat)
+				if err != nil {
+					return nil, fmt.Errorf("anilist: anime %d (%s): %v", e.MediaID, e.Media.Title.Romaji, err)
+				}
+				if a.ID == 0 {
+					l.Unmapped = append(l.Unmapped, a)
+				} else {
+					l.Anime = append(l.Anime, a)
+				}
+			}
+		}
+		if !coll.HasNextChunk {
+			return l, nil
+		}
+	}
+}
+
+func fromEntry(e listEntry, format ScoreFormat) (anisync.Anime, error) {
+	a := anisync.Anime{
+		ID:              e.Media.IDMal,
+		Title:           e.Media.Title.Romaji,
+		Episodes:        e.Media.Episodes,
+		Image:           e.Media.CoverImage.Medium,
+		EpisodesWatched: e.Progress,
+		TimesRewatched:  e.Repeat,
+		Notes:           e.Notes,
+	}
+	var err error
+	if a.Status, a.Rewatching, err = fromStatus(e.Status); err != nil {
+		return a, err
+	}
+	if a.Rating, err = format.Rating(e.Score); err != nil {
+		return a, err
+	}
+	if e.UpdatedAt != 0 {
+		t := time.Unix(e.UpdatedAt, 0).UTC()
+		a.LastUpdated = &t
+	}
+	return a, nil
+}
+
+// fromStatus returns the status of an anime of a list entry status and
+// whether it is being rewatched. Anime that are being rewatched are current
+// and rewatching, as on Kitsu.io.
+func fromStatus(status string) (anisync.Status, bool, error) {
+	switch status {
+	case StatusCurrent:
+		return anisync.Current, false, nil
+	case StatusPlanning:
+		return anisync.Planned, false, nil
+	case StatusCompleted:
+		return anisync.Completed, false, nil
+	case StatusPaused:
+		return anisync.OnHold, false, nil
+	case StatusDropped:
+		return anisync.Dropped, false, nil
+	case StatusRepeating:
+		return anisync.Current, true, nil
+	}
+	return anisync.Unknown, false, fmt.Errorf("unknown status %q", status)
+}
+
+// toStatus returns the list entry status of an anime. Current and completed
+// anime that are being rewatched are repeating.
+func toStatus(a anisync.Anime) (string, error) {
+	switch a.Status {
+	case anisync.Current, anisync.Completed:
+		if a.Rewatching {
+			return StatusRepeating, nil
+		}
+		if a.Status == anisync.Current {
+			return StatusCurrent, nil
+		}
+		return StatusCompleted, nil
+	case anisync.Planned:
+		return StatusPlanning, nil
+	case anisync.OnHold:
+		return StatusPaused, nil
+	case anisync.Dropped:
+		return StatusDropped, nil
+	}
+	return "", fmt.Errorf("anilist: no status for %v", a.Status)
+}
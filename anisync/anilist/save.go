@@ -0,0 +1,96 @@
+package anilist
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+const viewerQuery = `query Viewer {
+  Viewer { name mediaListOptions { scoreFormat } }
+}`
+
+const mediaQuery = `query Media($idMal: Int) {
+  Media(idMal: $idMal, type: ANIME) { id }
+}`
+
+const saveMutation = `mutation SaveMediaListEntry($mediaId: Int, $status: MediaListStatus, $score: Float, $progress: Int, $repeat: Int, $notes: String) {
+  SaveMediaListEntry(mediaId: $mediaId, status: $status, score: $score, progress: $progress, repeat: $repeat, notes: $notes) { id }
+}`
+
+// Viewer is the user of the access token.
+type Viewer struct {
+	Name        string
+	ScoreFormat ScoreFormat
+}
+
+// Viewer returns the user of the access token of the client, whose list
+// SaveEntry writes to.
+func (c *Client) Viewer() (*Viewer, error) {
+	var data struct {
+		Viewer struct {
+			Name             string `json:"name"`
+			MediaListOptions struct {
+				ScoreFormat ScoreFormat `json:"scoreFormat"`
+			} `json:"mediaListOptions"`
+		} `json:"Viewer"`
+	}
+	if err := c.do(viewerQuery, "Viewer", nil, &data); err != nil {
+		return nil, err
+	}
+	return &Viewer{Name: data.Viewer.Name, ScoreFormat: data.Viewer.MediaListOptions.ScoreFormat}, nil
+}
+
+// MediaID returns the AniList ID of the anime with a MyAnimeList.net ID.
+func (c *Client) MediaID(malID int) (int, error) {
+	var data struct {
+		Media *struct {
+			ID int `json:"id"`
+		} `json:"Media"`
+	}
+	err := c.do(mediaQuery, "Media", map[string]interface{}{"idMal": malID}, &data)
+	var e *Error
+	if errors.As(err, &e) && e.NotFound() || err == nil && data.Media == nil {
+		return 0, fmt.Errorf("anilist: no anime with MyAnimeList.net ID %d", malID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return data.Media.ID, nil
+}
+
+// SaveEntry adds or updates the anime, whose ID is a MyAnimeList.net ID, in
+// the list of the user of the access token, with its rating converted to the
+// score format of the user. It returns the AniList ID of the anime.
+func (c *Client) SaveEntry(a anisync.Anime, format ScoreFormat) (int, error) {
+	status, err := toStatus(a)
+	if err != nil {
+		return 0, err
+	}
+	score, err := format.Score(a.Rating)
+	if err != nil {
+		return 0, err
+	}
+	mediaID, err := c.MediaID(a.ID)
+	if err != nil {
+		return 0, err
+	}
+	vars := map[string]interface{}{
+		"mediaId":  mediaID,
+		"status":   status,
+		"score":    score,
+		"progress": a.EpisodesWatched,
+		"repeat":   a.TimesRewatched,
+		"notes":    a.Notes,
+	}
+	var data struct {
+		SaveMediaListEntry struct {
+			ID int `json:"id"`
+		} `json:"SaveMediaListEntry"`
+	}
+	if err := c.do(saveMutation, "SaveMediaListEntry", vars, &data); err != nil {
+		return 0, err
+	}
+	return mediaID, nil
+}
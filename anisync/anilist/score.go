@@ -0,0 +1,88 @@
+package anilist
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ScoreFormat is the format of the scores of a user.
+type ScoreFormat string
+
+// The score formats.
+const (
+	Point100       ScoreFormat = "POINT_100"        // 0 to 100.
+	Point10Decimal ScoreFormat = "POINT_10_DECIMAL" // 0.0 to 10.0.
+	Point10        ScoreFormat = "POINT_10"         // 0 to 10.
+	Point5         ScoreFormat = "POINT_5"          // 0 to 5 stars.
+	Point3         ScoreFormat = "POINT_3"          // 0 to 3 smileys.
+)
+
+// point3Scores are the scores out of 100 of the smileys of Point3, as AniList
+// converts them.
+var point3Scores = [...]float64{0, 35, 60, 85}
+
+// hundred returns a score of the format out of 100.
+func (f ScoreFormat) hundred(score float64) (float64, error) {
+	switch f {
+	case Point100:
+		return score, nil
+	case Point10Decimal, Point10:
+		return score * 10, nil
+	case Point5:
+		return score * 20, nil
+	case Point3:
+		i := int(score)
+		if i < 0 || i >= len(point3Scores) {
+			return 0, fmt.Errorf("anilist: invalid %s score %v", f, score)
+		}
+		return point3Scores[i], nil
+	}
+	return 0, fmt.Errorf("anilist: unknown score format %q", f)
+}
+
+// Rating converts a score of the format to a rating of anisync.Anime, from
+// 0.5 to 5.0 in steps of 0.5. A score of 0 means the anime is not scored and
+// converts to an empty rating.
+func (f ScoreFormat) Rating(score float64) (string, error) {
+	h, err := f.hundred(score)
+	if err != nil || h <= 0 {
+		return "", err
+	}
+	return strconv.FormatFloat(max(math.Round(h/10)/2, 0.5), 'f', 1, 64), nil
+}
+
+// Score converts a rating of anisync.Anime to a score of the format. An
+// empty rating converts to 0, which AniList takes as not scored.
+func (f ScoreFormat) Score(rating string) (float64, error) {
+	if rating == "" {
+		return 0, nil
+	}
+	r, err := strconv.ParseFloat(rating, 64)
+	if err != nil || r < 0 || r > 5 {
+		return 0, fmt.Errorf("anilist: invalid rating %q", rating)
+	}
+	h := r * 20
+	switch f {
+	case Point100:
+		return math.Round(h), nil
+	case Point10Decimal:
+		return math.Round(h) / 10, nil
+	case Point10:
+		return math.Round(h / 10), nil
+	case Point5:
+		return math.Round(h / 20), nil
+	case Point3:
+		switch {
+		case h == 0:
+			return 0, nil
+		case h < 50:
+			return 1, nil
+		case h < 75:
+			return 2, nil
+		default:
+			return 3, nil
+		}
+	}
+	return 0, fmt.Errorf("anilist: unknown score format %q", f)
+}
@@ -31,6 +31,7 @@ type Anime struct {
 	Status          Status
 	Title           string
 	EpisodesWatched int
+	Episodes        int // Total number of episodes, 0 if unknown.
 	LastUpdated     *time.Time
 	Rating          string
 	Notes           string
@@ -0,0 +1,339 @@
+package anisynctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/anilist"
+)
+
+// AniListServer is a fake of the GraphQL API of AniList.co. It does not parse
+// GraphQL: it answers the operations of anilist.Client by their operation
+// name and variables, which are the MediaListCollection, Viewer and Media
+// queries and the SaveMediaListEntry mutation. Lists can be read by anyone;
+// the Viewer and the mutation need the access token of a user.
+type AniListServer struct {
+	// URL is the URL of the GraphQL endpoint, to be used as the BaseURL of an
+	// anilist.Client.
+	URL string
+
+	// MaxPerChunk is the largest chunk of list entries that is served. It is
+	// 500 like on AniList.co and can be lowered to test chunking with a few
+	// entries.
+	MaxPerChunk int
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	users    map[string]*aniListUser // By lowercase name.
+	media    map[int]*aniListMedia   // By AniList ID.
+	byMALID  map[int]*aniListMedia
+	nextID   int // The last AniList ID of an anime.
+	entryIDs int // The last ID of a list entry.
+}
+
+// AniListEntry is an entry of a list of the AniListServer.
+type AniListEntry struct {
+	MALID     int // 0 for anime that are not on MyAnimeList.net.
+	Title     string
+	Episodes  int
+	Status    string  // Such as anilist.StatusCurrent.
+	Score     float64 // In the score format of the user.
+	Progress  int
+	Repeat    int
+	Notes     string
+	UpdatedAt time.Time
+}
+
+type aniListUser struct {
+	name    string
+	token   string
+	format  anilist.ScoreFormat
+	entries map[int]*aniListEntry // By AniList ID of the anime.
+}
+
+type aniListEntry struct {
+	id      int
+	mediaID int
+	AniListEntry
+}
+
+// aniListMedia is an anime of AniList. Its AniList ID is different from its
+// MyAnimeList.net ID.
+type aniListMedia struct {
+	id       int
+	malID    int
+	title    string
+	episodes int
+}
+
+// NewAniListServer starts an AniListServer without any users. It should be
+// closed when done.
+func NewAniListServer() *AniListServer {
+	s := &AniListServer{
+		MaxPerChunk: 500,
+		users:       make(map[string]*aniListUser),
+		media:       make(map[int]*aniListMedia),
+		byMALID:     make(map[int]*aniListMedia),
+		nextID:      100000,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /", s.handle)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL + "/"
+	return s
+}
+
+// Close shuts the server down.
+func (s *AniListServer) Close() { s.srv.Close() }
+
+// Client returns an anilist.Client that uses the server with an access token.
+func (s *AniListServer) Client(token string) *anilist.Client {
+	c := anilist.NewClient(s.srv.Client(), token)
+	c.BaseURL, _ = url.Parse(s.URL)
+	return c
+}
+
+// AddUser adds a user with an access token, a score format and a list.
+func (s *AniListServer) AddUser(name, token string, format anilist.ScoreFormat, entries ...AniListEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &aniListUser{name: name, token: token, format: format, entries: make(map[int]*aniListEntry)}
+	s.users[strings.ToLower(name)] = u
+	for _, e := range entries {
+		m := s.mediaByMALID(e.MALID)
+		m.title, m.episodes = e.Title, e.Episodes
+		if e.UpdatedAt.IsZero() {
+			e.UpdatedAt = time.Now()
+		}
+		s.entryIDs++
+		u.entries[m.id] = &aniListEntry{id: s.entryIDs, mediaID: m.id, AniListEntry: e}
+	}
+}
+
+// Entries returns the list of a user, ordered by MyAnimeList.net ID.
+func (s *AniListServer) Entries(name string) []AniListEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	var entries []AniListEntry
+	for _, e := range u.sorted() {
+		entries = append(entries, e.AniListEntry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].MALID < entries[j].MALID })
+	return entries
+}
+
+// mediaByMALID returns the anime of a MyAnimeList.net ID, creating it if
+// needed. An ID of 0 always creates a new anime.
+func (s *AniListServer) mediaByMALID(malID int) *aniListMedia {
+	if m, ok := s.byMALID[malID]; ok && malID != 0 {
+		return m
+	}
+	s.nextID++
+	m := &aniListMedia{id: s.nextID, malID: malID}
+	s.media[m.id] = m
+	if malID != 0 {
+		s.byMALID[malID] = m
+	}
+	return m
+}
+
+func (u *aniListUser) sorted() []*aniListEntry {
+	var entries []*aniListEntry
+	for _, e := range u.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].mediaID < entries[j].mediaID })
+	return entries
+}
+
+type aniListRequest struct {
+	OperationName string `json:"operationName"`
+	Variables     struct {
+		UserName string   `json:"userName"`
+		Chunk    int      `json:"chunk"`
+		PerChunk int      `json:"perChunk"`
+		IDMal    int      `json:"idMal"`
+		MediaID  int      `json:"mediaId"`
+		Status   *string  `json:"status"`
+		Score    *float64 `json:"score"`
+		Progress *int     `json:"progress"`
+		Repeat   *int     `json:"repeat"`
+		Notes    *string  `json:"notes"`
+	} `json:"variables"`
+}
+
+func (s *AniListServer) handle(w http.ResponseWriter, r *http.Request) {
+	var req aniListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAniListError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req.OperationName {
+	case "MediaListCollection":
+		s.handleList(w, req)
+	case "Media":
+		m, ok := s.byMALID[req.Variables.IDMal]
+		if !ok {
+			writeAniListError(w, http.StatusNotFound, "Not Found.")
+			return
+		}
+		writeAniList(w, map[string]interface{}{"Media": map[string]interface{}{"id": m.id}})
+	case "Viewer":
+		u, ok := s.viewer(w, r)
+		if !ok {
+			return
+		}
+		writeAniList(w, map[string]interface{}{"Viewer": map[string]interface{}{
+			"name":             u.name,
+			"mediaListOptions": map[string]interface{}{"scoreFormat": u.format},
+		}})
+	case "SaveMediaListEntry":
+		u, ok := s.viewer(w, r)
+		if !ok {
+			return
+		}
+		s.handleSave(w, u, req)
+	default:
+		writeAniListError(w, http.StatusBadRequest, "Unknown operation "+req.OperationName)
+	}
+}
+
+// viewer returns the user of the access token of the request. The server must
+// be locked.
+func (s *AniListServer) viewer(w http.ResponseWriter, r *http.Request) (*aniListUser, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, u := range s.users {
+		if ok && token != "" && u.token == token {
+			return u, true
+		}
+	}
+	writeAniListError(w, http.StatusUnauthorized, "Invalid token")
+	return nil, false
+}
+
+// handleList serves a chunk of the list of a user, with the chunks numbered
+// from 1.
+func (s *AniListServer) handleList(w http.ResponseWriter, req aniListRequest) {
+	u, ok := s.users[strings.ToLower(req.Variables.UserName)]
+	if !ok {
+		writeAniListError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	chunk, perChunk := max(req.Variables.Chunk, 1), req.Variables.PerChunk
+	if perChunk < 1 || perChunk > s.MaxPerChunk {
+		perChunk = s.MaxPerChunk
+	}
+	all := u.sorted()
+	start := min((chunk-1)*perChunk, len(all))
+	end := min(start+perChunk, len(all))
+
+	// As on AniList, the entries are grouped in a list per status.
+	lists := make(map[string][]interface{})
+	var statuses []string
+	for _, e := range all[start:end] {
+		if _, ok := lists[e.Status]; !ok {
+			statuses = append(statuses, e.Status)
+		}
+		lists[e.Status] = append(lists[e.Status], s.entryJSON(e))
+	}
+	var out []interface{}
+	for _, status := range statuses {
+		out = append(out, map[string]interface{}{"status": status, "entries": lists[status]})
+	}
+	writeAniList(w, map[string]interface{}{"MediaListCollection": map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":             u.name,
+			"mediaListOptions": map[string]interface{}{"scoreFormat": u.format},
+		},
+		"hasNextChunk": end < len(all),
+		"lists":        out,
+	}})
+}
+
+func (s *AniListServer) entryJSON(e *aniListEntry) map[string]interface{} {
+	m := s.media[e.mediaID]
+	var idMal interface{}
+	if m.malID != 0 {
+		idMal = m.malID
+	}
+	return map[string]interface{}{
+		"mediaId":   e.mediaID,
+		"status":    e.Status,
+		"score":     e.Score,
+		"progress":  e.Progress,
+		"repeat":    e.Repeat,
+		"notes":     e.Notes,
+		"updatedAt": e.UpdatedAt.Unix(),
+		"media": map[string]interface{}{
+			"idMal":      idMal,
+			"episodes":   m.episodes,
+			"title":      map[string]interface{}{"romaji": m.title},
+			"coverImage": map[string]interface{}{"medium": ""},
+		},
+	}
+}
+
+// handleSave creates or updates the entry of an anime in the list of u with
+// the variables that are present and touches it.
+func (s *AniListServer) handleSave(w http.ResponseWriter, u *aniListUser, req aniListRequest) {
+	v := req.Variables
+	m, ok := s.media[v.MediaID]
+	if !ok {
+		writeAniListError(w, http.StatusNotFound, "Not Found.")
+		return
+	}
+	e, ok := u.entries[m.id]
+	if !ok {
+		s.entryIDs++
+		e = &aniListEntry{id: s.entryIDs, mediaID: m.id, AniListEntry: AniListEntry{
+			MALID: m.malID, Title: m.title, Episodes: m.episodes, Status: anilist.StatusCurrent,
+		}}
+		u.entries[m.id] = e
+	}
+	if v.Status != nil {
+		e.Status = *v.Status
+	}
+	if v.Score != nil {
+		e.Score = *v.Score
+	}
+	if v.Progress != nil {
+		e.Progress = *v.Progress
+	}
+	if v.Repeat != nil {
+		e.Repeat = *v.Repeat
+	}
+	if v.Notes != nil {
+		e.Notes = *v.Notes
+	}
+	e.UpdatedAt = time.Now()
+	writeAniList(w, map[string]interface{}{"SaveMediaListEntry": map[string]interface{}{"id": e.id}})
+}
+
+func writeAniList(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// writeAniListError writes an error the way AniList does, with its status in
+// both the response and the error and null data.
+func writeAniListError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":   nil,
+		"errors": []map[string]interface{}{{"message": message, "status": status}},
+	})
+}
@@ -0,0 +1,97 @@
+package anisynctest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nstratos/go-myanimelist/mal"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/anisynctest"
+)
+
+func TestSyncEndToEnd(t *testing.T) {
+	before := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	now := time.Now().Truncate(time.Second)
+
+	malSrv := anisynctest.NewMALServer()
+	defer malSrv.Close()
+	malSrv.AddUser("TestUser", "TestPass",
+		anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Completed, EpisodesWatched: 12, Rating: "4.0", LastUpdated: &before},
+		anisync.Anime{ID: 2, Title: "Anime2", Status: anisync.Current, EpisodesWatched: 3, Rating: "3.5", LastUpdated: &before},
+	)
+	kitsuSrv := anisynctest.NewKitsuServer()
+	defer kitsuSrv.Close()
+	// A small page limit makes the library span three pages.
+	kitsuSrv.MaxPageLimit = 2
+	kitsuSrv.AddLibrary("42",
+		anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Completed, EpisodesWatched: 12, Rating: "4.0", LastUpdated: &before},
+		anisync.Anime{ID: 2, Title: "Anime2", Status: anisync.Completed, EpisodesWatched: 12, Rating: "4.5", LastUpdated: &now},
+		anisync.Anime{ID: 3, Title: "Anime3", Status: anisync.Planned, Rating: "3.0", LastUpdated: &now},
+		anisync.Anime{ID: 4, Title: "Anime4", Status: anisync.OnHold, EpisodesWatched: 5, Rating: "2.5", LastUpdated: &now},
+		anisync.Anime{ID: 5, Title: "Anime5", Status: anisync.Dropped, EpisodesWatched: 1, Rating: "1.0", LastUpdated: &now},
+	)
+	kitsuSrv.AddLibrary("43", anisync.Anime{ID: 6, Title: "Anime6", Status: anisync.Current, LastUpdated: &now})
+
+	c := anisync.NewClient(anisync.NewResources(malSrv.Client("TestUser", "TestPass"), kitsuSrv.Client()))
+	if _, _, err := c.VerifyMALCredentials("TestUser", "TestPass"); err != nil {
+		t.Fatal("VerifyMALCredentials returned err:", err)
+	}
+
+	diff := compare(t, c)
+	if got, want := len(diff.Right), 5; got != want {
+		t.Fatalf("Kitsu list has %d anime, want %d", got, want)
+	}
+	if len(diff.Missing) != 3 || len(diff.NeedUpdate) != 1 || len(diff.UpToDate) != 1 {
+		t.Fatalf("Compare got %d missing, %d need update, %d up to date, want 3, 1, 1",
+			len(diff.Missing), len(diff.NeedUpdate), len(diff.UpToDate))
+	}
+
+	res := c.SyncMALAnime(*diff)
+	if len(res.AddFails) != 0 || len(res.UpdateFails) != 0 {
+		t.Fatalf("SyncMALAnime failed: %+v %+v", res.AddFails, res.UpdateFails)
+	}
+
+	diff = compare(t, c)
+	if len(diff.Missing) != 0 || len(diff.NeedUpdate) != 0 {
+		t.Errorf("after sync, Compare got %d missing and %d need update, want none", len(diff.Missing), len(diff.NeedUpdate))
+	}
+	entries := malSrv.Entries("TestUser")
+	if got, want := len(entries), 5; got != want {
+		t.Fatalf("MAL list has %d entries after sync, want %d", got, want)
+	}
+	if a := entries[2]; a.MyStatus != mal.Planned || a.MyScore != 6 {
+		t.Errorf("added anime has status %d and score %d, want %d and 6", a.MyStatus, a.MyScore, mal.Planned)
+	}
+}
+
+func compare(t *testing.T, c *anisync.Client) *anisync.Diff {
+	malist, _, err := c.GetMyAnimeList("TestUser")
+	if err != nil {
+		t.Fatal("GetMyAnimeList returned err:", err)
+	}
+	kitsuList, _, err := c.GetKitsuAnimeList("42")
+	if err != nil {
+		t.Fatal("GetKitsuAnimeList returned err:", err)
+	}
+	return anisync.Compare(malist, kitsuList)
+}
+
+func TestMALServerErrors(t *testing.T) {
+	malSrv := anisynctest.NewMALServer()
+	defer malSrv.Close()
+	malSrv.AddUser("TestUser", "TestPass")
+
+	c := anisync.NewClient(anisync.NewResources(malSrv.Client("TestUser", "wrong"), nil))
+	if _, resp, err := c.VerifyMALCredentials("TestUser", "wrong"); err == nil {
+		t.Error("VerifyMALCredentials with wrong password expected to return err")
+	} else if resp == nil || resp.StatusCode != 401 {
+		t.Errorf("VerifyMALCredentials with wrong password responded %v, want 401", resp)
+	}
+	if err := c.AddMALAnime(anisync.Anime{ID: 1, Status: anisync.Current}); err == nil {
+		t.Error("AddMALAnime with wrong password expected to return err")
+	}
+	if _, _, err := c.GetMyAnimeList("NoSuchUser"); err == nil {
+		t.Error("GetMyAnimeList of unknown user expected to return err")
+	}
+}
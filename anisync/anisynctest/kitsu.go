@@ -0,0 +1,456 @@
+package anisynctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstratos/go-kitsu/kitsu"
+	"github.com/nstratos/jsonapi"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+const (
+	// kitsuMediaType is the media type of the JSON:API documents.
+	kitsuMediaType = "application/vnd.api+json"
+	// kitsuTimeLayout is the layout of the times of the Kitsu.io API.
+	kitsuTimeLayout = "2006-01-02T15:04:05.000Z"
+)
+
+// KitsuServer is a fake of the library entries endpoints of the Kitsu.io
+// JSON:API. Library entries can be listed, filtered by user, paginated and
+// have their anime and the anime mappings to MyAnimeList.net included. They
+// can also be created, updated and deleted, without authentication.
+type KitsuServer struct {
+	// URL is the base URL of the server, to be used as the BaseURL of a
+	// kitsu.Client.
+	URL string
+
+	// PageLimit is the size of the pages when the request does not set
+	// page[limit]. It is 10 like on Kitsu.io.
+	PageLimit int
+	// MaxPageLimit is the largest page that is served. Larger page[limit]
+	// values are lowered to it. It is 500 like on Kitsu.io and can be lowered
+	// to test pagination with a few entries.
+	MaxPageLimit int
+
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	entries map[int]*kitsuEntry
+	anime   map[string]*kitsuAnime // By Kitsu.io anime ID.
+	byMALID map[int]*kitsuAnime
+	nextID  int
+}
+
+type kitsuEntry struct {
+	id        int
+	userID    string
+	animeID   string
+	status    string
+	progress  int
+	rating    string
+	notes     string
+	rewatches int
+	rewatch   bool
+	updatedAt time.Time
+}
+
+// kitsuAnime is an anime of Kitsu.io. Its Kitsu.io ID is different from its
+// MyAnimeList.net ID, which is only known from its mapping.
+type kitsuAnime struct {
+	id       string
+	malID    int
+	title    string
+	episodes int
+	image    string
+}
+
+// NewKitsuServer starts a KitsuServer without any library entries. It should
+// be closed when done.
+func NewKitsuServer() *KitsuServer {
+	s := &KitsuServer{
+		PageLimit:    10,
+		MaxPageLimit: 500,
+		entries:      make(map[int]*kitsuEntry),
+		anime:        make(map[string]*kitsuAnime),
+		byMALID:      make(map[int]*kitsuAnime),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/edge/library-entries", s.handleList)
+	mux.HandleFunc("POST /api/edge/library-entries", s.handleCreate)
+	mux.HandleFunc("GET /api/edge/library-entries/{id}", s.handleShow)
+	mux.HandleFunc("PATCH /api/edge/library-entries/{id}", s.handleUpdate)
+	mux.HandleFunc("DELETE /api/edge/library-entries/{id}", s.handleDelete)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL + "/"
+	return s
+}
+
+// Close shuts the server down.
+func (s *KitsuServer) Close() { s.srv.Close() }
+
+// Client returns a kitsu.Client that uses the server.
+func (s *KitsuServer) Client() *kitsu.Client {
+	c := kitsu.NewClient(s.srv.Client())
+	c.BaseURL, _ = url.Parse(s.URL)
+	return c
+}
+
+// AddLibrary adds anime to the library of userID. The IDs of the anime are
+// their MyAnimeList.net IDs, which the server maps to Kitsu.io anime.
+func (s *KitsuServer) AddLibrary(userID string, anime ...anisync.Anime) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range anime {
+		ka := s.animeByMALID(a.ID)
+		ka.title, ka.episodes, ka.image = a.Title, a.Episodes, a.Image
+		s.nextID++
+		e := &kitsuEntry{
+			id:        s.nextID,
+			userID:    userID,
+			animeID:   ka.id,
+			status:    toKitsuStatus(a.Status),
+			progress:  a.EpisodesWatched,
+			rating:    a.Rating,
+			notes:     a.Notes,
+			rewatches: a.TimesRewatched,
+			rewatch:   a.Rewatching,
+			updatedAt: time.Now().UTC(),
+		}
+		if a.LastUpdated != nil {
+			e.updatedAt = a.LastUpdated.UTC()
+		}
+		s.entries[e.id] = e
+	}
+}
+
+// animeByMALID returns the Kitsu.io anime of a MyAnimeList.net ID, creating it
+// if needed.
+func (s *KitsuServer) animeByMALID(malID int) *kitsuAnime {
+	if ka, ok := s.byMALID[malID]; ok {
+		return ka
+	}
+	ka := &kitsuAnime{id: strconv.Itoa(len(s.anime) + 1000), malID: malID}
+	s.anime[ka.id] = ka
+	s.byMALID[malID] = ka
+	return ka
+}
+
+func toKitsuStatus(status anisync.Status) string {
+	switch status {
+	case anisync.Current:
+		return kitsu.LibraryEntryStatusCurrent
+	case anisync.Planned:
+		return kitsu.LibraryEntryStatusPlanned
+	case anisync.Completed:
+		return kitsu.LibraryEntryStatusCompleted
+	case anisync.OnHold:
+		return kitsu.LibraryEntryStatusOnHold
+	case anisync.Dropped:
+		return kitsu.LibraryEntryStatusDropped
+	default:
+		return ""
+	}
+}
+
+// handleList serves the library entries, optionally filtered by
+// filter[userId], a page at a time.
+func (s *KitsuServer) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, offset := s.PageLimit, 0
+	if v := q.Get("page[limit]"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			writeKitsuError(w, http.StatusBadRequest, "Invalid page limit", v)
+			return
+		}
+	}
+	if v := q.Get("page[offset]"); v != "" {
+		var err error
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			writeKitsuError(w, http.StatusBadRequest, "Invalid page offset", v)
+			return
+		}
+	}
+	limit = min(limit, s.MaxPageLimit)
+	include := parseInclude(q.Get("include"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched []*kitsuEntry
+	userID, filtered := q["filter[userId]"]
+	for _, e := range s.entries {
+		if !filtered || e.userID == userID[0] {
+			matched = append(matched, e)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].id < matched[j].id })
+
+	page := matched[min(offset, len(matched)):min(offset+limit, len(matched))]
+	doc := &jsonapi.ManyPayload{
+		Data:  []*jsonapi.Node{},
+		Links: s.pageLinks(r.URL, limit, offset, len(matched)),
+		Meta:  &jsonapi.Meta{"count": len(matched)},
+	}
+	included := make(map[string]bool)
+	for _, e := range page {
+		doc.Data = append(doc.Data, s.entryNode(e, include))
+		doc.Included = append(doc.Included, s.includedNodes(e, include, included)...)
+	}
+	writeKitsu(w, http.StatusOK, doc)
+}
+
+// pageLinks returns the first, prev, next and last links of a page, which
+// differ from the request URL only in their page[offset].
+func (s *KitsuServer) pageLinks(u *url.URL, limit, offset, count int) *jsonapi.Links {
+	link := func(offset int) string {
+		q := u.Query()
+		q.Set("page[limit]", strconv.Itoa(limit))
+		q.Set("page[offset]", strconv.Itoa(offset))
+		return strings.TrimSuffix(s.URL, "/") + u.Path + "?" + q.Encode()
+	}
+	last := 0
+	if count > 0 {
+		last = (count - 1) / limit * limit
+	}
+	links := jsonapi.Links{"first": link(0), "last": link(last)}
+	if offset > 0 {
+		links["prev"] = link(max(offset-limit, 0))
+	}
+	if offset+limit < count {
+		links["next"] = link(offset + limit)
+	}
+	return &links
+}
+
+// parseInclude returns the relationship paths of an include parameter. As in
+// JSON:API, including a path such as anime.mappings also includes its
+// parents.
+func parseInclude(include string) map[string]bool {
+	m := make(map[string]bool)
+	for _, rel := range strings.Split(include, ",") {
+		rel = strings.TrimSpace(rel)
+		for rel != "" {
+			m[rel] = true
+			i := strings.LastIndex(rel, ".")
+			if i < 0 {
+				break
+			}
+			rel = rel[:i]
+		}
+	}
+	return m
+}
+
+// entryNode returns the resource object of a library entry. The anime
+// relationship only has data when the anime is included.
+func (s *KitsuServer) entryNode(e *kitsuEntry, include map[string]bool) *jsonapi.Node {
+	n := &jsonapi.Node{
+		Type: "libraryEntries",
+		ID:   strconv.Itoa(e.id),
+		Attributes: map[string]interface{}{
+			"status":         e.status,
+			"progress":       e.progress,
+			"reconsuming":    e.rewatch,
+			"reconsumeCount": e.rewatches,
+			"notes":          e.notes,
+			"private":        false,
+			"rating":         e.rating,
+			"updatedAt":      e.updatedAt.Format(kitsuTimeLayout),
+		},
+	}
+	if include["anime"] {
+		n.Relationships = map[string]interface{}{
+			"anime": &jsonapi.RelationshipOneNode{Data: &jsonapi.Node{Type: "anime", ID: e.animeID}},
+		}
+	}
+	return n
+}
+
+// includedNodes returns the anime and mappings of a library entry that the
+// request includes and that are not already in seen.
+func (s *KitsuServer) includedNodes(e *kitsuEntry, include, seen map[string]bool) []*jsonapi.Node {
+	if !include["anime"] || seen["anime,"+e.animeID] {
+		return nil
+	}
+	seen["anime,"+e.animeID] = true
+	ka := s.anime[e.animeID]
+	anime := &jsonapi.Node{
+		Type: "anime",
+		ID:   ka.id,
+		Attributes: map[string]interface{}{
+			"canonicalTitle": ka.title,
+			"titles":         map[string]interface{}{"en_jp": ka.title},
+			"episodeCount":   ka.episodes,
+			"posterImage":    map[string]interface{}{"tiny": ka.image},
+		},
+	}
+	nodes := []*jsonapi.Node{anime}
+	if include["anime.mappings"] {
+		mapping := &jsonapi.Node{
+			Type: "mappings",
+			ID:   ka.id,
+			Attributes: map[string]interface{}{
+				"externalSite": kitsu.ExternalSiteMALAnime,
+				"externalId":   strconv.Itoa(ka.malID),
+			},
+		}
+		anime.Relationships = map[string]interface{}{
+			"mappings": &jsonapi.RelationshipManyNode{Data: []*jsonapi.Node{{Type: "mappings", ID: mapping.ID}}},
+		}
+		nodes = append(nodes, mapping)
+	}
+	return nodes
+}
+
+func (s *KitsuServer) handleShow(w http.ResponseWriter, r *http.Request) {
+	include := parseInclude(r.URL.Query().Get("include"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entry(w, r)
+	if !ok {
+		return
+	}
+	writeKitsu(w, http.StatusOK, &jsonapi.OnePayload{
+		Data:     s.entryNode(e, include),
+		Included: s.includedNodes(e, include, make(map[string]bool)),
+	})
+}
+
+// handleCreate creates a library entry from a document with the user and
+// anime relationships.
+func (s *KitsuServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	n, ok := readKitsuNode(w, r)
+	if !ok {
+		return
+	}
+	userID, animeID := relationshipID(n, "user"), relationshipID(n, "anime")
+	if userID == "" || animeID == "" {
+		writeKitsuError(w, http.StatusUnprocessableEntity, "Missing relationship", "user and anime are required")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.anime[animeID]; !ok {
+		writeKitsuError(w, http.StatusUnprocessableEntity, "Invalid anime", animeID)
+		return
+	}
+	for _, e := range s.entries {
+		if e.userID == userID && e.animeID == animeID {
+			writeKitsuError(w, http.StatusUnprocessableEntity, "Already in library", animeID)
+			return
+		}
+	}
+	s.nextID++
+	e := &kitsuEntry{id: s.nextID, userID: userID, animeID: animeID}
+	applyKitsuAttributes(e, n.Attributes)
+	s.entries[e.id] = e
+	writeKitsu(w, http.StatusCreated, &jsonapi.OnePayload{Data: s.entryNode(e, nil)})
+}
+
+func (s *KitsuServer) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	n, ok := readKitsuNode(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entry(w, r)
+	if !ok {
+		return
+	}
+	applyKitsuAttributes(e, n.Attributes)
+	writeKitsu(w, http.StatusOK, &jsonapi.OnePayload{Data: s.entryNode(e, nil)})
+}
+
+func (s *KitsuServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entry(w, r)
+	if !ok {
+		return
+	}
+	delete(s.entries, e.id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// entry returns the library entry of the {id} of the request path. The server
+// must be locked.
+func (s *KitsuServer) entry(w http.ResponseWriter, r *http.Request) (*kitsuEntry, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	e, ok := s.entries[id]
+	if err != nil || !ok {
+		writeKitsuError(w, http.StatusNotFound, "Record not found", r.PathValue("id"))
+		return nil, false
+	}
+	return e, true
+}
+
+func readKitsuNode(w http.ResponseWriter, r *http.Request) (*jsonapi.Node, bool) {
+	var doc jsonapi.OnePayload
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc.Data == nil {
+		writeKitsuError(w, http.StatusBadRequest, "Invalid document", fmt.Sprint(err))
+		return nil, false
+	}
+	return doc.Data, true
+}
+
+// relationshipID returns the ID of the to-one relationship name of n.
+func relationshipID(n *jsonapi.Node, name string) string {
+	var rel jsonapi.RelationshipOneNode
+	b, _ := json.Marshal(n.Relationships[name])
+	if err := json.Unmarshal(b, &rel); err != nil || rel.Data == nil {
+		return ""
+	}
+	return rel.Data.ID
+}
+
+// applyKitsuAttributes writes the attributes that are present to e and
+// touches it.
+func applyKitsuAttributes(e *kitsuEntry, attrs map[string]interface{}) {
+	if v, ok := attrs["status"].(string); ok {
+		e.status = v
+	}
+	if v, ok := attrs["progress"].(float64); ok {
+		e.progress = int(v)
+	}
+	if v, ok := attrs["rating"].(string); ok {
+		e.rating = v
+	}
+	if v, ok := attrs["notes"].(string); ok {
+		e.notes = v
+	}
+	if v, ok := attrs["reconsumeCount"].(float64); ok {
+		e.rewatches = int(v)
+	}
+	if v, ok := attrs["reconsuming"].(bool); ok {
+		e.rewatch = v
+	}
+	e.updatedAt = time.Now().UTC()
+}
+
+func writeKitsu(w http.ResponseWriter, status int, doc interface{}) {
+	w.Header().Set("Content-Type", kitsuMediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(doc)
+}
+
+func writeKitsuError(w http.ResponseWriter, status int, title, detail string) {
+	writeKitsu(w, status, map[string]interface{}{
+		"errors": []kitsu.Error{{
+			Title:  title,
+			Detail: detail,
+			Code:   strconv.Itoa(status),
+			Status: strconv.Itoa(status),
+		}},
+	})
+}
@@ -0,0 +1,317 @@
+// Package anisynctest provides in-process fake MyAnimeList.net, Kitsu.io,
+// AniList.co and Shikimori.one servers for end-to-end tests. Unlike the stubs
+// of the Resources interfaces, the fakes speak the wire formats of the real
+// APIs so requests go through the real API clients and their responses are
+// parsed by anisync. The fakes are stateful: writes change the lists that
+// later reads return.
+package anisynctest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstratos/go-myanimelist/mal"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// MALServer is a fake of the legacy MyAnimeList.net XML API. It serves the
+// anime lists (malappinfo.php), credential verification and adding, updating
+// and deleting anime of the list of the authenticated user.
+type MALServer struct {
+	// URL is the base URL of the server, to be used as the BaseURL of a
+	// mal.Client.
+	URL string
+
+	srv *httptest.Server
+
+	mu     sync.Mutex
+	users  map[string]*malUser // By lowercase username.
+	series map[int]mal.Anime   // The series fields of the anime seen so far.
+	nextID int
+}
+
+type malUser struct {
+	id       int
+	name     string
+	password string
+	anime    map[int]*mal.Anime
+}
+
+// NewMALServer starts a MALServer without any users. It should be closed when
+// done.
+func NewMALServer() *MALServer {
+	s := &MALServer{users: make(map[string]*malUser), series: make(map[int]mal.Anime)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /malappinfo.php", s.handleList)
+	mux.HandleFunc("GET /api/account/verify_credentials.xml", s.auth(s.handleVerify))
+	mux.HandleFunc("POST /api/animelist/add/{file}", s.auth(s.handleAdd))
+	mux.HandleFunc("POST /api/animelist/update/{file}", s.auth(s.handleUpdate))
+	mux.HandleFunc("DELETE /api/animelist/delete/{file}", s.auth(s.handleDelete))
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL + "/"
+	return s
+}
+
+// Close shuts the server down.
+func (s *MALServer) Close() { s.srv.Close() }
+
+// Client returns a mal.Client that uses the server with the credentials of
+// username.
+func (s *MALServer) Client(username, password string) *mal.Client {
+	c := mal.NewClient(mal.Auth(username, password), mal.HTTPClient(s.srv.Client()))
+	c.BaseURL, _ = url.Parse(s.URL)
+	return c
+}
+
+// AddUser creates a user with an anime list that has anime. Adding a user
+// that exists replaces their password and list. The titles, episodes and
+// images of the anime are also used for the anime that are added later
+// through the API.
+func (s *MALServer) AddUser(username, password string, anime ...anisync.Anime) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	u := &malUser{id: s.nextID, name: username, password: password, anime: make(map[int]*mal.Anime)}
+	for _, a := range anime {
+		u.anime[a.ID] = toMALAnime(a)
+		s.series[a.ID] = *u.anime[a.ID]
+	}
+	s.users[strings.ToLower(username)] = u
+}
+
+// Entries returns the anime list of username as it would be served, sorted by
+// ID.
+func (s *MALServer) Entries(username string) []mal.Anime {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[strings.ToLower(username)]
+	if !ok {
+		return nil
+	}
+	return u.sorted()
+}
+
+func (u *malUser) sorted() []mal.Anime {
+	list := make([]mal.Anime, 0, len(u.anime))
+	for _, a := range u.anime {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].SeriesAnimeDBID < list[j].SeriesAnimeDBID })
+	return list
+}
+
+func toMALAnime(a anisync.Anime) *mal.Anime {
+	m := &mal.Anime{
+		SeriesAnimeDBID:   a.ID,
+		SeriesTitle:       a.Title,
+		SeriesEpisodes:    a.Episodes,
+		SeriesImage:       a.Image,
+		MyStatus:          toMALStatus(a.Status),
+		MyWatchedEpisodes: a.EpisodesWatched,
+		MyRewatchingEp:    a.TimesRewatched,
+		MyLastUpdated:     "0",
+	}
+	if f, err := strconv.ParseFloat(a.Rating, 64); err == nil {
+		m.MyScore = int(math.Ceil(f * 2))
+	}
+	if a.Rewatching {
+		m.MyRewatching = 1
+	}
+	if a.LastUpdated != nil {
+		m.MyLastUpdated = strconv.FormatInt(a.LastUpdated.Unix(), 10)
+	}
+	return m
+}
+
+func toMALStatus(status anisync.Status) mal.Status {
+	switch status {
+	case anisync.Current:
+		return mal.Current
+	case anisync.Planned:
+		return mal.Planned
+	case anisync.Completed:
+		return mal.Completed
+	case anisync.OnHold:
+		return mal.OnHold
+	case anisync.Dropped:
+		return mal.Dropped
+	default:
+		return 0
+	}
+}
+
+// malList is the document served by malappinfo.php.
+type malList struct {
+	XMLName xml.Name         `xml:"myanimelist"`
+	MyInfo  *mal.AnimeMyInfo `xml:"myinfo,omitempty"`
+	Anime   []mal.Anime      `xml:"anime"`
+	Error   string           `xml:"error,omitempty"`
+}
+
+// handleList serves the list of a user. Like MyAnimeList.net, it responds with
+// an error element, and not an error status, for unknown users.
+func (s *MALServer) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("type") != "anime" {
+		http.Error(w, "unsupported type", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[strings.ToLower(r.FormValue("u"))]
+	if !ok {
+		writeXML(w, http.StatusOK, malList{Error: "Invalid username"})
+		return
+	}
+	list := malList{
+		MyInfo: &mal.AnimeMyInfo{ID: u.id, Name: u.name},
+		Anime:  u.sorted(),
+	}
+	for _, a := range list.Anime {
+		switch a.MyStatus {
+		case mal.Current:
+			list.MyInfo.Watching++
+		case mal.Completed:
+			list.MyInfo.Completed++
+		case mal.OnHold:
+			list.MyInfo.OnHold++
+		case mal.Dropped:
+			list.MyInfo.Dropped++
+		case mal.Planned:
+			list.MyInfo.PlanToWatch++
+		}
+	}
+	writeXML(w, http.StatusOK, list)
+}
+
+// auth checks the basic authentication of the request and passes the user to
+// fn with the server locked.
+func (s *MALServer) auth(fn func(http.ResponseWriter, *http.Request, *malUser)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		u, ok := s.users[strings.ToLower(username)]
+		if !ok || u.password != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="myanimelist.net"`)
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		fn(w, r, u)
+	}
+}
+
+func (s *MALServer) handleVerify(w http.ResponseWriter, r *http.Request, u *malUser) {
+	writeXML(w, http.StatusOK, mal.User{ID: u.id, Username: u.name})
+}
+
+func (s *MALServer) handleAdd(w http.ResponseWriter, r *http.Request, u *malUser) {
+	id, entry, ok := readMALEntry(w, r)
+	if !ok {
+		return
+	}
+	if _, exists := u.anime[id]; exists {
+		http.Error(w, "The anime (id: "+strconv.Itoa(id)+") is already in the list.", http.StatusBadRequest)
+		return
+	}
+	series := s.series[id]
+	a := &mal.Anime{
+		SeriesAnimeDBID: id,
+		SeriesTitle:     series.SeriesTitle,
+		SeriesEpisodes:  series.SeriesEpisodes,
+		SeriesImage:     series.SeriesImage,
+	}
+	applyMALEntry(a, entry, true)
+	u.anime[id] = a
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprint(w, "Created")
+}
+
+func (s *MALServer) handleUpdate(w http.ResponseWriter, r *http.Request, u *malUser) {
+	id, entry, ok := readMALEntry(w, r)
+	if !ok {
+		return
+	}
+	a, exists := u.anime[id]
+	if !exists {
+		http.Error(w, "This anime is not on your list.", http.StatusBadRequest)
+		return
+	}
+	applyMALEntry(a, entry, entry.Episode != a.MyWatchedEpisodes)
+	fmt.Fprint(w, "Updated")
+}
+
+func (s *MALServer) handleDelete(w http.ResponseWriter, r *http.Request, u *malUser) {
+	id, ok := fileID(w, r)
+	if !ok {
+		return
+	}
+	if _, exists := u.anime[id]; !exists {
+		http.Error(w, "This anime is not on your list.", http.StatusBadRequest)
+		return
+	}
+	delete(u.anime, id)
+	fmt.Fprint(w, "Deleted")
+}
+
+// fileID parses the anime ID from the {id}.xml file of the request path.
+func fileID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("file"), ".xml"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// readMALEntry reads the anime ID of the request path and the entry that is
+// sent as XML in the data form value.
+func readMALEntry(w http.ResponseWriter, r *http.Request) (int, mal.AnimeEntry, bool) {
+	var entry mal.AnimeEntry
+	id, ok := fileID(w, r)
+	if !ok {
+		return 0, entry, false
+	}
+	if err := xml.Unmarshal([]byte(r.PostFormValue("data")), &entry); err != nil {
+		http.Error(w, "Invalid data: "+err.Error(), http.StatusBadRequest)
+		return 0, entry, false
+	}
+	return id, entry, true
+}
+
+// applyMALEntry writes entry to a. MyAnimeList.net only changes the last
+// updated time of an anime when its episode changes, so that is what touch
+// should report for updates.
+func applyMALEntry(a *mal.Anime, entry mal.AnimeEntry, touch bool) {
+	a.MyWatchedEpisodes = entry.Episode
+	if entry.Status != 0 {
+		a.MyStatus = entry.Status
+	}
+	a.MyScore = entry.Score
+	a.MyRewatchingEp = entry.TimesRewatched
+	a.MyRewatching = entry.EnableRewatching
+	if touch || a.MyLastUpdated == "" {
+		a.MyLastUpdated = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(b)
+}
@@ -0,0 +1,388 @@
+package anisynctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/shikimori"
+)
+
+// ShikimoriServer is a fake of the user rates endpoints of the Shikimori.one
+// REST API. The anime lists of users can be read by nickname or ID, a page at
+// a time, by anyone. The rates of the user of an access token can be looked
+// up, created and updated through the v2 API.
+type ShikimoriServer struct {
+	// URL is the base URL of the server, to be used as the BaseURL of a
+	// shikimori.Client.
+	URL string
+
+	// MaxPageLimit is the largest page that is served. It is 5000 like on
+	// Shikimori.one and can be lowered to test pagination with a few rates.
+	MaxPageLimit int
+
+	srv *httptest.Server
+
+	mu     sync.Mutex
+	users  map[int]*shikimoriUser
+	anime  map[int]shikimoriAnime // By MyAnimeList.net ID.
+	nextID int                    // The last ID of a rate.
+}
+
+// ShikimoriRate is a user rate of the ShikimoriServer.
+type ShikimoriRate struct {
+	AnimeID   int // The MyAnimeList.net ID, which Shikimori uses too.
+	Title     string
+	Episodes  int    // Of the anime.
+	Status    string // Such as shikimori.StatusWatching.
+	Score     int
+	Watched   int // Episodes watched.
+	Rewatches int
+	Text      string
+	UpdatedAt time.Time
+}
+
+type shikimoriUser struct {
+	id       int
+	nickname string
+	token    string
+	rates    map[int]*shikimoriRate // By anime ID.
+}
+
+type shikimoriRate struct {
+	id int
+	ShikimoriRate
+}
+
+type shikimoriAnime struct {
+	title    string
+	episodes int
+}
+
+// NewShikimoriServer starts a ShikimoriServer without any users. It should be
+// closed when done.
+func NewShikimoriServer() *ShikimoriServer {
+	s := &ShikimoriServer{
+		MaxPageLimit: 5000,
+		users:        make(map[int]*shikimoriUser),
+		anime:        make(map[int]shikimoriAnime),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/users/whoami", s.handleWhoami)
+	mux.HandleFunc("GET /api/users/{user}/anime_rates", s.handleList)
+	mux.HandleFunc("GET /api/v2/user_rates", s.handleFind)
+	mux.HandleFunc("POST /api/v2/user_rates", s.handleCreate)
+	mux.HandleFunc("PATCH /api/v2/user_rates/{id}", s.handleUpdate)
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL + "/"
+	return s
+}
+
+// Close shuts the server down.
+func (s *ShikimoriServer) Close() { s.srv.Close() }
+
+// Client returns a shikimori.Client that uses the server with an access token.
+func (s *ShikimoriServer) Client(token string) *shikimori.Client {
+	c := shikimori.NewClient(s.srv.Client(), token)
+	c.BaseURL, _ = url.Parse(s.URL)
+	return c
+}
+
+// AddUser adds a user with an ID, an access token and rates. The anime of the
+// rates become known to the server, so that other users can rate them too.
+func (s *ShikimoriServer) AddUser(id int, nickname, token string, rates ...ShikimoriRate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &shikimoriUser{id: id, nickname: nickname, token: token, rates: make(map[int]*shikimoriRate)}
+	s.users[id] = u
+	for _, r := range rates {
+		s.anime[r.AnimeID] = shikimoriAnime{title: r.Title, episodes: r.Episodes}
+		if r.UpdatedAt.IsZero() {
+			r.UpdatedAt = time.Now()
+		}
+		s.nextID++
+		u.rates[r.AnimeID] = &shikimoriRate{id: s.nextID, ShikimoriRate: r}
+	}
+}
+
+// AddAnime makes an anime known to the server, so that it can be rated.
+func (s *ShikimoriServer) AddAnime(id int, title string, episodes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.anime[id] = shikimoriAnime{title: title, episodes: episodes}
+}
+
+// Rates returns the rates of a user, ordered by anime ID.
+func (s *ShikimoriServer) Rates(userID int) []ShikimoriRate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+	var rates []ShikimoriRate
+	for _, r := range u.sorted() {
+		rates = append(rates, r.ShikimoriRate)
+	}
+	return rates
+}
+
+func (u *shikimoriUser) sorted() []*shikimoriRate {
+	var rates []*shikimoriRate
+	for _, r := range u.rates {
+		rates = append(rates, r)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].AnimeID < rates[j].AnimeID })
+	return rates
+}
+
+// user returns the user of a nickname or ID. The server must be locked.
+func (s *ShikimoriServer) user(nicknameOrID string) (*shikimoriUser, bool) {
+	if id, err := strconv.Atoi(nicknameOrID); err == nil {
+		u, ok := s.users[id]
+		return u, ok
+	}
+	for _, u := range s.users {
+		if strings.EqualFold(u.nickname, nicknameOrID) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// viewer returns the user of the access token of the request, or nil. The
+// server must be locked.
+func (s *ShikimoriServer) viewer(r *http.Request) *shikimoriUser {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for _, u := range s.users {
+		if ok && token != "" && u.token == token {
+			return u
+		}
+	}
+	return nil
+}
+
+// handleWhoami serves the user of the access token, or null like Shikimori
+// does without a valid one.
+func (s *ShikimoriServer) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.viewer(r)
+	if u == nil {
+		writeShikimori(w, http.StatusOK, nil)
+		return
+	}
+	writeShikimori(w, http.StatusOK, map[string]interface{}{"id": u.id, "nickname": u.nickname})
+}
+
+// handleList serves a page of the rates of a user, with one more rate than
+// the limit when there are more pages, like Shikimori does.
+func (s *ShikimoriServer) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, page := s.MaxPageLimit, 1
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			writeShikimoriError(w, http.StatusUnprocessableEntity, "Invalid limit")
+			return
+		}
+	}
+	if v := q.Get("page"); v != "" {
+		var err error
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			writeShikimoriError(w, http.StatusUnprocessableEntity, "Invalid page")
+			return
+		}
+	}
+	limit = min(limit, s.MaxPageLimit)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.user(r.PathValue("user"))
+	if !ok {
+		writeShikimoriError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	all := u.sorted()
+	start := min((page-1)*limit, len(all))
+	end := min(start+limit+1, len(all))
+	out := []interface{}{}
+	for _, rate := range all[start:end] {
+		out = append(out, map[string]interface{}{
+			"id":         rate.id,
+			"score":      rate.Score,
+			"status":     rate.Status,
+			"text":       rate.Text,
+			"episodes":   rate.Watched,
+			"rewatches":  rate.Rewatches,
+			"updated_at": rate.UpdatedAt.Format(time.RFC3339),
+			"anime": map[string]interface{}{
+				"id":       rate.AnimeID,
+				"name":     rate.Title,
+				"episodes": rate.Episodes,
+				"image":    map[string]interface{}{"preview": "/system/animes/preview/" + strconv.Itoa(rate.AnimeID) + ".jpg"},
+			},
+		})
+	}
+	writeShikimori(w, http.StatusOK, out)
+}
+
+func (s *ShikimoriServer) rateJSON(u *shikimoriUser, r *shikimoriRate) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          r.id,
+		"user_id":     u.id,
+		"target_id":   r.AnimeID,
+		"target_type": "Anime",
+		"score":       r.Score,
+		"status":      r.Status,
+		"episodes":    r.Watched,
+		"rewatches":   r.Rewatches,
+		"text":        r.Text,
+	}
+}
+
+// handleFind serves the rates of a user filtered by target_id.
+func (s *ShikimoriServer) handleFind(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.user(q.Get("user_id"))
+	if !ok {
+		writeShikimori(w, http.StatusOK, []interface{}{})
+		return
+	}
+	out := []interface{}{}
+	for _, rate := range u.sorted() {
+		if t := q.Get("target_id"); t == "" || t == strconv.Itoa(rate.AnimeID) {
+			out = append(out, s.rateJSON(u, rate))
+		}
+	}
+	writeShikimori(w, http.StatusOK, out)
+}
+
+type shikimoriRateRequest struct {
+	UserRate struct {
+		UserID     int     `json:"user_id"`
+		TargetID   int     `json:"target_id"`
+		TargetType string  `json:"target_type"`
+		Status     *string `json:"status"`
+		Score      *int    `json:"score"`
+		Episodes   *int    `json:"episodes"`
+		Rewatches  *int    `json:"rewatches"`
+		Text       *string `json:"text"`
+	} `json:"user_rate"`
+}
+
+func (s *ShikimoriServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req shikimoriRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeShikimoriError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.viewer(r)
+	if u == nil || u.id != req.UserRate.UserID {
+		writeShikimoriError(w, http.StatusForbidden, "You are not authorized to access this page.")
+		return
+	}
+	anime, ok := s.anime[req.UserRate.TargetID]
+	if !ok || req.UserRate.TargetType != "Anime" {
+		writeShikimori(w, http.StatusUnprocessableEntity, map[string]interface{}{"errors": []string{"Target not found"}})
+		return
+	}
+	if _, ok := u.rates[req.UserRate.TargetID]; ok {
+		writeShikimori(w, http.StatusUnprocessableEntity, map[string]interface{}{"errors": []string{"User has already been taken"}})
+		return
+	}
+	s.nextID++
+	rate := &shikimoriRate{id: s.nextID, ShikimoriRate: ShikimoriRate{
+		AnimeID: req.UserRate.TargetID, Title: anime.title, Episodes: anime.episodes, Status: shikimori.StatusPlanned,
+	}}
+	if !s.apply(w, rate, req) {
+		return
+	}
+	u.rates[rate.AnimeID] = rate
+	writeShikimori(w, http.StatusCreated, s.rateJSON(u, rate))
+}
+
+func (s *ShikimoriServer) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var req shikimoriRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeShikimoriError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.viewer(r)
+	if u == nil {
+		writeShikimoriError(w, http.StatusForbidden, "You are not authorized to access this page.")
+		return
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	for _, rate := range u.rates {
+		if rate.id == id {
+			if s.apply(w, rate, req) {
+				writeShikimori(w, http.StatusOK, s.rateJSON(u, rate))
+			}
+			return
+		}
+	}
+	writeShikimoriError(w, http.StatusNotFound, "Not found")
+}
+
+// apply writes the fields of the request that are present to the rate and
+// touches it, or responds with an error if they are not valid.
+func (s *ShikimoriServer) apply(w http.ResponseWriter, rate *shikimoriRate, req shikimoriRateRequest) bool {
+	v := req.UserRate
+	if v.Score != nil && (*v.Score < 0 || *v.Score > 10) {
+		writeShikimori(w, http.StatusUnprocessableEntity, map[string]interface{}{"errors": map[string][]string{"score": {"is invalid"}}})
+		return false
+	}
+	if v.Status != nil {
+		if !validShikimoriStatus(*v.Status) {
+			writeShikimori(w, http.StatusUnprocessableEntity, map[string]interface{}{"errors": map[string][]string{"status": {"is invalid"}}})
+			return false
+		}
+		rate.Status = *v.Status
+	}
+	if v.Score != nil {
+		rate.Score = *v.Score
+	}
+	if v.Episodes != nil {
+		rate.Watched = *v.Episodes
+	}
+	if v.Rewatches != nil {
+		rate.Rewatches = *v.Rewatches
+	}
+	if v.Text != nil {
+		rate.Text = *v.Text
+	}
+	rate.UpdatedAt = time.Now()
+	return true
+}
+
+func validShikimoriStatus(status string) bool {
+	switch status {
+	case shikimori.StatusPlanned, shikimori.StatusWatching, shikimori.StatusRewatching,
+		shikimori.StatusCompleted, shikimori.StatusOnHold, shikimori.StatusDropped:
+		return true
+	}
+	return false
+}
+
+func writeShikimori(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeShikimoriError(w http.ResponseWriter, status int, message string) {
+	writeShikimori(w, status, map[string]interface{}{"message": message, "code": status})
+}
@@ -0,0 +1,231 @@
+// Package audit keeps a tamper-evident log of every write to
+// MyAnimeList.net: the entry that was sent for each anime, the status of the
+// response and how long it took.
+//
+// The log is a file with one JSON record per line that is only ever appended
+// to. Each record holds the hash of the record before it and its own hash, so
+// editing, removing or reordering records breaks the chain, which Verify
+// detects. Only removing records from the end goes unnoticed, unless the hash
+// of the last record is compared to one that was noted down before.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nstratos/go-myanimelist/mal"
+
+	"github.com/nstratos/anisync/anisync/internal/filelock"
+)
+
+// The operations of the records.
+const (
+	OpAdd    = "add"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Record is the audit record of a write.
+type Record struct {
+	Seq         int64 // Position of the record in the log, starting at 1.
+	Time        time.Time
+	MALUsername string `json:",omitempty"`
+	Op          string
+	AnimeID     int
+	Entry       *mal.AnimeEntry `json:",omitempty"` // What was sent, nil for deletes.
+	Status      int             `json:",omitempty"` // Status of the response, 0 if there was none.
+	Duration    time.Duration
+	Error       string `json:",omitempty"`
+	PrevHash    string // Hash of the previous record, empty for the first one.
+	Hash        string // Hash of this record with an empty Hash.
+}
+
+// hash returns the hash of the record with an empty Hash.
+func (r Record) hash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends records to an audit log file. It is safe for concurrent use,
+// also by several processes: each append locks the log and continues the
+// chain from the last record in the file.
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// maxRecord is the largest record that is read back.
+const maxRecord = 1 << 20
+
+// Open opens the audit log at path, creating its directory if needed. The
+// records already in the log are not verified.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if _, err := lastRecord(path); err != nil {
+		return nil, err
+	}
+	return &Log{path: path}, nil
+}
+
+// Append chains a record to the log and writes it. Seq, PrevHash and Hash are
+// set by Append.
+func (l *Log) Append(r Record) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := filelock.Lock(l.path + ".lock")
+	if err != nil {
+		return r, err
+	}
+	defer unlock()
+
+	last, err := lastRecord(l.path)
+	if err != nil {
+		return r, err
+	}
+	r.Seq, r.PrevHash = 1, ""
+	if last != nil {
+		r.Seq, r.PrevHash = last.Seq+1, last.Hash
+	}
+	if r.Hash, err = r.hash(); err != nil {
+		return r, err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return r, err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return r, err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return r, err
+	}
+	return r, f.Close()
+}
+
+// lastRecord returns the last record of the log at path, or nil if there is
+// none.
+func lastRecord(path string) (*Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	off := max(fi.Size()-maxRecord-1, 0)
+	b := make([]byte, fi.Size()-off)
+	if _, err := f.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, nil
+	}
+	b = b[bytes.LastIndexByte(b, '\n')+1:]
+	var r Record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("audit %s: invalid last record: %v", path, err)
+	}
+	return &r, nil
+}
+
+// ChainError reports where the chain of an audit log is broken.
+type ChainError struct {
+	Line   int
+	Seq    int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit: chain broken at line %d (record %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// Verify checks the chain of the audit log at path and returns the number of
+// records it holds. If the chain is broken, the error is a *ChainError for the
+// first record that does not fit.
+func Verify(path string) (int, error) {
+	n := 0
+	var prev string
+	err := scan(path, func(line int, r Record) error {
+		h, err := r.hash()
+		if err != nil {
+			return err
+		}
+		switch {
+		case r.Seq != int64(n+1):
+			return &ChainError{Line: line, Seq: r.Seq, Reason: fmt.Sprintf("expected record %d", n+1)}
+		case r.PrevHash != prev:
+			return &ChainError{Line: line, Seq: r.Seq, Reason: "previous hash does not match"}
+		case r.Hash != h:
+			return &ChainError{Line: line, Seq: r.Seq, Reason: "hash does not match the record"}
+		}
+		n++
+		prev = r.Hash
+		return nil
+	})
+	return n, err
+}
+
+// Read returns the records of the audit log at path that match, or all of them
+// if match is nil, in the order they were written. It does not verify the
+// chain.
+func Read(path string, match func(Record) bool) ([]Record, error) {
+	var records []Record
+	err := scan(path, func(line int, r Record) error {
+		if match == nil || match(r) {
+			records = append(records, r)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// scan calls fn with each record of the log at path.
+func scan(path string, fn func(line int, r Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return &ChainError{Line: line, Reason: "invalid record: " + err.Error()}
+		}
+		if err := fn(line, r); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("audit %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package audit_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/nstratos/go-kitsu/kitsu"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/anisynctest"
+	"github.com/nstratos/anisync/anisync/audit"
+)
+
+func TestWrap(t *testing.T) {
+	malSrv := anisynctest.NewMALServer()
+	defer malSrv.Close()
+	malSrv.AddUser("TestUser", "TestPass", anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 1})
+
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := audit.Open(path)
+	if err != nil {
+		t.Fatal("Open returned err:", err)
+	}
+	r := anisync.NewResources(malSrv.Client("TestUser", "TestPass"), kitsu.NewClient(nil))
+	c := anisync.NewClient(audit.Wrap(r, l, "TestUser"))
+
+	if err := c.UpdateMALAnime(anisync.Anime{ID: 1, Status: anisync.Current, EpisodesWatched: 5, Rating: "4.5"}); err != nil {
+		t.Fatal("UpdateMALAnime returned err:", err)
+	}
+	if err := c.AddMALAnime(anisync.Anime{ID: 2, Status: anisync.Planned}); err != nil {
+		t.Fatal("AddMALAnime returned err:", err)
+	}
+	if err := c.AddMALAnime(anisync.Anime{ID: 2, Status: anisync.Planned}); err == nil {
+		t.Fatal("adding an anime twice expected to return err")
+	}
+	if err := c.DeleteMALAnime(2); err != nil {
+		t.Fatal("DeleteMALAnime returned err:", err)
+	}
+
+	records, err := audit.Read(path, func(r audit.Record) bool { return r.AnimeID == 2 })
+	if err != nil {
+		t.Fatal("Read returned err:", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Read of anime 2 got %d records, want 3", len(records))
+	}
+	tests := []struct {
+		op       string
+		status   int
+		hasEntry bool
+		hasError bool
+	}{
+		{audit.OpAdd, http.StatusCreated, true, false},
+		{audit.OpAdd, http.StatusBadRequest, true, true},
+		{audit.OpDelete, http.StatusOK, false, false},
+	}
+	for i, tt := range tests {
+		got := records[i]
+		if got.Op != tt.op || got.Status != tt.status || (got.Entry != nil) != tt.hasEntry || (got.Error != "") != tt.hasError {
+			t.Errorf("record %d = %+v, want op %s, status %d, entry %v, error %v", i, got, tt.op, tt.status, tt.hasEntry, tt.hasError)
+		}
+		if got.MALUsername != "TestUser" {
+			t.Errorf("record %d MALUsername = %q, want %q", i, got.MALUsername, "TestUser")
+		}
+	}
+	all, err := audit.Read(path, nil)
+	if err != nil {
+		t.Fatal("Read returned err:", err)
+	}
+	if e := all[0].Entry; e == nil || e.Episode != 5 || e.Score != 9 {
+		t.Errorf("update record entry = %+v, want episode 5 and score 9", e)
+	}
+
+	if n, err := audit.Verify(path); err != nil || n != 4 {
+		t.Errorf("Verify = %d, %v, want 4 records and no error", n, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := audit.Open(path)
+	if err != nil {
+		t.Fatal("Open returned err:", err)
+	}
+	for id := 1; id <= 3; id++ {
+		if _, err := l.Append(audit.Record{Op: audit.OpDelete, AnimeID: id}); err != nil {
+			t.Fatal("Append returned err:", err)
+		}
+	}
+	// Reopening continues the chain.
+	if l, err = audit.Open(path); err != nil {
+		t.Fatal("Open returned err:", err)
+	}
+	rec, err := l.Append(audit.Record{Op: audit.OpDelete, AnimeID: 4})
+	if err != nil {
+		t.Fatal("Append returned err:", err)
+	}
+	if rec.Seq != 4 {
+		t.Errorf("record appended after reopening has Seq %d, want 4", rec.Seq)
+	}
+	if n, err := audit.Verify(path); err != nil || n != 4 {
+		t.Fatalf("Verify = %d, %v, want 4 records and no error", n, err)
+	}
+
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(orig, []byte("\n"))
+	tests := []struct {
+		name     string
+		data     []byte
+		wantLine int
+	}{
+		{"edited", bytes.Replace(orig, []byte(`"AnimeID":2`), []byte(`"AnimeID":7`), 1), 2},
+		{"removed", bytes.Join([][]byte{lines[0], lines[2], lines[3]}, nil), 2},
+		{"reordered", bytes.Join([][]byte{lines[0], lines[2], lines[1], lines[3]}, nil), 2},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, tt.data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := audit.Verify(path)
+		var cerr *audit.ChainError
+		if !errors.As(err, &cerr) || cerr.Line != tt.wantLine {
+			t.Errorf("Verify of %s log returned err %v, want ChainError at line %d", tt.name, err, tt.wantLine)
+		}
+	}
+}
+
+func TestAppendShared(t *testing.T) {
+	// Logs opened on the same file, as by several processes, keep one chain.
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var logs []*audit.Log
+	for i := 0; i < 3; i++ {
+		l, err := audit.Open(path)
+		if err != nil {
+			t.Fatal("Open returned err:", err)
+		}
+		logs = append(logs, l)
+	}
+	var wg sync.WaitGroup
+	for i, l := range logs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := 1; id <= 10; id++ {
+				if _, err := l.Append(audit.Record{Op: audit.OpDelete, AnimeID: i*10 + id}); err != nil {
+					t.Error("Append returned err:", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := audit.Verify(path); err != nil || n != 30 {
+		t.Errorf("Verify = %d, %v, want 30 records and no error", n, err)
+	}
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nstratos/go-myanimelist/mal"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// Wrap returns Resources that call r and append a record to l for every add,
+// update and delete of a MyAnimeList.net entry, whether it succeeds or not.
+// The records are attributed to malUsername. Reads are not recorded.
+//
+// If a record cannot be appended, the write returns an error even if it
+// succeeded, so that no write goes unaudited without being noticed.
+func Wrap(r anisync.Resources, l *Log, malUsername string) anisync.Resources {
+	return &resources{Resources: r, log: l, malUsername: malUsername}
+}
+
+type resources struct {
+	anisync.Resources
+	log         *Log
+	malUsername string
+}
+
+func (ar *resources) record(op string, id int, entry *mal.AnimeEntry, start time.Time, resp *mal.Response, err error) error {
+	rec := Record{
+		Time:        start.UTC(),
+		MALUsername: ar.malUsername,
+		Op:          op,
+		AnimeID:     id,
+		Entry:       entry,
+		Duration:    time.Since(start),
+	}
+	if resp != nil && resp.Response != nil {
+		rec.Status = resp.StatusCode
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if _, aerr := ar.log.Append(rec); aerr != nil {
+		if err != nil {
+			return fmt.Errorf("%v (audit record failed: %v)", err, aerr)
+		}
+		return fmt.Errorf("%s of anime %d succeeded but its audit record failed: %v", op, id, aerr)
+	}
+	return err
+}
+
+func (ar *resources) AddMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Response, error) {
+	start := time.Now()
+	resp, err := ar.Resources.AddMALAnimeEntry(id, entry)
+	return resp, ar.record(OpAdd, id, &entry, start, resp, err)
+}
+
+func (ar *resources) UpdateMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Response, error) {
+	start := time.Now()
+	resp, err := ar.Resources.UpdateMALAnimeEntry(id, entry)
+	return resp, ar.record(OpUpdate, id, &entry, start, resp, err)
+}
+
+func (ar *resources) DeleteMALAnimeEntry(id int) (*mal.Response, error) {
+	start := time.Now()
+	resp, err := ar.Resources.DeleteMALAnimeEntry(id)
+	return resp, ar.record(OpDelete, id, nil, start, resp, err)
+}
@@ -0,0 +1,321 @@
+// Package cassette records the HTTP interactions of the MyAnimeList.net and
+// Kitsu.io clients to a file, called a cassette, and replays them offline. A
+// cassette of a problem can be attached to a bug report so that the problem
+// can be reproduced without access to the accounts involved.
+//
+// Credentials are scrubbed before the interactions are stored: the
+// authentication and cookie headers, the user info of URLs and the query and
+// form values that look like secrets are replaced by a placeholder.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Redacted replaces the credentials in the cassettes.
+const Redacted = "REDACTED"
+
+// Cassette is the file format of the recorded interactions.
+type Cassette struct {
+	Interactions []*Interaction
+}
+
+// Interaction is a request and the response that it got.
+type Interaction struct {
+	Request  Request
+	Response Response
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header `json:",omitempty"`
+	Body   Body        `json:",omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	StatusCode int
+	Header     http.Header `json:",omitempty"`
+	Body       Body        `json:",omitempty"`
+}
+
+// Body is the body of a request or response. It is stored as a string when it
+// is valid UTF-8 and as base64 otherwise.
+type Body []byte
+
+// MarshalJSON implements json.Marshaler.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"Base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var enc struct{ Base64 string }
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	dec, err := base64.StdEncoding.DecodeString(enc.Base64)
+	*b = dec
+	return err
+}
+
+// Load reads a cassette from a file.
+func Load(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("cassette %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to a file, replacing it at once so that a crash
+// never leaves half a cassette.
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Recorder is an http.RoundTripper that sends the requests with another
+// RoundTripper and records them with their responses to a cassette file. The
+// file is saved after every interaction.
+type Recorder struct {
+	path string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a Recorder that records to the file at path, replacing
+// it, and sends the requests with next, or http.DefaultTransport if nil.
+func NewRecorder(path string, next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{path: path, next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &Interaction{
+		Request: scrubRequest(req, reqBody),
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     scrubHeader(resp.Header),
+			Body:       respBody,
+		},
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	if err := r.cassette.Save(r.path); err != nil {
+		return nil, fmt.Errorf("cassette: %v", err)
+	}
+	return resp, nil
+}
+
+// readBody reads a request or response body and replaces it with a reader of
+// what was read.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = io.NopCloser(bytes.NewReader(b))
+	return b, err
+}
+
+// ErrNoInteraction is returned by a Replayer for requests that are not in the
+// cassette.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+// Replayer is an http.RoundTripper that responds to requests with the
+// responses recorded in a cassette, without any network access.
+//
+// Requests match an interaction if their method, URL and body are the same
+// after scrubbing, so the credentials used when replaying do not matter. The
+// interactions of the same request are replayed in the order they were
+// recorded, the last one repeating once they run out.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewReplayer returns a Replayer of the cassette file at path.
+func NewReplayer(path string) (*Replayer, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{interactions: c.Interactions, used: make([]bool, len(c.Interactions))}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	want := scrubRequest(req, body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i, in := range r.interactions {
+		if !matches(in.Request, want) {
+			continue
+		}
+		last = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if last < 0 {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoInteraction, want.Method, want.URL)
+	}
+	r.used[last] = true
+	return r.interactions[last].response(req), nil
+}
+
+func matches(got, want Request) bool {
+	return got.Method == want.Method && got.URL == want.URL && bytes.Equal(got.Body, want.Body)
+}
+
+func (in *Interaction) response(req *http.Request) *http.Response {
+	header := in.Response.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(in.Response.Body)),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}
+}
+
+// secretHeaders are the headers that are never stored.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// isSecret reports whether a query or form value of that name should be
+// scrubbed.
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"password", "passwd", "secret", "token", "apikey", "api_key"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func scrubRequest(req *http.Request, body []byte) Request {
+	u := *req.URL
+	if u.User != nil {
+		u.User = url.User(Redacted)
+	}
+	u.RawQuery = scrubValues(u.RawQuery)
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body = []byte(scrubValues(string(body)))
+	}
+	return Request{
+		Method: req.Method,
+		URL:    u.String(),
+		Header: scrubHeader(req.Header),
+		Body:   body,
+	}
+}
+
+// scrubValues redacts the secret values of a URL encoded query or form. It
+// returns the query unchanged if there is nothing to redact so that the order
+// of the values is kept.
+func scrubValues(query string) string {
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+	scrubbed := false
+	for name, vals := range v {
+		if isSecret(name) {
+			for i := range vals {
+				vals[i] = Redacted
+			}
+			scrubbed = true
+		}
+	}
+	if !scrubbed {
+		return query
+	}
+	return v.Encode()
+}
+
+func scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range secretHeaders {
+		if _, ok := h[name]; ok {
+			h[name] = []string{Redacted}
+		}
+	}
+	return h
+}
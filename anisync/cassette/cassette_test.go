@@ -0,0 +1,103 @@
+package cassette_test
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstratos/go-kitsu/kitsu"
+	"github.com/nstratos/go-myanimelist/mal"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/anisynctest"
+	"github.com/nstratos/anisync/anisync/cassette"
+)
+
+// newClient returns a client of the fake servers that sends its requests
+// through rt.
+func newClient(malSrv *anisynctest.MALServer, kitsuSrv *anisynctest.KitsuServer, password string, rt http.RoundTripper) *anisync.Client {
+	httpcl := &http.Client{Transport: rt}
+	malClient := mal.NewClient(mal.Auth("TestUser", password), mal.HTTPClient(httpcl))
+	malClient.BaseURL = malSrv.Client("", "").BaseURL
+	kitsuClient := kitsu.NewClient(httpcl)
+	kitsuClient.BaseURL = kitsuSrv.Client().BaseURL
+	return anisync.NewClient(anisync.NewResources(malClient, kitsuClient))
+}
+
+func TestRecordReplay(t *testing.T) {
+	now := time.Now()
+	malSrv := anisynctest.NewMALServer()
+	malSrv.AddUser("TestUser", "TestPass",
+		anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 1, LastUpdated: &now})
+	kitsuSrv := anisynctest.NewKitsuServer()
+	kitsuSrv.AddLibrary("42",
+		anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 5, LastUpdated: &now},
+		anisync.Anime{ID: 2, Title: "Anime2", Status: anisync.Planned, LastUpdated: &now})
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	c := newClient(malSrv, kitsuSrv, "TestPass", cassette.NewRecorder(path, nil))
+	if _, _, err := c.VerifyMALCredentials("TestUser", "TestPass"); err != nil {
+		t.Fatal("VerifyMALCredentials returned err:", err)
+	}
+	recorded := syncLists(t, c)
+	malSrv.Close()
+	kitsuSrv.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"TestPass", "VGVzdFVzZXI6VGVzdFBhc3M="} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("cassette contains the credential %q", secret)
+		}
+	}
+
+	r, err := cassette.NewReplayer(path)
+	if err != nil {
+		t.Fatal("NewReplayer returned err:", err)
+	}
+	// The password does not matter when replaying as it was scrubbed.
+	c = newClient(malSrv, kitsuSrv, "other", r)
+	if _, _, err := c.VerifyMALCredentials("TestUser", "other"); err != nil {
+		t.Fatal("replayed VerifyMALCredentials returned err:", err)
+	}
+	if replayed := syncLists(t, c); replayed != recorded {
+		t.Errorf("replayed sync got %q, recorded %q", replayed, recorded)
+	}
+
+	if _, _, err := c.GetKitsuAnimeList("43"); !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("request that was not recorded returned err %v, want ErrNoInteraction", err)
+	}
+}
+
+// syncLists compares the lists, syncs them and returns a summary.
+func syncLists(t *testing.T, c *anisync.Client) string {
+	malist, _, err := c.GetMyAnimeList("TestUser")
+	if err != nil {
+		t.Fatal("GetMyAnimeList returned err:", err)
+	}
+	kitsuList, _, err := c.GetKitsuAnimeList("42")
+	if err != nil {
+		t.Fatal("GetKitsuAnimeList returned err:", err)
+	}
+	res := c.SyncMALAnime(*anisync.Compare(malist, kitsuList))
+	var ids []string
+	for _, a := range res.Adds {
+		ids = append(ids, "add "+a.Anime.Title)
+	}
+	for _, u := range res.Updates {
+		ids = append(ids, "update "+u.Anime.Title)
+	}
+	for _, f := range res.AddFails {
+		ids = append(ids, "add fail "+f.Error.Error())
+	}
+	for _, f := range res.UpdateFails {
+		ids = append(ids, "update fail "+f.Error.Error())
+	}
+	return strings.Join(ids, ", ")
+}
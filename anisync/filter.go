@@ -0,0 +1,119 @@
+package anisync
+
+import (
+	"regexp"
+	"time"
+)
+
+// Category is the category of a Diff that an anime falls under.
+type Category int
+
+// The categories of a Diff that can be synced.
+const (
+	Missing Category = iota + 1
+	NeedUpdate
+)
+
+func (c Category) String() string {
+	switch c {
+	case Missing:
+		return "missing"
+	case NeedUpdate:
+		return "need update"
+	default:
+		return "unknown"
+	}
+}
+
+// Filter reports whether an anime of a Diff, which falls under category c,
+// should be kept for syncing.
+type Filter func(a Anime, c Category) bool
+
+// FilterStatus returns a Filter that keeps the anime which have one of the
+// provided statuses.
+func FilterStatus(statuses ...Status) Filter {
+	return func(a Anime, _ Category) bool {
+		for _, s := range statuses {
+			if a.Status == s {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterIDs returns a Filter that keeps the anime which have one of the
+// provided MyAnimeList IDs.
+func FilterIDs(ids ...int) Filter {
+	return func(a Anime, _ Category) bool {
+		for _, id := range ids {
+			if a.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterUpdatedSince returns a Filter that keeps the anime which were last
+// updated at or after t. Anime without a LastUpdated time are filtered out.
+func FilterUpdatedSince(t time.Time) Filter {
+	return func(a Anime, _ Category) bool {
+		return a.LastUpdated != nil && !a.LastUpdated.Before(t)
+	}
+}
+
+// FilterTitle returns a Filter that keeps the anime whose title matches re.
+func FilterTitle(re *regexp.Regexp) Filter {
+	return func(a Anime, _ Category) bool {
+		return re.MatchString(a.Title)
+	}
+}
+
+// FilterCategory returns a Filter that keeps the anime which fall under one
+// of the provided categories.
+func FilterCategory(categories ...Category) Filter {
+	return func(_ Anime, c Category) bool {
+		for _, cat := range categories {
+			if c == cat {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterDiff applies filters to the missing anime and the anime that need
+// update of diff. It returns a copy of diff that contains only the anime that
+// passed all the filters and a Diff that contains the missing anime and the
+// anime that need update which were filtered out. The rest of the fields of
+// diff are kept as they are.
+func FilterDiff(diff Diff, filters ...Filter) (kept, skipped Diff) {
+	kept = diff
+	kept.Missing = nil
+	kept.NeedUpdate = nil
+	for _, a := range diff.Missing {
+		if keep(a, Missing, filters) {
+			kept.Missing = append(kept.Missing, a)
+		} else {
+			skipped.Missing = append(skipped.Missing, a)
+		}
+	}
+	for _, d := range diff.NeedUpdate {
+		if keep(d.Anime, NeedUpdate, filters) {
+			kept.NeedUpdate = append(kept.NeedUpdate, d)
+		} else {
+			skipped.NeedUpdate = append(skipped.NeedUpdate, d)
+		}
+	}
+	return kept, skipped
+}
+
+func keep(a Anime, c Category, filters []Filter) bool {
+	for _, f := range filters {
+		if f != nil && !f(a, c) {
+			return false
+		}
+	}
+	return true
+}
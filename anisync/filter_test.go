@@ -0,0 +1,67 @@
+package anisync_test
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+var filterDiff = anisync.Diff{
+	Missing: []anisync.Anime{
+		{ID: 1, Title: "Death Parade", Status: anisync.Current, LastUpdated: &now},
+		{ID: 2, Title: "Ore Monogatari", Status: anisync.Completed, LastUpdated: &before},
+	},
+	NeedUpdate: []anisync.AniDiff{
+		{Anime: anisync.Anime{ID: 3, Title: "Shingeki no Kyojin", Status: anisync.Current, LastUpdated: &before}},
+		{Anime: anisync.Anime{ID: 4, Title: "Kuroko no Basuke", Status: anisync.Dropped}},
+	},
+	UpToDate: []anisync.Anime{{ID: 5, Title: "Berserk"}},
+}
+
+var filterDiffTests = []struct {
+	name       string
+	filters    []anisync.Filter
+	keptIDs    []int
+	skippedIDs []int
+}{
+	{"no filters", nil, []int{1, 2, 3, 4}, nil},
+	{"status", []anisync.Filter{anisync.FilterStatus(anisync.Current)}, []int{1, 3}, []int{2, 4}},
+	{"ids", []anisync.Filter{anisync.FilterIDs(2, 4)}, []int{2, 4}, []int{1, 3}},
+	{"updated since", []anisync.Filter{anisync.FilterUpdatedSince(now)}, []int{1}, []int{2, 3, 4}},
+	{"title", []anisync.Filter{anisync.FilterTitle(regexp.MustCompile(`\bno\b`))}, []int{3, 4}, []int{1, 2}},
+	{"category", []anisync.Filter{anisync.FilterCategory(anisync.Missing)}, []int{1, 2}, []int{3, 4}},
+	{
+		"status and category",
+		[]anisync.Filter{anisync.FilterStatus(anisync.Current), anisync.FilterCategory(anisync.NeedUpdate)},
+		[]int{3},
+		[]int{1, 2, 4},
+	},
+}
+
+func TestFilterDiff(t *testing.T) {
+	for _, tt := range filterDiffTests {
+		kept, skipped := anisync.FilterDiff(filterDiff, tt.filters...)
+		if got, want := diffIDs(kept), tt.keptIDs; !reflect.DeepEqual(got, want) {
+			t.Errorf("FilterDiff %q kept %v, want %v", tt.name, got, want)
+		}
+		if got, want := diffIDs(skipped), tt.skippedIDs; !reflect.DeepEqual(got, want) {
+			t.Errorf("FilterDiff %q skipped %v, want %v", tt.name, got, want)
+		}
+		if got, want := kept.UpToDate, filterDiff.UpToDate; !reflect.DeepEqual(got, want) {
+			t.Errorf("FilterDiff %q UpToDate = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func diffIDs(diff anisync.Diff) []int {
+	var ids []int
+	for _, a := range diff.Missing {
+		ids = append(ids, a.ID)
+	}
+	for _, d := range diff.NeedUpdate {
+		ids = append(ids, d.Anime.ID)
+	}
+	return ids
+}
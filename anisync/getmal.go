@@ -51,6 +51,7 @@ func fromMALEntry(mala mal.Anime) (Anime, error) {
 		ID:              mala.SeriesAnimeDBID,
 		Title:           mala.SeriesTitle,
 		EpisodesWatched: mala.MyWatchedEpisodes,
+		Episodes:        mala.SeriesEpisodes,
 		TimesRewatched:  mala.MyRewatchingEp,
 		Image:           mala.SeriesImage,
 		Status:          FromMALStatus(mala.MyStatus),
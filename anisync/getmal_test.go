@@ -21,6 +21,7 @@ func (c *MALClientStub) MyAnimeList(username string) (*mal.AnimeList, *mal.Respo
 				mal.Anime{
 					SeriesAnimeDBID:   1,
 					SeriesTitle:       "series title",
+					SeriesEpisodes:    25,
 					MyWatchedEpisodes: 5,
 					MyStatus:          3,            // on-hold
 					MyScore:           7,            // Will become 3.5 as Rating.
@@ -97,6 +98,7 @@ func TestClient_GetMyAnimeList(t *testing.T) {
 			ID:              1,
 			Title:           "series title",
 			EpisodesWatched: 5,
+			Episodes:        25,
 			Status:          anisync.OnHold,
 			Rating:          "3.5",
 			LastUpdated:     &lastUpdated,
@@ -0,0 +1,154 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/internal/filelock"
+)
+
+// FileStore is a Store that keeps the runs in a file, one JSON object per
+// line, which is appended to as runs are added. The runs are also kept in
+// memory, and read again from the file each time a run is added so that the
+// runs added by other processes are seen too.
+//
+// The file is rewritten without the runs that the retention drops once they
+// make up a good part of it, so the file stays about as large as the history
+// that is kept. The file is locked while it is written, so several processes
+// can share it.
+type FileStore struct {
+	path      string
+	retention Retention
+
+	mu   sync.Mutex
+	runs []Run // Oldest first.
+}
+
+// OpenFileStore opens the store in the file at path, creating the file and
+// its directory if needed.
+func OpenFileStore(path string, retention Retention) (*FileStore, error) {
+	s := &FileStore{path: path, retention: retention}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	unlock, err := filelock.Lock(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s, s.load()
+}
+
+// Add implements Store.
+func (s *FileStore) Add(run Run) (Run, error) {
+	if run.ID == "" {
+		run.ID = NewRunID(run.Started)
+	}
+	b, err := json.Marshal(run)
+	if err != nil {
+		return run, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := filelock.Lock(s.path + ".lock")
+	if err != nil {
+		return run, err
+	}
+	defer unlock()
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return run, err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return run, err
+	}
+	if err := f.Close(); err != nil {
+		return run, err
+	}
+	return run, s.load()
+}
+
+// load reads the runs from the file, keeps the ones that the retention keeps
+// and compacts the file if needed. The store and the file must be locked.
+func (s *FileStore) load() error {
+	b, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var runs []Run
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(sc.Bytes(), &run); err != nil {
+			return fmt.Errorf("history %s:%d: %v", s.path, line, err)
+		}
+		runs = append(runs, run)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("history %s: %v", s.path, err)
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Started.Before(runs[j].Started) })
+	s.runs = s.retention.apply(runs, time.Now())
+	return s.compact(len(runs) - len(s.runs))
+}
+
+// compact rewrites the file with the runs of the store if at least half of
+// the file has been dropped. The store and the file must be locked.
+func (s *FileStore) compact(dropped int) error {
+	if dropped == 0 || dropped < len(s.runs) {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, run := range s.runs {
+		if err := enc.Encode(run); err != nil {
+			return err
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// List implements Store.
+func (s *FileStore) List(q Query) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runs []Run
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(runs) == q.Limit {
+			break
+		}
+		if q.Match(s.runs[i]) {
+			runs = append(runs, s.runs[i])
+		}
+	}
+	return runs, nil
+}
+
+// Get implements Store.
+func (s *FileStore) Get(id string) (Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return Run{}, ErrNotFound
+}
@@ -0,0 +1,161 @@
+// Package history keeps a record of the sync runs: which accounts were
+// synced, when, and what happened to each anime that was written.
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// ErrNotFound is returned by Store.Get for runs that are not in the store.
+var ErrNotFound = errors.New("history: run not found")
+
+// Store stores the history of the sync runs.
+type Store interface {
+	// Add records a run. A run without an ID is given one.
+	Add(run Run) (Run, error)
+	// List returns the runs that match q, newest first.
+	List(q Query) ([]Run, error)
+	// Get returns the run with id.
+	Get(id string) (Run, error)
+}
+
+// Run is the record of a sync run.
+type Run struct {
+	ID          string
+	Source      string `json:",omitempty"` // What ran the sync, e.g. cli, watch or server.
+	MALUsername string
+	Provider    string // Of the list that was synced from, e.g. kitsu, anilist or shikimori.
+	User        string // Whose list was synced from, in Provider.
+	Started     time.Time
+	Finished    time.Time
+	Counts      Counts
+	Entries     []Entry `json:",omitempty"`
+	Error       string  `json:",omitempty"` // Why the run failed as a whole, if it did.
+}
+
+// Counts are the number of writes of each outcome of a run.
+type Counts struct {
+	Adds        int
+	Updates     int
+	AddFails    int
+	UpdateFails int
+}
+
+// Entry is the outcome of writing an anime.
+type Entry struct {
+	ID     int
+	Title  string
+	Op     anisync.JournalOp
+	Fields []string `json:",omitempty"` // The fields that were updated.
+	Error  string   `json:",omitempty"`
+}
+
+// Failed reports whether the run failed as a whole or any of its writes
+// failed.
+func (r Run) Failed() bool {
+	return r.Error != "" || r.Counts.AddFails != 0 || r.Counts.UpdateFails != 0
+}
+
+// MakeRun creates the record of a run from its result, which can be nil if
+// the run failed before syncing, and its error, if any.
+// The source list is the one of user in provider.
+func MakeRun(source, malUsername, provider, user string, started time.Time, result *anisync.SyncResult, err error) Run {
+	run := Run{
+		Source:      source,
+		MALUsername: malUsername,
+		Provider:    provider,
+		User:        user,
+		Started:     started,
+		Finished:    time.Now(),
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if result == nil {
+		return run
+	}
+	run.Counts = Counts{
+		Adds:        len(result.Adds),
+		Updates:     len(result.Updates),
+		AddFails:    len(result.AddFails),
+		UpdateFails: len(result.UpdateFails),
+	}
+	for _, a := range result.Adds {
+		run.Entries = append(run.Entries, Entry{ID: a.Anime.ID, Title: a.Anime.Title, Op: anisync.JournalAdd})
+	}
+	for _, f := range result.AddFails {
+		run.Entries = append(run.Entries, Entry{ID: f.Anime.ID, Title: f.Anime.Title, Op: anisync.JournalAdd, Error: f.Reason})
+	}
+	for _, u := range result.Updates {
+		run.Entries = append(run.Entries, Entry{ID: u.Anime.ID, Title: u.Anime.Title, Op: anisync.JournalUpdate, Fields: u.Fields()})
+	}
+	for _, f := range result.UpdateFails {
+		run.Entries = append(run.Entries, Entry{ID: f.Anime.ID, Title: f.Anime.Title, Op: anisync.JournalUpdate, Fields: f.Fields(), Error: f.Reason})
+	}
+	return run
+}
+
+// NewRunID returns an ID for a run that started at t. It starts with the time
+// so that IDs sort by time, followed by random digits so that runs which start
+// at the same second get different IDs.
+func NewRunID(t time.Time) string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// Query selects runs. The zero Query selects all of them.
+type Query struct {
+	MALUsername string    // Only runs of this MyAnimeList.net account.
+	Provider    string    // Only runs from lists of this provider.
+	User        string    // Only runs from the list of this user.
+	Since       time.Time // Only runs that started at or after this time.
+	FailedOnly  bool      // Only runs for which Run.Failed is true.
+	Limit       int       // At most this many runs, the newest ones, if positive.
+}
+
+// Match reports whether q selects run, ignoring the limit.
+func (q Query) Match(run Run) bool {
+	switch {
+	case q.MALUsername != "" && !strings.EqualFold(q.MALUsername, run.MALUsername):
+		return false
+	case q.Provider != "" && q.Provider != run.Provider:
+		return false
+	case q.User != "" && !strings.EqualFold(q.User, run.User):
+		return false
+	case !q.Since.IsZero() && run.Started.Before(q.Since):
+		return false
+	case q.FailedOnly && !run.Failed():
+		return false
+	}
+	return true
+}
+
+// Retention limits how much history is kept. The zero Retention keeps
+// everything.
+type Retention struct {
+	MaxRuns int           // Keep at most this many runs, the newest ones, if positive.
+	MaxAge  time.Duration // Drop runs that started longer ago than this, if positive.
+}
+
+// apply returns the runs, oldest first, that the retention keeps at now.
+func (r Retention) apply(runs []Run, now time.Time) []Run {
+	if r.MaxAge > 0 {
+		cutoff := now.Add(-r.MaxAge)
+		i := 0
+		for i < len(runs) && runs[i].Started.Before(cutoff) {
+			i++
+		}
+		runs = runs[i:]
+	}
+	if r.MaxRuns > 0 && len(runs) > r.MaxRuns {
+		runs = runs[len(runs)-r.MaxRuns:]
+	}
+	return runs
+}
@@ -0,0 +1,178 @@
+package history_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/history"
+)
+
+func TestMakeRun(t *testing.T) {
+	result := &anisync.SyncResult{
+		Adds:     []anisync.AddSuccess{{Anime: anisync.Anime{ID: 1, Title: "Anime1"}}},
+		AddFails: []anisync.AddFail{anisync.MakeAddFail(anisync.Anime{ID: 2, Title: "Anime2"}, errors.New("add failed"))},
+		Updates: []anisync.UpdateSuccess{{AniDiff: anisync.AniDiff{
+			Anime:  anisync.Anime{ID: 3, Title: "Anime3"},
+			Rating: &anisync.RatingDiff{Got: "3.0", Want: "4.0"},
+		}}},
+	}
+	run := history.MakeRun("cli", "TestUser", anisync.ProviderShikimori, "fan", time.Now(), result, nil)
+	want := history.Counts{Adds: 1, AddFails: 1, Updates: 1}
+	if run.Counts != want {
+		t.Errorf("MakeRun counts = %+v, want %+v", run.Counts, want)
+	}
+	wantEntries := []history.Entry{
+		{ID: 1, Title: "Anime1", Op: anisync.JournalAdd},
+		{ID: 2, Title: "Anime2", Op: anisync.JournalAdd, Error: "add failed"},
+		{ID: 3, Title: "Anime3", Op: anisync.JournalUpdate, Fields: []string{anisync.FieldRating}},
+	}
+	if !reflect.DeepEqual(run.Entries, wantEntries) {
+		t.Errorf("MakeRun entries = %+v, want %+v", run.Entries, wantEntries)
+	}
+	if run.Provider != anisync.ProviderShikimori || run.User != "fan" {
+		t.Errorf("MakeRun source list = %s %q, want shikimori %q", run.Provider, run.User, "fan")
+	}
+	if !run.Failed() {
+		t.Error("run with a failed add expected to be failed")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "runs.jsonl")
+	s, err := history.OpenFileStore(path, history.Retention{})
+	if err != nil {
+		t.Fatal("OpenFileStore returned err:", err)
+	}
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	var ids []string
+	for i, user := range []string{"UserA", "UserB", "UserA"} {
+		run, err := s.Add(history.Run{MALUsername: user, Provider: anisync.ProviderKitsu, User: "42", Started: start.Add(time.Duration(i) * time.Hour)})
+		if err != nil {
+			t.Fatal("Add returned err:", err)
+		}
+		ids = append(ids, run.ID)
+	}
+	if ids[0] == "" || ids[0] == ids[1] {
+		t.Fatalf("Add gave IDs %q, want unique ones", ids)
+	}
+
+	// Reopening reads the runs back from the file.
+	s, err = history.OpenFileStore(path, history.Retention{})
+	if err != nil {
+		t.Fatal("OpenFileStore returned err:", err)
+	}
+	runs, err := s.List(history.Query{MALUsername: "UserA"})
+	if err != nil {
+		t.Fatal("List returned err:", err)
+	}
+	if len(runs) != 2 || runs[0].ID != ids[2] || runs[1].ID != ids[0] {
+		t.Errorf("List of UserA got %v, want runs %s and %s, newest first", runs, ids[2], ids[0])
+	}
+	if runs, _ := s.List(history.Query{Limit: 1}); len(runs) != 1 || runs[0].ID != ids[2] {
+		t.Errorf("List with limit 1 got %v, want run %s", runs, ids[2])
+	}
+	if runs, _ := s.List(history.Query{Since: start.Add(90 * time.Minute)}); len(runs) != 1 {
+		t.Errorf("List since got %d runs, want 1", len(runs))
+	}
+	if run, err := s.Get(ids[1]); err != nil || run.MALUsername != "UserB" {
+		t.Errorf("Get(%q) = %v, %v, want the run of UserB", ids[1], run, err)
+	}
+	if _, err := s.Get("missing"); err != history.ErrNotFound {
+		t.Errorf("Get of missing run returned err %v, want ErrNotFound", err)
+	}
+	if runs, _ := s.List(history.Query{Provider: anisync.ProviderKitsu, User: "42"}); len(runs) != 3 {
+		t.Errorf("List of Kitsu.io user 42 got %d runs, want 3", len(runs))
+	}
+	if runs, _ := s.List(history.Query{Provider: anisync.ProviderShikimori}); len(runs) != 0 {
+		t.Errorf("List of Shikimori runs got %d runs, want 0", len(runs))
+	}
+}
+
+func TestFileStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	s, err := history.OpenFileStore(path, history.Retention{MaxRuns: 2, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal("OpenFileStore returned err:", err)
+	}
+	now := time.Now()
+	for _, started := range []time.Time{now.Add(-48 * time.Hour), now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now.Add(-time.Hour)} {
+		if _, err := s.Add(history.Run{MALUsername: "TestUser", Started: started}); err != nil {
+			t.Fatal("Add returned err:", err)
+		}
+	}
+	runs, _ := s.List(history.Query{})
+	if len(runs) != 2 || !runs[0].Started.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("after retention got %d runs, want the newest 2", len(runs))
+	}
+
+	// The dropped runs are eventually removed from the file too.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(b, []byte("\n")); lines > 3 {
+		t.Errorf("history file has %d lines, want the file to be compacted", lines)
+	}
+}
+
+func TestFileStoreShared(t *testing.T) {
+	// Stores opened on the same file, as by several processes, see the runs
+	// of each other and do not drop them when they compact the file.
+	path := filepath.Join(t.TempDir(), "runs.jsonl")
+	retention := history.Retention{MaxRuns: 4}
+	a, err := history.OpenFileStore(path, retention)
+	if err != nil {
+		t.Fatal("OpenFileStore returned err:", err)
+	}
+	b, err := history.OpenFileStore(path, retention)
+	if err != nil {
+		t.Fatal("OpenFileStore returned err:", err)
+	}
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 8; i++ {
+		s := a
+		if i%2 == 1 {
+			s = b
+		}
+		if _, err := s.Add(history.Run{MALUsername: "TestUser", Started: start.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatal("Add returned err:", err)
+		}
+	}
+	runs, _ := b.List(history.Query{})
+	if len(runs) != 4 || !runs[0].Started.Equal(start.Add(7*time.Hour)) || !runs[3].Started.Equal(start.Add(4*time.Hour)) {
+		t.Errorf("store b has %d runs %v, want the newest 4 of both stores", len(runs), runs)
+	}
+	s, err := history.OpenFileStore(path, history.Retention{})
+	if err != nil {
+		t.Fatal("OpenFileStore returned err:", err)
+	}
+	if runs, _ := s.List(history.Query{}); len(runs) < 4 || !runs[0].Started.Equal(start.Add(7*time.Hour)) {
+		t.Errorf("file has %d runs, want at least the newest 4", len(runs))
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	run := history.Run{MALUsername: "TestUser", Provider: anisync.ProviderShikimori, User: "Fan"}
+	tests := []struct {
+		q    history.Query
+		want bool
+	}{
+		{history.Query{}, true},
+		{history.Query{MALUsername: "testuser"}, true},
+		{history.Query{MALUsername: "OtherUser"}, false},
+		{history.Query{Provider: anisync.ProviderShikimori, User: "fan"}, true},
+		{history.Query{Provider: anisync.ProviderKitsu}, false},
+		{history.Query{FailedOnly: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.q.Match(run); got != tt.want {
+			t.Errorf("%+v.Match = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
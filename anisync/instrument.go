@@ -0,0 +1,145 @@
+package anisync
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/metrics"
+	"github.com/nstratos/go-hummingbird/hb"
+	"github.com/nstratos/go-kitsu/kitsu"
+	"github.com/nstratos/go-myanimelist/mal"
+)
+
+// The providers of the anime lists. They name the source lists in the
+// journals and the sync history, and are the label values of the upstream
+// metrics.
+const (
+	ProviderMAL       = "myanimelist"
+	ProviderHB        = "hummingbird"
+	ProviderKitsu     = "kitsu"
+	ProviderAniList   = "anilist"
+	ProviderShikimori = "shikimori"
+
+	// ProviderFile is a list file rather than an account. The user of a
+	// list file is its path.
+	ProviderFile = "file"
+)
+
+// InstrumentResources returns Resources that call r and record the number and
+// latency of the calls to each provider and operation in reg, as the metrics
+// anisync_upstream_requests_total and
+// anisync_upstream_request_duration_seconds.
+func InstrumentResources(r Resources, reg *metrics.Registry) Resources {
+	return &instrumentedResources{r: r, upstreamMetrics: newUpstreamMetrics(reg)}
+}
+
+// InstrumentTransport returns a RoundTripper that makes the requests with
+// next, or http.DefaultTransport if nil, and records them in reg in the same
+// metrics as InstrumentResources, under provider and op. It is meant for the
+// API clients that are not part of Resources. Requests that fail or get an
+// error status count as errors.
+func InstrumentTransport(next http.RoundTripper, provider, op string, reg *metrics.Registry) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedTransport{next: next, provider: provider, op: op, upstreamMetrics: newUpstreamMetrics(reg)}
+}
+
+// upstreamMetrics are the metrics of the calls to the providers.
+type upstreamMetrics struct {
+	calls   *metrics.CounterVec
+	latency *metrics.HistogramVec
+}
+
+func newUpstreamMetrics(reg *metrics.Registry) upstreamMetrics {
+	return upstreamMetrics{
+		calls: reg.Counter("anisync_upstream_requests_total",
+			"Calls to the MyAnimeList.net, Hummingbird.me, Kitsu.io and Shikimori.one APIs by result.",
+			"provider", "operation", "result"),
+		latency: reg.Histogram("anisync_upstream_request_duration_seconds",
+			"Latency of the calls to the MyAnimeList.net, Hummingbird.me, Kitsu.io and Shikimori.one APIs.",
+			nil, "provider", "operation"),
+	}
+}
+
+func (m upstreamMetrics) observe(provider, op string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.calls.Inc(provider, op, result)
+	m.latency.Observe(time.Since(start).Seconds(), provider, op)
+}
+
+type instrumentedTransport struct {
+	next     http.RoundTripper
+	provider string
+	op       string
+	upstreamMetrics
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	failed := err
+	if err == nil && resp.StatusCode >= 400 {
+		failed = errors.New(resp.Status)
+	}
+	t.observe(t.provider, t.op, start, failed)
+	return resp, err
+}
+
+type instrumentedResources struct {
+	r Resources
+	upstreamMetrics
+}
+
+func (ir *instrumentedResources) VerifyCredentials(username, password string) (*mal.User, *mal.Response, error) {
+	start := time.Now()
+	u, resp, err := ir.r.VerifyCredentials(username, password)
+	ir.observe(ProviderMAL, "verify_credentials", start, err)
+	return u, resp, err
+}
+
+func (ir *instrumentedResources) MyAnimeList(username string) (*mal.AnimeList, *mal.Response, error) {
+	start := time.Now()
+	list, resp, err := ir.r.MyAnimeList(username)
+	ir.observe(ProviderMAL, "anime_list", start, err)
+	return list, resp, err
+}
+
+func (ir *instrumentedResources) UpdateMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Response, error) {
+	start := time.Now()
+	resp, err := ir.r.UpdateMALAnimeEntry(id, entry)
+	ir.observe(ProviderMAL, "update_entry", start, err)
+	return resp, err
+}
+
+func (ir *instrumentedResources) AddMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Response, error) {
+	start := time.Now()
+	resp, err := ir.r.AddMALAnimeEntry(id, entry)
+	ir.observe(ProviderMAL, "add_entry", start, err)
+	return resp, err
+}
+
+func (ir *instrumentedResources) DeleteMALAnimeEntry(id int) (*mal.Response, error) {
+	start := time.Now()
+	resp, err := ir.r.DeleteMALAnimeEntry(id)
+	ir.observe(ProviderMAL, "delete_entry", start, err)
+	return resp, err
+}
+
+func (ir *instrumentedResources) HBAnimeList(username string) ([]hb.LibraryEntry, *http.Response, error) {
+	start := time.Now()
+	list, resp, err := ir.r.HBAnimeList(username)
+	ir.observe(ProviderHB, "anime_list", start, err)
+	return list, resp, err
+}
+
+func (ir *instrumentedResources) KitsuAnimeList(userID string) ([]*kitsu.LibraryEntry, *kitsu.Response, error) {
+	start := time.Now()
+	list, resp, err := ir.r.KitsuAnimeList(userID)
+	ir.observe(ProviderKitsu, "anime_list", start, err)
+	return list, resp, err
+}
@@ -0,0 +1,77 @@
+package anisync_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/metrics"
+
+	"github.com/nstratos/go-hummingbird/hb"
+	"github.com/nstratos/go-kitsu/kitsu"
+	"github.com/nstratos/go-myanimelist/mal"
+)
+
+func TestInstrumentResources(t *testing.T) {
+	reg := metrics.NewRegistry()
+	resources := InstrumentResources(struct {
+		*MALClientStub
+		*HBClientStub
+		*KitsuClientStub
+	}{
+		NewMALClientStub(mal.NewClient()),
+		NewHBClientStub(hb.NewClient(nil)),
+		NewKitsuClientStub(kitsu.NewClient(nil)),
+	}, reg)
+	c := NewClient(resources)
+
+	if _, _, err := c.GetMyAnimeList("TestUser"); err != nil {
+		t.Fatal("GetMyAnimeList returned err:", err)
+	}
+	c.GetMyAnimeList("InvalidTestUser")
+
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	for _, want := range []string{
+		`anisync_upstream_requests_total{provider="myanimelist",operation="anime_list",result="ok"} 1`,
+		`anisync_upstream_requests_total{provider="myanimelist",operation="anime_list",result="error"} 1`,
+		`anisync_upstream_request_duration_seconds_count{provider="myanimelist",operation="anime_list"} 2`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestInstrumentTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	reg := metrics.NewRegistry()
+	c := &http.Client{Transport: InstrumentTransport(nil, ProviderShikimori, "anime_list", reg)}
+	for _, path := range []string{"/", "/missing"} {
+		resp, err := c.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal("Get returned err:", err)
+		}
+		resp.Body.Close()
+	}
+
+	var buf bytes.Buffer
+	reg.WriteTo(&buf)
+	for _, want := range []string{
+		`anisync_upstream_requests_total{provider="shikimori",operation="anime_list",result="ok"} 1`,
+		`anisync_upstream_requests_total{provider="shikimori",operation="anime_list",result="error"} 1`,
+		`anisync_upstream_request_duration_seconds_count{provider="shikimori",operation="anime_list"} 2`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
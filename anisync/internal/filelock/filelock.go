@@ -0,0 +1,27 @@
+// Package filelock locks files across processes, so that several processes
+// can share the files of anisync.
+package filelock
+
+import "os"
+
+// Lock opens the lock file at path, creating it if needed, and waits until it
+// holds an exclusive lock on it. The lock is released by calling the returned function.
+//
+// The lock is advisory: it only keeps out the processes that also take it.
+func Lock(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		err := unlock(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
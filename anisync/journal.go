@@ -0,0 +1,128 @@
+package anisync
+
+import (
+	"errors"
+	"time"
+)
+
+// Journal is a record of the writes that a sync made to a MyAnimeList.net
+// account. Along with each write, it keeps the state that the entry had
+// before the sync so that the sync can later be reverted with Client.Revert.
+type Journal struct {
+	RunID       string
+	MALUsername string
+	Provider    string // Of the list that was synced from, e.g. kitsu.
+	User        string // Whose list was synced from, in Provider.
+	Time        time.Time
+	Entries     []JournalEntry
+	RevertedAt  *time.Time `json:",omitempty"`
+}
+
+// JournalOp is the kind of write that was made to an entry.
+type JournalOp string
+
+// The kinds of writes that are recorded in a Journal.
+const (
+	JournalAdd    JournalOp = "add"
+	JournalUpdate JournalOp = "update"
+)
+
+// JournalEntry is a single write recorded in a Journal. Before is the state of
+// the entry on MyAnimeList.net before the write and it is nil for entries that
+// were newly added. After is the anime that was written.
+type JournalEntry struct {
+	Op       JournalOp
+	Before   *Anime `json:",omitempty"`
+	After    Anime
+	Reverted bool `json:",omitempty"` // Whether the write has been reverted.
+}
+
+// MakeJournal creates the journal of a sync using the result of the sync and
+// the diff that was synced. The state of the entries before the sync is taken
+// from the left list of diff. Only the successful writes are recorded. The
+// source list of the sync is the one of user in provider.
+func MakeJournal(runID, malUsername, provider, user string, diff Diff, result *SyncResult) Journal {
+	j := Journal{RunID: runID, MALUsername: malUsername, Provider: provider, User: user, Time: time.Now()}
+	for _, a := range result.Adds {
+		j.Entries = append(j.Entries, JournalEntry{Op: JournalAdd, After: a.Anime})
+	}
+	for _, u := range result.Updates {
+		e := JournalEntry{Op: JournalUpdate, After: u.Anime}
+		if before := FindByID(diff.Left, u.Anime.ID); before != nil {
+			b := *before
+			e.Before = &b
+		}
+		j.Entries = append(j.Entries, e)
+	}
+	return j
+}
+
+// IDs returns the IDs of the anime written by the sync.
+func (j Journal) IDs() []int {
+	ids := make([]int, 0, len(j.Entries))
+	for _, e := range j.Entries {
+		ids = append(ids, e.After.ID)
+	}
+	return ids
+}
+
+// RevertResult is the result of reverting a Journal.
+type RevertResult struct {
+	Restored []Anime
+	Deleted  []Anime
+	Fails    []RevertFail
+}
+
+type RevertFail struct {
+	JournalEntry
+	Error  error
+	Reason string
+}
+
+func MakeRevertFail(e JournalEntry, err error) RevertFail {
+	return RevertFail{JournalEntry: e, Error: err, Reason: err.Error()}
+}
+
+// Revert undoes the writes recorded in j. The entries that were updated are
+// restored to their state before the sync and the entries that were added are
+// deleted. Entries are reverted in the reverse order that they were written.
+//
+// The entries that are reverted are marked as Reverted in j and are skipped if
+// j is reverted again, so that a revert that partly failed can be retried.
+// Once every entry is reverted, RevertedAt is set.
+//
+// Note that the MyAnimeList.net API does not return the comments of the
+// entries so restored entries end up without comments.
+func (c *Client) Revert(j *Journal) *RevertResult {
+	res := &RevertResult{}
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		e := &j.Entries[i]
+		switch {
+		case e.Reverted:
+			continue
+		case e.Op == JournalAdd:
+			if err := c.DeleteMALAnime(e.After.ID); err != nil {
+				res.Fails = append(res.Fails, MakeRevertFail(*e, err))
+				continue
+			}
+			res.Deleted = append(res.Deleted, e.After)
+		case e.Op == JournalUpdate && e.Before != nil:
+			if err := c.UpdateMALAnime(*e.Before); err != nil {
+				res.Fails = append(res.Fails, MakeRevertFail(*e, err))
+				continue
+			}
+			res.Restored = append(res.Restored, *e.Before)
+		default:
+			res.Fails = append(res.Fails, MakeRevertFail(*e, errNothingToRevert))
+			continue
+		}
+		e.Reverted = true
+	}
+	if len(res.Fails) == 0 {
+		now := time.Now()
+		j.RevertedAt = &now
+	}
+	return res
+}
+
+var errNothingToRevert = errors.New("no previous state recorded")
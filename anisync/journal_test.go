@@ -0,0 +1,92 @@
+package anisync_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+func TestMakeJournal(t *testing.T) {
+	before := anisync.Anime{ID: notFoundAnimeID, Title: "Anime2", Status: anisync.Current, EpisodesWatched: 2}
+	after := anisync.Anime{ID: notFoundAnimeID, Title: "Anime2", Status: anisync.Completed, EpisodesWatched: 12}
+	added := anisync.Anime{ID: validAnimeID, Title: "Anime1", Status: anisync.Planned}
+	diff := anisync.Diff{Left: []anisync.Anime{before}}
+	result := &anisync.SyncResult{
+		Adds:    []anisync.AddSuccess{{Anime: added}},
+		Updates: []anisync.UpdateSuccess{{AniDiff: anisync.AniDiff{Anime: after}}},
+	}
+
+	j := anisync.MakeJournal("run1", "TestUser", anisync.ProviderKitsu, "42", diff, result)
+
+	if got, want := j.RunID, "run1"; got != want {
+		t.Errorf("MakeJournal RunID = %q, want %q", got, want)
+	}
+	if got, want := j.MALUsername, "TestUser"; got != want {
+		t.Errorf("MakeJournal MALUsername = %q, want %q", got, want)
+	}
+	if j.Provider != anisync.ProviderKitsu || j.User != "42" {
+		t.Errorf("MakeJournal source list = %s %q, want %s %q", j.Provider, j.User, anisync.ProviderKitsu, "42")
+	}
+	want := []anisync.JournalEntry{
+		{Op: anisync.JournalAdd, After: added},
+		{Op: anisync.JournalUpdate, Before: &before, After: after},
+	}
+	if got := j.Entries; !reflect.DeepEqual(got, want) {
+		t.Errorf("MakeJournal entries = \n%+v, want \n%+v", got, want)
+	}
+}
+
+func TestClient_Revert(t *testing.T) {
+	restored := anisync.Anime{ID: validAnimeID, Title: "Anime1", Status: anisync.Current}
+	deleted := anisync.Anime{ID: validAnimeID, Title: "Anime1", Status: anisync.Planned}
+	failed := anisync.Anime{ID: notFoundAnimeID, Title: "Anime2", Status: anisync.Planned}
+	j := anisync.Journal{
+		Entries: []anisync.JournalEntry{
+			{Op: anisync.JournalAdd, After: deleted},
+			{Op: anisync.JournalAdd, After: failed},
+			{Op: anisync.JournalUpdate, Before: &restored, After: anisync.Anime{ID: validAnimeID, Status: anisync.Completed}},
+			{Op: anisync.JournalUpdate, After: anisync.Anime{ID: validAnimeID}},
+		},
+	}
+
+	res := client.Revert(&j)
+
+	if got, want := res.Restored, []anisync.Anime{restored}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Revert restored %+v, want %+v", got, want)
+	}
+	if got, want := res.Deleted, []anisync.Anime{deleted}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Revert deleted %+v, want %+v", got, want)
+	}
+	if got, want := len(res.Fails), 2; got != want {
+		t.Fatalf("Revert returned %d fails, want %d", got, want)
+	}
+	// Entries are reverted in reverse order.
+	if got, want := res.Fails[0].Op, anisync.JournalUpdate; got != want {
+		t.Errorf("Revert first fail op = %q, want %q", got, want)
+	}
+	if got, want := res.Fails[1].Reason, "anime not found"; got != want {
+		t.Errorf("Revert second fail reason = %q, want %q", got, want)
+	}
+	var reverted []bool
+	for _, e := range j.Entries {
+		reverted = append(reverted, e.Reverted)
+	}
+	if want := []bool{true, false, true, false}; !reflect.DeepEqual(reverted, want) {
+		t.Errorf("Revert marked entries reverted %v, want %v", reverted, want)
+	}
+	if j.RevertedAt != nil {
+		t.Error("Revert with fails set RevertedAt")
+	}
+
+	// Reverting again only retries the entries that failed.
+	j.Entries[1].After.ID = validAnimeID
+	j.Entries[3].Before = &restored
+	res = client.Revert(&j)
+	if len(res.Fails) != 0 || len(res.Deleted) != 1 || len(res.Restored) != 1 {
+		t.Errorf("Revert again = %+v, want 1 deleted and 1 restored", res)
+	}
+	if j.RevertedAt == nil {
+		t.Error("Revert of all entries did not set RevertedAt")
+	}
+}
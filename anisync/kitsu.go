@@ -21,12 +21,30 @@ func NewKitsuClient(client *kitsu.Client) *KitsuClient {
 	return &KitsuClient{client: client}
 }
 
+// kitsuPageLimit is the number of library entries requested per page, the
+// most that Kitsu.io allows.
+const kitsuPageLimit = 500
+
+// KitsuAnimeList returns the library entries of a user, following the pages
+// until the last one. The response is the one of the last page.
 func (c *KitsuClient) KitsuAnimeList(userID string) ([]*kitsu.LibraryEntry, *kitsu.Response, error) {
-	return c.client.Library.List(
-		kitsu.Include("anime"),
-		kitsu.Include("anime.mappings"),
-		kitsu.Filter("userId", userID),
-	)
+	var all []*kitsu.LibraryEntry
+	offset := 0
+	for {
+		entries, resp, err := c.client.Library.List(
+			kitsu.Include("anime", "anime.mappings"),
+			kitsu.Filter("userId", userID),
+			kitsu.Pagination(kitsuPageLimit, offset),
+		)
+		if err != nil {
+			return nil, resp, err
+		}
+		all = append(all, entries...)
+		if resp.Offset.Next <= offset || len(entries) == 0 {
+			return all, resp, nil
+		}
+		offset = resp.Offset.Next
+	}
 }
 
 func (c *Client) GetKitsuAnimeList(username string) ([]Anime, *kitsu.Response, error) {
@@ -62,6 +80,7 @@ func fromKitsuEntry(e *kitsu.LibraryEntry) (*Anime, error) {
 	a.LastUpdated = &updatedAt
 	if e.Anime != nil {
 		a.Title = e.Anime.CanonicalTitle
+		a.Episodes = e.Anime.EpisodeCount
 		imgURL, ok := e.Anime.PosterImage["tiny"]
 		if ok {
 			s, ok := imgURL.(string)
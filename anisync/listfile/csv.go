@@ -0,0 +1,145 @@
+package listfile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// csvHeader is the header of the CSV files. When reading, the columns may be
+// in any order and only id and status are required.
+var csvHeader = []string{
+	"id", "title", "status", "episodes_watched", "episodes", "rating",
+	"times_rewatched", "rewatching", "last_updated", "notes", "image",
+}
+
+func encodeCSV(w io.Writer, l List) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, a := range l.Anime {
+		lastUpdated := ""
+		if a.LastUpdated != nil {
+			lastUpdated = a.LastUpdated.UTC().Format(time.RFC3339)
+		}
+		err := cw.Write([]string{
+			strconv.Itoa(a.ID),
+			a.Title,
+			statusName(a.Status),
+			strconv.Itoa(a.EpisodesWatched),
+			strconv.Itoa(a.Episodes),
+			a.Rating,
+			strconv.Itoa(a.TimesRewatched),
+			strconv.FormatBool(a.Rewatching),
+			lastUpdated,
+			a.Notes,
+			a.Image,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func decodeCSV(r io.Reader) (List, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return List{}, errors.New("listfile: empty CSV file")
+	}
+	if err != nil {
+		return List{}, fmt.Errorf("listfile: %v", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[name] = i
+	}
+	for _, name := range []string{"id", "status"} {
+		if _, ok := cols[name]; !ok {
+			return List{}, fmt.Errorf("listfile: CSV header has no %s column", name)
+		}
+	}
+
+	var l List
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return l, nil
+		}
+		if err != nil {
+			return List{}, fmt.Errorf("listfile: %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+		a, err := csvAnime(rec, cols)
+		if err != nil {
+			return List{}, fmt.Errorf("listfile: line %d: %v", line, err)
+		}
+		l.Anime = append(l.Anime, a)
+	}
+}
+
+// csvAnime parses a record of a CSV file whose columns are at cols.
+func csvAnime(rec []string, cols map[string]int) (anisync.Anime, error) {
+	field := func(name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return rec[i]
+		}
+		return ""
+	}
+	number := func(name string) (int, error) {
+		v := field(name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", name, v)
+		}
+		return n, nil
+	}
+
+	var (
+		a   = anisync.Anime{Title: field("title"), Rating: field("rating"), Notes: field("notes"), Image: field("image")}
+		err error
+	)
+	if a.ID, err = number("id"); err != nil {
+		return a, err
+	}
+	if a.ID == 0 {
+		return a, errors.New("missing id")
+	}
+	if a.Status, err = parseStatusName(field("status")); err != nil {
+		return a, err
+	}
+	if a.EpisodesWatched, err = number("episodes_watched"); err != nil {
+		return a, err
+	}
+	if a.Episodes, err = number("episodes"); err != nil {
+		return a, err
+	}
+	if a.TimesRewatched, err = number("times_rewatched"); err != nil {
+		return a, err
+	}
+	if v := field("rewatching"); v != "" {
+		if a.Rewatching, err = strconv.ParseBool(v); err != nil {
+			return a, fmt.Errorf("invalid rewatching %q", v)
+		}
+	}
+	if v := field("last_updated"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return a, fmt.Errorf("invalid last_updated %q", v)
+		}
+		a.LastUpdated = &t
+	}
+	return a, nil
+}
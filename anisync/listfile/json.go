@@ -0,0 +1,90 @@
+package listfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// snapshotVersion is the version of the JSON snapshot format.
+const snapshotVersion = 1
+
+// snapshot is the JSON snapshot format.
+type snapshot struct {
+	Version  int
+	Provider string    `json:",omitempty"`
+	User     string    `json:",omitempty"`
+	Taken    time.Time `json:",omitempty"`
+	Anime    []snapshotAnime
+}
+
+// snapshotAnime is anisync.Anime with the status by name.
+type snapshotAnime struct {
+	ID              int
+	Title           string
+	Status          string
+	EpisodesWatched int
+	Episodes        int        `json:",omitempty"`
+	Rating          string     `json:",omitempty"`
+	TimesRewatched  int        `json:",omitempty"`
+	Rewatching      bool       `json:",omitempty"`
+	LastUpdated     *time.Time `json:",omitempty"`
+	Notes           string     `json:",omitempty"`
+	Image           string     `json:",omitempty"`
+}
+
+func encodeJSON(w io.Writer, l List) error {
+	s := snapshot{Version: snapshotVersion, Provider: l.Provider, User: l.User, Taken: l.Taken, Anime: []snapshotAnime{}}
+	for _, a := range l.Anime {
+		s.Anime = append(s.Anime, snapshotAnime{
+			ID:              a.ID,
+			Title:           a.Title,
+			Status:          statusName(a.Status),
+			EpisodesWatched: a.EpisodesWatched,
+			Episodes:        a.Episodes,
+			Rating:          a.Rating,
+			TimesRewatched:  a.TimesRewatched,
+			Rewatching:      a.Rewatching,
+			LastUpdated:     a.LastUpdated,
+			Notes:           a.Notes,
+			Image:           a.Image,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(s)
+}
+
+func decodeJSON(r io.Reader) (List, error) {
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return List{}, fmt.Errorf("listfile: %v", err)
+	}
+	if s.Version != snapshotVersion {
+		return List{}, fmt.Errorf("listfile: unsupported snapshot version %d", s.Version)
+	}
+	l := List{Provider: s.Provider, User: s.User, Taken: s.Taken}
+	for i, sa := range s.Anime {
+		status, err := parseStatusName(sa.Status)
+		if err != nil {
+			return List{}, fmt.Errorf("listfile: anime %d (ID %d): %v", i+1, sa.ID, err)
+		}
+		l.Anime = append(l.Anime, anisync.Anime{
+			ID:              sa.ID,
+			Title:           sa.Title,
+			Status:          status,
+			EpisodesWatched: sa.EpisodesWatched,
+			Episodes:        sa.Episodes,
+			Rating:          sa.Rating,
+			TimesRewatched:  sa.TimesRewatched,
+			Rewatching:      sa.Rewatching,
+			LastUpdated:     sa.LastUpdated,
+			Notes:           sa.Notes,
+			Image:           sa.Image,
+		})
+	}
+	return l, nil
+}
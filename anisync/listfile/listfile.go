@@ -0,0 +1,172 @@
+// Package listfile reads and writes anime lists as files, so that lists can
+// be compared without network access: on flights, in tests, or to see what a
+// sync would do before touching real accounts.
+//
+// There are three formats, chosen by the extension of the file name: the
+// JSON snapshots of anisync (.json), which keep every field and where the list
+// came from, CSV (.csv), which is easy to edit in a spreadsheet, and the XML
+// list files of MyAnimeList.net (.xml). Files whose name also ends in .gz are
+// gzipped.
+package listfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/malxml"
+)
+
+// List is an anime list and where it came from.
+type List struct {
+	Provider string    // Where the list came from, e.g. kitsu or myanimelist.
+	User     string    // The account of the list on the provider.
+	Taken    time.Time // When the list was fetched.
+	Anime    []anisync.Anime
+}
+
+// Format is the format of a list file.
+type Format string
+
+// The formats.
+const (
+	JSON Format = "json"
+	CSV  Format = "csv"
+	XML  Format = "xml"
+)
+
+// ParseFormat parses the name of a format.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case JSON, CSV, XML:
+		return f, nil
+	}
+	return "", fmt.Errorf("listfile: unknown format %q, want json, csv or xml", name)
+}
+
+// FormatOf returns the format of a file from the extension of its name,
+// ignoring .gz.
+func FormatOf(path string) (Format, error) {
+	ext := filepath.Ext(strings.TrimSuffix(path, ".gz"))
+	if ext == "" {
+		return "", fmt.Errorf("listfile: %s has no extension to tell its format", path)
+	}
+	return ParseFormat(ext[1:])
+}
+
+// Encode writes the list in a format.
+func Encode(w io.Writer, format Format, l List) error {
+	switch format {
+	case JSON:
+		return encodeJSON(w, l)
+	case CSV:
+		return encodeCSV(w, l)
+	case XML:
+		return malxml.Encode(w, malxml.MakeFile(l.User, l.Anime))
+	}
+	return fmt.Errorf("listfile: unknown format %q", format)
+}
+
+// Decode reads a list in a format, gunzipping it if it is gzipped.
+func Decode(r io.Reader, format Format) (List, error) {
+	br := bufio.NewReader(r)
+	r = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return List{}, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	switch format {
+	case JSON:
+		return decodeJSON(r)
+	case CSV:
+		return decodeCSV(r)
+	case XML:
+		f, err := malxml.Decode(r)
+		if err != nil {
+			return List{}, err
+		}
+		anime, err := f.List()
+		return List{Provider: anisync.ProviderMAL, User: f.MyInfo.UserName, Anime: anime}, err
+	}
+	return List{}, fmt.Errorf("listfile: unknown format %q", format)
+}
+
+// Read reads the list file at path.
+func Read(path string) (List, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return List{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return List{}, err
+	}
+	defer f.Close()
+	l, err := Decode(f, format)
+	if err != nil {
+		return l, fmt.Errorf("%s: %v", path, err)
+	}
+	return l, nil
+}
+
+// Write writes the list to the file at path, in the format of its extension
+// and gzipped if it ends in .gz. The file is replaced at once so that a crash
+// never leaves half a file.
+func Write(path string, l List) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if strings.HasSuffix(path, ".gz") {
+		zw := gzip.NewWriter(&buf)
+		zw.Name = strings.TrimSuffix(filepath.Base(path), ".gz")
+		if err := Encode(zw, format, l); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	} else if err := Encode(&buf, format, l); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// statusNames are the names of the statuses in the JSON and CSV files.
+var statusNames = map[anisync.Status]string{
+	anisync.Current:   "current",
+	anisync.Planned:   "planned",
+	anisync.Completed: "completed",
+	anisync.OnHold:    "onhold",
+	anisync.Dropped:   "dropped",
+}
+
+func statusName(s anisync.Status) string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func parseStatusName(name string) (anisync.Status, error) {
+	if name == "" || name == "unknown" {
+		return anisync.Unknown, nil
+	}
+	return anisync.ParseStatus(name)
+}
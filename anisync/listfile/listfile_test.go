@@ -0,0 +1,117 @@
+package listfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/listfile"
+)
+
+func testList() listfile.List {
+	updated := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	return listfile.List{
+		Provider: anisync.ProviderKitsu,
+		User:     "fan",
+		Taken:    time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		Anime: []anisync.Anime{
+			{ID: 1, Title: "Cowboy Bebop", Status: anisync.Completed, EpisodesWatched: 26, Episodes: 26, Rating: "4.5", TimesRewatched: 1, LastUpdated: &updated, Notes: "See you, space cowboy, \"again\"\nand again"},
+			{ID: 5, Title: "Cowboy Bebop: Tengoku no Tobira", Status: anisync.Planned, Episodes: 1},
+			{ID: 6, Title: "Trigun", Status: anisync.Current, EpisodesWatched: 3, Rewatching: true},
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"list.json", "list.csv", "list.json.gz", "list.csv.gz"} {
+		t.Run(name, func(t *testing.T) {
+			want := testList()
+			path := filepath.Join(dir, name)
+			if err := listfile.Write(path, want); err != nil {
+				t.Fatalf("Write(%q) returned err: %v", name, err)
+			}
+			got, err := listfile.Read(path)
+			if err != nil {
+				t.Fatalf("Read(%q) returned err: %v", name, err)
+			}
+			if strings.HasPrefix(name, "list.csv") {
+				// CSV files keep only the anime.
+				want = listfile.List{Anime: want.Anime}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Read(%q) = \n%+v, want \n%+v", name, got, want)
+			}
+		})
+	}
+}
+
+func TestWriteReadXML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.xml")
+	if err := listfile.Write(path, testList()); err != nil {
+		t.Fatalf("Write returned err: %v", err)
+	}
+	got, err := listfile.Read(path)
+	if err != nil {
+		t.Fatalf("Read returned err: %v", err)
+	}
+	if got.Provider != anisync.ProviderMAL || got.User != "fan" {
+		t.Errorf("Read provider, user = %q, %q, want %q, %q", got.Provider, got.User, anisync.ProviderMAL, "fan")
+	}
+	if len(got.Anime) != 3 || got.Anime[0].Status != anisync.Completed || got.Anime[0].EpisodesWatched != 26 {
+		t.Errorf("Read anime = %+v", got.Anime)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	// Hand written, with the columns out of order and some left out.
+	const data = "status,title,id,episodes_watched\n" +
+		"Currently watching,Trigun,6,3\n" +
+		"plan_to_watch,Cowboy Bebop,1,\n"
+	path := filepath.Join(t.TempDir(), "list.csv")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := listfile.Read(path)
+	if err != nil {
+		t.Fatalf("Read returned err: %v", err)
+	}
+	want := []anisync.Anime{
+		{ID: 6, Title: "Trigun", Status: anisync.Current, EpisodesWatched: 3},
+		{ID: 1, Title: "Cowboy Bebop", Status: anisync.Planned},
+	}
+	if !reflect.DeepEqual(got.Anime, want) {
+		t.Errorf("Read anime = %+v, want %+v", got.Anime, want)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"list.txt", "", `unknown format "txt"`},
+		{"list", "", "no extension"},
+		{"list.csv", "title,status\nTrigun,current\n", "no id column"},
+		{"list.csv", "id,status\n6,watched\n", `line 2: unknown status "watched"`},
+		{"list.csv", "id,status,episodes_watched\n6,current,three\n", `line 2: invalid episodes_watched "three"`},
+		{"list.json", `{"Version":2,"Anime":[]}`, "unsupported snapshot version 2"},
+		{"list.json", `{"Version":1,"Anime":[{"ID":6,"Status":"watched"}]}`, "anime 1 (ID 6)"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := listfile.Read(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Read(%q) with %q returned err %v, want it to contain %q", tt.name, tt.data, err, tt.want)
+		}
+	}
+}
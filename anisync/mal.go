@@ -30,3 +30,7 @@ func (c *MALClient) UpdateMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Resp
 func (c *MALClient) AddMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Response, error) {
 	return c.client.Anime.Add(id, entry)
 }
+
+func (c *MALClient) DeleteMALAnimeEntry(id int) (*mal.Response, error) {
+	return c.client.Anime.Delete(id)
+}
@@ -0,0 +1,275 @@
+// Package malxml reads and writes the XML files of the list export and import
+// of MyAnimeList.net, so that any anime list can be imported to
+// MyAnimeList.net by hand or kept as a portable backup, and such files can be
+// used as offline lists.
+//
+// The files are like the lists of the MyAnimeList.net API, with a myanimelist
+// root holding a myinfo element and one anime element per entry, except that
+// the statuses are written out, e.g. "Plan to Watch", instead of numbered. Both
+// forms are accepted when reading. Files whose name ends in .gz are gzipped.
+package malxml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// File is the root element of a list file.
+type File struct {
+	XMLName xml.Name `xml:"myanimelist"`
+	MyInfo  MyInfo   `xml:"myinfo"`
+	Anime   []Entry  `xml:"anime"`
+}
+
+// MyInfo describes the user of a list file.
+type MyInfo struct {
+	UserID           int    `xml:"user_id"`
+	UserName         string `xml:"user_name"`
+	ExportType       int    `xml:"user_export_type"` // 1 for anime.
+	TotalAnime       int    `xml:"user_total_anime"`
+	TotalWatching    int    `xml:"user_total_watching"`
+	TotalCompleted   int    `xml:"user_total_completed"`
+	TotalOnHold      int    `xml:"user_total_onhold"`
+	TotalDropped     int    `xml:"user_total_dropped"`
+	TotalPlanToWatch int    `xml:"user_total_plantowatch"`
+}
+
+// Entry is an anime of a list file.
+type Entry struct {
+	ID              int    `xml:"series_animedb_id"`
+	Title           CDATA  `xml:"series_title"`
+	Episodes        int    `xml:"series_episodes"`
+	Image           string `xml:"series_image,omitempty"`
+	WatchedEpisodes int    `xml:"my_watched_episodes"`
+	StartDate       string `xml:"my_start_date"`
+	FinishDate      string `xml:"my_finish_date"`
+	Score           int    `xml:"my_score"` // From 1 to 10, 0 if not scored.
+	Status          string `xml:"my_status"`
+	Comments        CDATA  `xml:"my_comments"`
+	TimesWatched    int    `xml:"my_times_watched"`
+	Tags            CDATA  `xml:"my_tags"`
+	Rewatching      int    `xml:"my_rewatching"`
+	RewatchingEp    int    `xml:"my_rewatching_ep"`
+	// LastUpdated is a Unix time. It is not part of the exports of
+	// MyAnimeList.net, which ignores it when importing, but keeps the time of
+	// the entries that are compared.
+	LastUpdated string `xml:"my_last_updated,omitempty"`
+	// UpdateOnImport makes MyAnimeList.net replace the entries that are
+	// already in the list when importing.
+	UpdateOnImport int `xml:"update_on_import"`
+}
+
+// CDATA is text that is written as a CDATA section, as titles and comments
+// often hold characters that would need escaping.
+type CDATA struct {
+	Text string `xml:",cdata"`
+}
+
+// The statuses as they are written in the files.
+const (
+	StatusWatching    = "Watching"
+	StatusCompleted   = "Completed"
+	StatusOnHold      = "On-Hold"
+	StatusDropped     = "Dropped"
+	StatusPlanToWatch = "Plan to Watch"
+)
+
+func fromStatus(s anisync.Status) string {
+	switch s {
+	case anisync.Current:
+		return StatusWatching
+	case anisync.Completed:
+		return StatusCompleted
+	case anisync.OnHold:
+		return StatusOnHold
+	case anisync.Dropped:
+		return StatusDropped
+	case anisync.Planned:
+		return StatusPlanToWatch
+	}
+	return ""
+}
+
+// toStatus parses a status, written out or numbered.
+func toStatus(s string) anisync.Status {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "watching", "1":
+		return anisync.Current
+	case "completed", "2":
+		return anisync.Completed
+	case "on-hold", "onhold", "3":
+		return anisync.OnHold
+	case "dropped", "4":
+		return anisync.Dropped
+	case "plan to watch", "plantowatch", "6":
+		return anisync.Planned
+	}
+	return anisync.Unknown
+}
+
+// MakeFile creates the file of the list of a user. Anime with an unknown
+// status are left out as MyAnimeList.net would reject them.
+func MakeFile(username string, anime []anisync.Anime) File {
+	f := File{MyInfo: MyInfo{UserName: username, ExportType: 1}}
+	for _, a := range anime {
+		e := Entry{
+			ID:              a.ID,
+			Title:           CDATA{a.Title},
+			Episodes:        a.Episodes,
+			Image:           a.Image,
+			WatchedEpisodes: a.EpisodesWatched,
+			StartDate:       "0000-00-00",
+			FinishDate:      "0000-00-00",
+			Status:          fromStatus(a.Status),
+			Comments:        CDATA{a.Notes},
+			TimesWatched:    a.TimesRewatched,
+			UpdateOnImport:  1,
+		}
+		if e.Status == "" {
+			continue
+		}
+		if r, err := strconv.ParseFloat(a.Rating, 64); err == nil {
+			e.Score = int(math.Ceil(r * 2))
+		}
+		if a.Rewatching {
+			e.Rewatching = 1
+		}
+		if a.LastUpdated != nil {
+			e.LastUpdated = strconv.FormatInt(a.LastUpdated.Unix(), 10)
+		}
+		f.Anime = append(f.Anime, e)
+		f.MyInfo.TotalAnime++
+		switch a.Status {
+		case anisync.Current:
+			f.MyInfo.TotalWatching++
+		case anisync.Completed:
+			f.MyInfo.TotalCompleted++
+		case anisync.OnHold:
+			f.MyInfo.TotalOnHold++
+		case anisync.Dropped:
+			f.MyInfo.TotalDropped++
+		case anisync.Planned:
+			f.MyInfo.TotalPlanToWatch++
+		}
+	}
+	return f
+}
+
+// List returns the anime of the file. It fails on entries that do not have an
+// ID or a known status.
+func (f File) List() ([]anisync.Anime, error) {
+	var anime []anisync.Anime
+	for i, e := range f.Anime {
+		a := anisync.Anime{
+			ID:              e.ID,
+			Title:           e.Title.Text,
+			Episodes:        e.Episodes,
+			Image:           e.Image,
+			EpisodesWatched: e.WatchedEpisodes,
+			Status:          toStatus(e.Status),
+			Notes:           e.Comments.Text,
+			TimesRewatched:  e.TimesWatched,
+			Rewatching:      e.Rewatching == 1,
+			Rating:          fmt.Sprintf("%.1f", float64(e.Score)/2),
+		}
+		if a.ID == 0 {
+			return nil, fmt.Errorf("malxml: anime %d has no ID", i+1)
+		}
+		if a.Status == anisync.Unknown {
+			return nil, fmt.Errorf("malxml: anime %d (%s) has unknown status %q", a.ID, a.Title, e.Status)
+		}
+		if e.LastUpdated != "" {
+			sec, err := strconv.ParseInt(e.LastUpdated, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malxml: anime %d (%s) has invalid last updated time %q", a.ID, a.Title, e.LastUpdated)
+			}
+			t := time.Unix(sec, 0).UTC()
+			a.LastUpdated = &t
+		}
+		anime = append(anime, a)
+	}
+	return anime, nil
+}
+
+// Encode writes the file as indented XML.
+func Encode(w io.Writer, f File) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Decode reads a file, gunzipping it if it is gzipped.
+func Decode(r io.Reader) (File, error) {
+	var f File
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return f, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return f, fmt.Errorf("malxml: %v", err)
+	}
+	return f, nil
+}
+
+// WriteFile writes f to the file at path, gzipped if the name ends in .gz. The
+// file is replaced at once so that a crash never leaves half a file.
+func WriteFile(path string, f File) error {
+	var buf bytes.Buffer
+	if strings.HasSuffix(path, ".gz") {
+		zw := gzip.NewWriter(&buf)
+		zw.Name = strings.TrimSuffix(filepath.Base(path), ".gz")
+		if err := Encode(zw, f); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	} else if err := Encode(&buf, f); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadFile reads the file at path, gzipped or not.
+func ReadFile(path string) (File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer r.Close()
+	f, err := Decode(r)
+	if err != nil {
+		return f, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,126 @@
+package malxml_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/malxml"
+)
+
+// export is trimmed from an export of MyAnimeList.net, with an entry of the
+// API list format that numbers the statuses.
+const export = `<?xml version="1.0" encoding="UTF-8" ?>
+<myanimelist>
+	<myinfo>
+		<user_id>1</user_id>
+		<user_name>TestUser</user_name>
+		<user_export_type>1</user_export_type>
+		<user_total_anime>2</user_total_anime>
+	</myinfo>
+	<anime>
+		<series_animedb_id>1</series_animedb_id>
+		<series_title><![CDATA[Cowboy Bebop]]></series_title>
+		<series_type>TV</series_type>
+		<series_episodes>26</series_episodes>
+		<my_id>0</my_id>
+		<my_watched_episodes>26</my_watched_episodes>
+		<my_start_date>0000-00-00</my_start_date>
+		<my_finish_date>0000-00-00</my_finish_date>
+		<my_rated></my_rated>
+		<my_score>9</my_score>
+		<my_storage></my_storage>
+		<my_status>Completed</my_status>
+		<my_comments><![CDATA[See you, space cowboy & co.]]></my_comments>
+		<my_times_watched>1</my_times_watched>
+		<my_rewatch_value></my_rewatch_value>
+		<my_tags><![CDATA[]]></my_tags>
+		<my_rewatching>0</my_rewatching>
+		<my_rewatching_ep>0</my_rewatching_ep>
+		<update_on_import>1</update_on_import>
+	</anime>
+	<anime>
+		<series_animedb_id>5</series_animedb_id>
+		<series_title>Cowboy Bebop: Tengoku no Tobira</series_title>
+		<series_episodes>1</series_episodes>
+		<my_watched_episodes>0</my_watched_episodes>
+		<my_score>0</my_score>
+		<my_status>6</my_status>
+		<my_last_updated>1500000000</my_last_updated>
+	</anime>
+</myanimelist>
+`
+
+func TestDecode(t *testing.T) {
+	f, err := malxml.Decode(strings.NewReader(export))
+	if err != nil {
+		t.Fatal("Decode returned err:", err)
+	}
+	if f.MyInfo.UserName != "TestUser" {
+		t.Errorf("Decode user = %q, want %q", f.MyInfo.UserName, "TestUser")
+	}
+	got, err := f.List()
+	if err != nil {
+		t.Fatal("List returned err:", err)
+	}
+	updated := time.Unix(1500000000, 0).UTC()
+	want := []anisync.Anime{
+		{ID: 1, Title: "Cowboy Bebop", Status: anisync.Completed, EpisodesWatched: 26, Episodes: 26, Rating: "4.5", Notes: "See you, space cowboy & co.", TimesRewatched: 1},
+		{ID: 5, Title: "Cowboy Bebop: Tengoku no Tobira", Status: anisync.Planned, Episodes: 1, Rating: "0.0", LastUpdated: &updated},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List = \n%+v, want \n%+v", got, want)
+	}
+
+	bad := strings.Replace(export, "<my_status>6</my_status>", "<my_status>5</my_status>", 1)
+	if f, err := malxml.Decode(strings.NewReader(bad)); err != nil {
+		t.Fatal("Decode returned err:", err)
+	} else if _, err := f.List(); err == nil {
+		t.Error("List of an entry with an unknown status expected to return err")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	anime := []anisync.Anime{
+		{ID: 1, Title: "Tom & Jerry <3", Status: anisync.Current, EpisodesWatched: 3, Episodes: 12, Rating: "3.5", Rewatching: true, TimesRewatched: 2, LastUpdated: &updated},
+		{ID: 2, Title: "Anime2", Status: anisync.Dropped, Rating: "0.0"},
+		{ID: 3, Title: "Anime3"}, // Unknown status, left out.
+	}
+	f := malxml.MakeFile("TestUser", anime)
+	if f.MyInfo.TotalAnime != 2 || f.MyInfo.TotalWatching != 1 || f.MyInfo.TotalDropped != 1 {
+		t.Errorf("MakeFile myinfo = %+v, want 2 anime, 1 watching and 1 dropped", f.MyInfo)
+	}
+
+	var buf bytes.Buffer
+	if err := malxml.Encode(&buf, f); err != nil {
+		t.Fatal("Encode returned err:", err)
+	}
+	for _, want := range []string{"<![CDATA[Tom & Jerry <3]]>", "<my_status>Watching</my_status>", "<my_score>7</my_score>", "<update_on_import>1</update_on_import>"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Encode output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	for _, name := range []string{"list.xml", "list.xml.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := malxml.WriteFile(path, f); err != nil {
+			t.Fatalf("WriteFile(%q) returned err: %v", name, err)
+		}
+		read, err := malxml.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile(%q) returned err: %v", name, err)
+		}
+		got, err := read.List()
+		if err != nil {
+			t.Fatal("List returned err:", err)
+		}
+		if !reflect.DeepEqual(got, anime[:2]) {
+			t.Errorf("%s round trip = \n%+v, want \n%+v", name, got, anime[:2])
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("requests_total", "Requests by route.", "route", "code")
+	c.Inc("/api/check", "200")
+	c.Add(2, "/api/check", "200")
+	c.Inc(`/a"b`, "500")
+	g := r.Gauge("jobs_in_flight", "Jobs that are running.")
+	g.Add(3)
+	g.Add(-1)
+	h := r.Histogram("latency_seconds", "Latency.\nIn seconds.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "get")
+	h.Observe(0.1, "get")
+	h.Observe(5, "get")
+
+	// Getting an existing metric returns the same one.
+	r.Counter("requests_total", "Requests by route.", "route", "code").Inc("/api/check", "200")
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo returned err:", err)
+	}
+	want := `# HELP jobs_in_flight Jobs that are running.
+# TYPE jobs_in_flight gauge
+jobs_in_flight 2
+# HELP latency_seconds Latency.\nIn seconds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="get",le="0.1"} 2
+latency_seconds_bucket{op="get",le="1"} 2
+latency_seconds_bucket{op="get",le="+Inf"} 3
+latency_seconds_sum{op="get"} 5.15
+latency_seconds_count{op="get"} 3
+# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="/a\"b",code="500"} 1
+requests_total{route="/api/check",code="200"} 4
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteTo wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistry_conflict(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("x", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering x again as a gauge expected to panic")
+		}
+	}()
+	r.Gauge("x", "")
+}
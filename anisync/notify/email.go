@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email sends the events formatted by Message as plain text email through an
+// SMTP server.
+type Email struct {
+	Addr string    // Host and port of the SMTP server.
+	Auth smtp.Auth // Nil if the server does not need authentication.
+	From string
+	To   []string
+}
+
+// Notify implements Notifier. The SMTP session is bound to the context: it
+// fails once the deadline of the context passes or the context is canceled.
+func (m *Email) Notify(ctx context.Context, e Event) error {
+	if err := m.send(ctx, m.message(e)); err != nil {
+		return fmt.Errorf("notify: sending email through %s: %v", m.Addr, err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does over a connection that is closed when the
+// context is done.
+func (m *Email) send(ctx context.Context, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(m.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(m.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range m.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// SMTPConfig is the SMTP server that email targets send through.
+type SMTPConfig struct {
+	Addr     string // Host and port of the server.
+	From     string
+	User     string // Empty if the server does not need authentication.
+	Password string
+}
+
+// Email returns an Email without recipients that sends through the server,
+// authenticating with PLAIN if User is set.
+func (c SMTPConfig) Email() Email {
+	m := Email{Addr: c.Addr, From: c.From}
+	if c.User != "" {
+		host, _, _ := net.SplitHostPort(c.Addr)
+		m.Auth = smtp.PlainAuth("", c.User, c.Password, host)
+	}
+	return m
+}
+
+// Targets parses the targets of specs with ParseTargets, sending the email
+// through the server.
+func (c SMTPConfig) Targets(specs []string) (Targets, error) {
+	return ParseTargets(specs, c.Email())
+}
+
+func (m *Email) message(e Event) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", Subject(e)))
+	fmt.Fprintf(&b, "Date: %s\r\n", e.Finished.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(Message(e), "\n", "\r\n") + "\r\n")
+	return b.Bytes()
+}
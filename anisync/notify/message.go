@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// maxMessageChanges is how many changes a message lists before summing up
+// the rest.
+const maxMessageChanges = 10
+
+// Subject returns a one line summary of a run.
+func Subject(e Event) string {
+	accounts := fmt.Sprintf("%s %s to MyAnimeList.net %s", providerName(e.Provider), e.User, e.MALUsername)
+	switch {
+	case e.Error != "":
+		return "anisync: sync of " + accounts + " failed"
+	case e.Failed():
+		return fmt.Sprintf("anisync: sync of %s had %d failed writes", accounts, e.AddFails+e.UpdateFails)
+	case e.Changed():
+		return fmt.Sprintf("anisync: synced %s, %d added, %d updated", accounts, e.Adds, e.Updates)
+	}
+	return "anisync: " + accounts + " already in sync"
+}
+
+// providerName returns the name of provider as it is shown in the messages.
+func providerName(provider string) string {
+	switch provider {
+	case anisync.ProviderKitsu:
+		return "Kitsu.io"
+	case anisync.ProviderAniList:
+		return "AniList.co"
+	case anisync.ProviderShikimori:
+		return "Shikimori.one"
+	case anisync.ProviderFile:
+		return "list file"
+	}
+	return provider
+}
+
+// Message formats a run as a short chat style message: the subject, the
+// counts and the failed writes first, followed by the successful ones.
+func Message(e Event) string {
+	var b strings.Builder
+	b.WriteString(Subject(e))
+	b.WriteString("\n")
+	if e.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", e.Error)
+	}
+	fmt.Fprintf(&b, "%d missing and %d needing update before the sync. %d added, %d updated, %d failed to be added, %d failed to be updated.\n",
+		e.Missing, e.NeedUpdate, e.Adds, e.Updates, e.AddFails, e.UpdateFails)
+	for i, c := range e.Changes {
+		if i == maxMessageChanges {
+			fmt.Fprintf(&b, "... and %d more\n", len(e.Changes)-i)
+			break
+		}
+		line := fmt.Sprintf("• %s %s (%d)", c.Op, c.Title, c.ID)
+		if len(c.Fields) != 0 {
+			line += ": " + strings.Join(c.Fields, ", ")
+		}
+		if c.Reason != "" {
+			line += " FAILED: " + c.Reason
+		}
+		b.WriteString(line + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,155 @@
+// Package notify tells people about sync runs through webhooks, chat
+// messages or email. Each notifier is paired with a trigger that decides which
+// runs it is told about: all of them, the ones that changed something or the
+// ones that failed.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// Event describes a sync run. It is the payload of the webhooks.
+type Event struct {
+	Source      string // What ran the sync, e.g. watch or scheduler.
+	MALUsername string
+	Provider    string // Of the list that was synced from, e.g. kitsu or anilist.
+	User        string // Whose list was synced from, in Provider.
+	Started     time.Time
+	Finished    time.Time
+	Missing     int // Anime missing from MyAnimeList.net before the sync.
+	NeedUpdate  int // Anime that needed update before the sync.
+	Adds        int
+	Updates     int
+	AddFails    int
+	UpdateFails int
+	Changes     []Change `json:",omitempty"`
+	Error       string   `json:",omitempty"` // Why the run failed as a whole, if it did.
+}
+
+// Change is a write of an anime, successful or not.
+type Change struct {
+	ID     int
+	Title  string
+	Op     anisync.JournalOp
+	Fields []string `json:",omitempty"` // The fields that were updated.
+	Reason string   `json:",omitempty"` // Why the write failed, if it did.
+}
+
+// MakeEvent creates the event of a run from the diff it synced and its
+// result, either of which can be nil if the run failed before getting them,
+// and its error, if any. The run synced from the list of user in provider.
+func MakeEvent(source, malUsername, provider, user string, started time.Time, diff *anisync.Diff, result *anisync.SyncResult, err error) Event {
+	e := Event{
+		Source:      source,
+		MALUsername: malUsername,
+		Provider:    provider,
+		User:        user,
+		Started:     started,
+		Finished:    time.Now(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if diff != nil {
+		e.Missing = len(diff.Missing)
+		e.NeedUpdate = len(diff.NeedUpdate)
+	}
+	if result == nil {
+		return e
+	}
+	e.Adds = len(result.Adds)
+	e.Updates = len(result.Updates)
+	e.AddFails = len(result.AddFails)
+	e.UpdateFails = len(result.UpdateFails)
+	for _, f := range result.AddFails {
+		e.Changes = append(e.Changes, Change{ID: f.Anime.ID, Title: f.Anime.Title, Op: anisync.JournalAdd, Reason: f.Reason})
+	}
+	for _, f := range result.UpdateFails {
+		e.Changes = append(e.Changes, Change{ID: f.Anime.ID, Title: f.Anime.Title, Op: anisync.JournalUpdate, Fields: f.Fields(), Reason: f.Reason})
+	}
+	for _, a := range result.Adds {
+		e.Changes = append(e.Changes, Change{ID: a.Anime.ID, Title: a.Anime.Title, Op: anisync.JournalAdd})
+	}
+	for _, u := range result.Updates {
+		e.Changes = append(e.Changes, Change{ID: u.Anime.ID, Title: u.Anime.Title, Op: anisync.JournalUpdate, Fields: u.Fields()})
+	}
+	return e
+}
+
+// Failed reports whether the run failed as a whole or any of its writes
+// failed.
+func (e Event) Failed() bool {
+	return e.Error != "" || e.AddFails != 0 || e.UpdateFails != 0
+}
+
+// Changed reports whether the run wrote anything to MyAnimeList.net.
+func (e Event) Changed() bool {
+	return e.Adds != 0 || e.Updates != 0
+}
+
+// Trigger decides which runs a notifier is told about.
+type Trigger string
+
+// The triggers.
+const (
+	Always    Trigger = "always"
+	OnChange  Trigger = "change"  // Runs that changed something or failed.
+	OnFailure Trigger = "failure" // Runs that failed or had failed writes.
+)
+
+// ParseTrigger parses the name of a trigger.
+func ParseTrigger(s string) (Trigger, error) {
+	switch t := Trigger(strings.ToLower(s)); t {
+	case Always, OnChange, OnFailure:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown trigger %q, want always, change or failure", s)
+}
+
+// Match reports whether the trigger fires for e.
+func (t Trigger) Match(e Event) bool {
+	switch t {
+	case Always:
+		return true
+	case OnChange:
+		return e.Changed() || e.Failed()
+	case OnFailure:
+		return e.Failed()
+	}
+	return false
+}
+
+// Notifier tells someone about a sync run.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Target is a notifier and the trigger of the runs it is told about.
+type Target struct {
+	Notifier
+	Trigger Trigger
+}
+
+// Targets tell each of their notifiers about the runs that match its trigger.
+type Targets []Target
+
+// Notify implements Notifier. It tries every matching notifier and returns
+// the errors of those that failed.
+func (ts Targets) Notify(ctx context.Context, e Event) error {
+	var errs []error
+	for _, t := range ts {
+		if !t.Trigger.Match(e) {
+			continue
+		}
+		if err := t.Notifier.Notify(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,234 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/notify"
+)
+
+func testEvent() notify.Event {
+	diff := &anisync.Diff{
+		Missing:    []anisync.Anime{{ID: 1}, {ID: 2}},
+		NeedUpdate: []anisync.AniDiff{{Anime: anisync.Anime{ID: 3}}},
+	}
+	result := &anisync.SyncResult{
+		Adds:     []anisync.AddSuccess{{Anime: anisync.Anime{ID: 1, Title: "Anime1"}}},
+		AddFails: []anisync.AddFail{anisync.MakeAddFail(anisync.Anime{ID: 2, Title: "Anime2"}, errors.New("already in the list"))},
+		Updates: []anisync.UpdateSuccess{{AniDiff: anisync.AniDiff{
+			Anime:  anisync.Anime{ID: 3, Title: "Anime3"},
+			Rating: &anisync.RatingDiff{Got: "3.0", Want: "4.0"},
+		}}},
+	}
+	return notify.MakeEvent("watch", "TestUser", anisync.ProviderKitsu, "42", time.Now(), diff, result, nil)
+}
+
+func TestMakeEvent(t *testing.T) {
+	e := testEvent()
+	if e.Missing != 2 || e.NeedUpdate != 1 || e.Adds != 1 || e.AddFails != 1 || e.Updates != 1 || e.UpdateFails != 0 {
+		t.Errorf("MakeEvent counts = %+v", e)
+	}
+	if len(e.Changes) != 3 || e.Changes[0].Reason != "already in the list" {
+		t.Errorf("MakeEvent changes = %+v, want the failed add first", e.Changes)
+	}
+	msg := notify.Message(e)
+	for _, want := range []string{"1 failed writes", "add Anime2 (2) FAILED: already in the list", "update Anime3 (3): " + anisync.FieldRating} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Message does not contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSubject(t *testing.T) {
+	tests := []struct {
+		provider, user string
+		want           string
+	}{
+		{anisync.ProviderKitsu, "42", "anisync: Kitsu.io 42 to MyAnimeList.net TestUser already in sync"},
+		{anisync.ProviderAniList, "fan", "anisync: AniList.co fan to MyAnimeList.net TestUser already in sync"},
+		{anisync.ProviderShikimori, "fan", "anisync: Shikimori.one fan to MyAnimeList.net TestUser already in sync"},
+	}
+	for _, tt := range tests {
+		e := notify.MakeEvent("watch", "TestUser", tt.provider, tt.user, time.Now(), &anisync.Diff{}, &anisync.SyncResult{}, nil)
+		if got := notify.Subject(e); got != tt.want {
+			t.Errorf("Subject of a sync from %s = %q, want %q", tt.provider, got, tt.want)
+		}
+	}
+}
+
+func TestTrigger_Match(t *testing.T) {
+	unchanged := notify.MakeEvent("watch", "TestUser", anisync.ProviderKitsu, "42", time.Now(), &anisync.Diff{}, &anisync.SyncResult{}, nil)
+	changed := notify.MakeEvent("watch", "TestUser", anisync.ProviderKitsu, "42", time.Now(), nil, &anisync.SyncResult{Adds: []anisync.AddSuccess{{}}}, nil)
+	failed := notify.MakeEvent("watch", "TestUser", anisync.ProviderKitsu, "42", time.Now(), nil, nil, errors.New("list not found"))
+	tests := []struct {
+		trigger notify.Trigger
+		want    [3]bool // unchanged, changed, failed
+	}{
+		{notify.Always, [3]bool{true, true, true}},
+		{notify.OnChange, [3]bool{false, true, true}},
+		{notify.OnFailure, [3]bool{false, false, true}},
+	}
+	for _, tt := range tests {
+		for i, e := range []notify.Event{unchanged, changed, failed} {
+			if got := tt.trigger.Match(e); got != tt.want[i] {
+				t.Errorf("%s.Match(event %d) = %v, want %v", tt.trigger, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestTargets(t *testing.T) {
+	var webhook notify.Event
+	var chat map[string]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /webhook", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&webhook)
+	})
+	mux.HandleFunc("POST /chat", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&chat)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var targets notify.Targets
+	for _, spec := range []string{"failure:webhook:" + srv.URL + "/webhook", "change:discord:" + srv.URL + "/chat"} {
+		target, err := notify.Parse(spec, notify.Email{})
+		if err != nil {
+			t.Fatalf("Parse(%q) returned err: %v", spec, err)
+		}
+		targets = append(targets, target)
+	}
+	e := testEvent()
+	if err := targets.Notify(context.Background(), e); err != nil {
+		t.Fatal("Notify returned err:", err)
+	}
+	if webhook.MALUsername != "TestUser" || webhook.AddFails != 1 {
+		t.Errorf("webhook got %+v", webhook)
+	}
+	if chat["content"] != notify.Message(e) {
+		t.Errorf("chat got %q, want the message as content", chat)
+	}
+
+	failing := notify.Targets{{Notifier: &notify.Webhook{URL: srv.URL + "/missing"}, Trigger: notify.Always}}
+	err := failing.Notify(context.Background(), e)
+	if err == nil || strings.Contains(err.Error(), "/missing") {
+		t.Errorf("Notify to a missing webhook returned err %v, want one without the URL path", err)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan string, 1)
+	go fakeSMTP(ln, got)
+
+	target, err := notify.Parse("always:email:a@example.com, B <b@example.com>", notify.Email{Addr: ln.Addr().String(), From: "anisync@example.com"})
+	if err != nil {
+		t.Fatal("Parse returned err:", err)
+	}
+	e := testEvent()
+	if err := target.Notify(context.Background(), e); err != nil {
+		t.Fatal("Notify returned err:", err)
+	}
+	msg := <-got
+	for _, want := range []string{
+		"MAIL FROM:<anisync@example.com>",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"Subject: " + notify.Subject(e),
+		"• add Anime1 (1)",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("email session does not contain %q:\n%s", want, msg)
+		}
+	}
+
+	if _, err := notify.Parse("always:email:a@example.com", notify.Email{}); err == nil {
+		t.Error("Parse of an email target without an SMTP server expected to return err")
+	}
+}
+
+func TestEmailDeadline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// The server accepts the connection but never greets the client.
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	smtp := notify.SMTPConfig{Addr: ln.Addr().String(), From: "anisync@example.com"}
+	targets, err := smtp.Targets([]string{"always:email:a@example.com"})
+	if err != nil {
+		t.Fatal("Targets returned err:", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := targets.Notify(ctx, testEvent()); err == nil {
+		t.Error("Notify to a stalled SMTP server expected to return err")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Notify to a stalled SMTP server took %v, want it to stop at the deadline", d)
+	}
+}
+
+// fakeSMTP accepts a single SMTP session and sends everything the client
+// wrote to got.
+func fakeSMTP(ln net.Listener, got chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	var session strings.Builder
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	data := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		session.WriteString(line)
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case data:
+			if cmd == "." {
+				data = false
+				reply("250 OK")
+			}
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			data = true
+			reply("354 Go ahead")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			got <- session.String()
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+	got <- session.String()
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"flag"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// Parse parses a target of the form trigger:kind:destination. The kind is
+// webhook or chat, with an http or https URL as the destination, or email,
+// with comma separated addresses as the destination. Email is sent through
+// the server and from the address of email.
+//
+// For example:
+//
+//	failure:chat:https://hooks.slack.com/services/...
+//	change:webhook:https://example.com/anisync
+//	always:email:me@example.com,you@example.com
+func Parse(spec string, email Email) (Target, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 {
+		return Target{}, fmt.Errorf("notify: %q is not trigger:kind:destination", spec)
+	}
+	trigger, err := ParseTrigger(parts[0])
+	if err != nil {
+		return Target{}, fmt.Errorf("notify: %v", err)
+	}
+	kind, dest := parts[1], parts[2]
+	switch kind {
+	case "webhook", "chat", "discord":
+		u, err := url.Parse(dest)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Target{}, fmt.Errorf("notify: %s target needs an http or https URL", kind)
+		}
+		switch kind {
+		case "webhook":
+			return Target{Notifier: &Webhook{URL: dest}, Trigger: trigger}, nil
+		case "discord":
+			return Target{Notifier: &Chat{URL: dest, Field: "content"}, Trigger: trigger}, nil
+		}
+		return Target{Notifier: &Chat{URL: dest}, Trigger: trigger}, nil
+	case "email":
+		if email.Addr == "" || email.From == "" {
+			return Target{}, fmt.Errorf("notify: email targets need an SMTP server and a from address")
+		}
+		to, err := parseAddresses(dest)
+		if err != nil {
+			return Target{}, err
+		}
+		email.To = to
+		return Target{Notifier: &email, Trigger: trigger}, nil
+	}
+	return Target{}, fmt.Errorf("notify: unknown kind %q, want webhook, chat, discord or email", kind)
+}
+
+func parseAddresses(s string) ([]string, error) {
+	list, err := mail.ParseAddressList(s)
+	if err != nil {
+		return nil, fmt.Errorf("notify: invalid email addresses %q: %v", s, err)
+	}
+	var to []string
+	for _, a := range list {
+		to = append(to, a.Address)
+	}
+	return to, nil
+}
+
+// ParseTargets parses the targets of specs with Parse.
+func ParseTargets(specs []string, email Email) (Targets, error) {
+	var ts Targets
+	for _, spec := range specs {
+		t, err := Parse(spec, email)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// Specs is a flag.Value of the target specs given with a flag that can be
+// repeated.
+type Specs []string
+
+func (s *Specs) String() string     { return strings.Join(*s, ", ") }
+func (s *Specs) Set(v string) error { *s = append(*s, v); return nil }
+
+// SpecsFlag defines a repeatable flag of target specs on flag.CommandLine,
+// like flag.String does for a string flag.
+func SpecsFlag(name, usage string) *Specs {
+	s := new(Specs)
+	flag.Var(s, name, usage)
+	return s
+}
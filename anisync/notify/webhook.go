@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Webhook posts the events as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil.
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	return post(ctx, w.Client, w.URL, e)
+}
+
+// Chat posts the events formatted by Message to the incoming webhook of a
+// chat, such as those of Slack, Mattermost or Discord, as a JSON object with
+// the message in Field.
+type Chat struct {
+	URL    string
+	Field  string       // "text" if empty, Discord needs "content".
+	Client *http.Client // http.DefaultClient if nil.
+}
+
+// Notify implements Notifier.
+func (c *Chat) Notify(ctx context.Context, e Event) error {
+	field := c.Field
+	if field == "" {
+		field = "text"
+	}
+	return post(ctx, c.Client, c.URL, map[string]string{field: Message(e)})
+}
+
+// post sends v as JSON to rawURL. The errors only mention the host of the URL
+// as webhook URLs often hold secrets.
+func post(ctx context.Context, client *http.Client, rawURL string, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("notify: invalid webhook URL")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", rawURL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("notify: invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "anisync")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify: posting to %s failed", u.Host)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify: posting to %s got status %s", u.Host, resp.Status)
+	}
+	return nil
+}
@@ -45,6 +45,7 @@ type MAL interface {
 	MyAnimeList(username string) (*mal.AnimeList, *mal.Response, error)
 	UpdateMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Response, error)
 	AddMALAnimeEntry(id int, entry mal.AnimeEntry) (*mal.Response, error)
+	DeleteMALAnimeEntry(id int) (*mal.Response, error)
 }
 
 // HB is an interface describing all the operations that we need from the
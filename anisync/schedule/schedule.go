@@ -0,0 +1,184 @@
+// Package schedule provides the schedules that are used to run anisync
+// periodically. A schedule can either be a fixed interval such as "30m" or a
+// cron expression such as "0 */6 * * *".
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes when a job should run.
+type Schedule interface {
+	// Next returns the next time the job should run after t.
+	Next(t time.Time) time.Time
+}
+
+// Parse parses a schedule specification. The specification can be:
+//
+//	a duration such as "90m" or "@every 90m" which runs at fixed intervals,
+//	one of @hourly, @daily, @weekly and @monthly,
+//	a standard 5 field cron expression: minute hour day-of-month month day-of-week.
+//
+// Cron fields accept *, single values, ranges (a-b), lists (a,b) and steps
+// (*/n or a-b/n). Day of week is 0-6 with 0 being Sunday.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	if s := strings.TrimPrefix(spec, "@every "); s != spec || !strings.ContainsAny(spec, " @") {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+		return Every(d)
+	}
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	return parseCron(spec)
+}
+
+// Every returns a Schedule that runs every d. The interval cannot be shorter
+// than a second.
+func Every(d time.Duration) (Schedule, error) {
+	if d < time.Second {
+		return nil, fmt.Errorf("schedule interval %v is shorter than a second", d)
+	}
+	return interval(d), nil
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time { return t.Add(time.Duration(i)) }
+
+func (i interval) String() string { return "@every " + time.Duration(i).String() }
+
+// cron is a schedule described by a cron expression. Each field holds a bit
+// for every value that matches.
+type cron struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether day of month and day of week start
+	// with a star, like * or */2. When neither does, a day matches if either
+	// of them matches, as in the standard cron; otherwise both must match.
+	domStar, dowStar bool
+}
+
+func (c *cron) String() string { return c.spec }
+
+type bounds struct{ min, max int }
+
+var (
+	minutes = bounds{0, 59}
+	hours   = bounds{0, 23}
+	doms    = bounds{1, 31}
+	months  = bounds{1, 12}
+	dows    = bounds{0, 6}
+)
+
+func parseCron(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: cron expression must have 5 fields, got %d", spec, len(fields))
+	}
+	c := &cron{spec: spec}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		b    bounds
+	}{
+		{&c.minute, minutes},
+		{&c.hour, hours},
+		{&c.dom, doms},
+		{&c.month, months},
+		{&c.dow, dows},
+	} {
+		if *f.bits, err = parseField(fields[i], f.b); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+		}
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		lo, hi := b.min, b.max
+		if rng != "*" {
+			vals := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(vals[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if len(vals) == 2 {
+				if hi, err = strconv.Atoi(vals[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if step != 1 {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, b.min, b.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool { return bits&(1<<uint(v)) != 0 }
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t that matches the cron expression. It
+// returns the zero time if there is no such time in the next five years
+// which can happen with expressions like "0 0 31 2 *".
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !has(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,68 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, time.October, 19, 10, 17, 30, 0, time.UTC)
+
+var nextTests = []struct {
+	spec string
+	want time.Time
+}{
+	{"90m", start.Add(90 * time.Minute)},
+	{"@every 1h", start.Add(time.Hour)},
+	{"@hourly", time.Date(2026, time.October, 19, 11, 0, 0, 0, time.UTC)},
+	{"@daily", time.Date(2026, time.October, 20, 0, 0, 0, 0, time.UTC)},
+	{"@weekly", time.Date(2026, time.October, 25, 0, 0, 0, 0, time.UTC)},
+	{"@monthly", time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)},
+	{"*/15 * * * *", time.Date(2026, time.October, 19, 10, 30, 0, 0, time.UTC)},
+	{"0 */6 * * *", time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)},
+	{"5,10 9-17 * * 1-5", time.Date(2026, time.October, 19, 11, 5, 0, 0, time.UTC)},
+	{"0 3 * * 6", time.Date(2026, time.October, 24, 3, 0, 0, 0, time.UTC)},
+	{"30 8 1 1 *", time.Date(2027, time.January, 1, 8, 30, 0, 0, time.UTC)},
+	// Day of month and day of week are both restricted so either can match.
+	{"0 0 20 * 0", time.Date(2026, time.October, 20, 0, 0, 0, 0, time.UTC)},
+	// A field that starts with a star does not restrict, so both must match.
+	{"0 0 */2 * 1", time.Date(2026, time.November, 9, 0, 0, 0, 0, time.UTC)},
+	{"0 0 21 * */2", time.Date(2026, time.November, 21, 0, 0, 0, 0, time.UTC)},
+	{"0 0 31 2 *", time.Time{}},
+}
+
+func TestParse_next(t *testing.T) {
+	for _, tt := range nextTests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) returned err: %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(start); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next(%v) = %v, want %v", tt.spec, start, got, tt.want)
+		}
+	}
+}
+
+var invalidSpecs = []string{
+	"",
+	"10ms",
+	"@every forever",
+	"@yearly",
+	"* * * *",
+	"60 * * * *",
+	"* 24 * * *",
+	"* * 0 * *",
+	"* * * 13 *",
+	"* * * * 7",
+	"*/0 * * * *",
+	"5-1 * * * *",
+	"a * * * *",
+}
+
+func TestParse_invalid(t *testing.T) {
+	for _, spec := range invalidSpecs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) expected to return err", spec)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package anisync
+
+import "fmt"
+
+// Selection chooses an anime of a Diff to sync by its ID. For anime that need
+// update, Fields holds the names of the fields to apply, such as FieldStatus.
+// All the fields that differ are applied if Fields is empty. Missing anime are
+// always added whole so Fields must be empty for them.
+type Selection struct {
+	ID     int
+	Fields []string `json:",omitempty"`
+}
+
+// SelectDiff returns a diff that contains only the selected anime of diff so
+// that syncing it applies only them. For each selected anime that needs
+// update, the fields that were not selected keep their MyAnimeList.net values.
+// It returns an error if a selected anime is no longer missing or in need of
+// update, or if a selected field does not differ, which typically means that
+// diff was computed after the selection was made and things have changed.
+func SelectDiff(diff Diff, sel ...Selection) (Diff, error) {
+	selected := make(map[int]Selection, len(sel))
+	for _, s := range sel {
+		if _, ok := selected[s.ID]; ok {
+			return Diff{}, fmt.Errorf("anime %d is selected more than once", s.ID)
+		}
+		selected[s.ID] = s
+	}
+
+	out := Diff{Left: diff.Left, Right: diff.Right, UpToDate: diff.UpToDate, Uncertain: diff.Uncertain}
+	for _, a := range diff.Missing {
+		s, ok := selected[a.ID]
+		if !ok {
+			continue
+		}
+		if len(s.Fields) != 0 {
+			return Diff{}, fmt.Errorf("anime %d is missing and cannot be synced partially", a.ID)
+		}
+		out.Missing = append(out.Missing, a)
+		delete(selected, a.ID)
+	}
+	for _, d := range diff.NeedUpdate {
+		s, ok := selected[d.Anime.ID]
+		if !ok {
+			continue
+		}
+		d, err := selectFields(d, s.Fields)
+		if err != nil {
+			return Diff{}, err
+		}
+		out.NeedUpdate = append(out.NeedUpdate, d)
+		delete(selected, d.Anime.ID)
+	}
+	for _, s := range sel {
+		if _, ok := selected[s.ID]; ok {
+			return Diff{}, fmt.Errorf("anime %d no longer needs to be synced", s.ID)
+		}
+	}
+	return out, nil
+}
+
+// selectFields returns d with only the provided fields left to apply. The
+// anime of the returned AniDiff has the MyAnimeList.net values for the rest.
+func selectFields(d AniDiff, fields []string) (AniDiff, error) {
+	if len(fields) == 0 {
+		return d, nil
+	}
+	differs := make(map[string]bool)
+	for _, f := range d.Fields() {
+		differs[f] = true
+	}
+	selected := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		switch f {
+		case FieldStatus, FieldEpisodesWatched, FieldRating, FieldRewatching:
+		default:
+			return AniDiff{}, fmt.Errorf("anime %d: unknown field %q", d.Anime.ID, f)
+		}
+		if !differs[f] {
+			return AniDiff{}, fmt.Errorf("anime %d: field %s no longer needs update", d.Anime.ID, f)
+		}
+		selected[f] = true
+	}
+	if d.Status != nil && !selected[FieldStatus] {
+		d.Anime.Status = d.Status.Got
+		d.Status = nil
+	}
+	if d.EpisodesWatched != nil && !selected[FieldEpisodesWatched] {
+		d.Anime.EpisodesWatched = d.EpisodesWatched.Got
+		d.EpisodesWatched = nil
+	}
+	if d.Rating != nil && !selected[FieldRating] {
+		d.Anime.Rating = d.Rating.Got
+		d.Rating = nil
+	}
+	if d.Rewatching != nil && !selected[FieldRewatching] {
+		d.Anime.Rewatching = d.Rewatching.Got
+		d.Rewatching = nil
+	}
+	return d, nil
+}
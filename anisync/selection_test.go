@@ -0,0 +1,84 @@
+package anisync_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+func selectionDiff() *anisync.Diff {
+	left := []anisync.Anime{
+		{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 3, Rating: "3.0"},
+		{ID: 2, Title: "Anime2", Status: anisync.Completed},
+	}
+	right := []anisync.Anime{
+		{ID: 1, Title: "Anime1", Status: anisync.Completed, EpisodesWatched: 12, Rating: "4.5"},
+		{ID: 2, Title: "Anime2", Status: anisync.Completed},
+		{ID: 3, Title: "Anime3", Status: anisync.Planned},
+		{ID: 4, Title: "Anime4", Status: anisync.Dropped},
+	}
+	return anisync.Compare(left, right)
+}
+
+func TestSelectDiff(t *testing.T) {
+	diff := selectionDiff()
+
+	got, err := anisync.SelectDiff(*diff,
+		anisync.Selection{ID: 4},
+		anisync.Selection{ID: 1, Fields: []string{anisync.FieldEpisodesWatched}},
+	)
+	if err != nil {
+		t.Fatal("SelectDiff returned err:", err)
+	}
+
+	if want := []anisync.Anime{diff.Right[3]}; !reflect.DeepEqual(got.Missing, want) {
+		t.Errorf("SelectDiff Missing = %+v, want %+v", got.Missing, want)
+	}
+	want := []anisync.AniDiff{
+		{
+			Anime:           anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 12, Rating: "3.0"},
+			EpisodesWatched: &anisync.EpisodesWatchedDiff{Got: 3, Want: 12},
+		},
+	}
+	if !reflect.DeepEqual(got.NeedUpdate, want) {
+		t.Errorf("SelectDiff NeedUpdate = \n%+v, want \n%+v", got.NeedUpdate, want)
+	}
+	if !reflect.DeepEqual(got.UpToDate, diff.UpToDate) {
+		t.Errorf("SelectDiff UpToDate = %+v, want %+v", got.UpToDate, diff.UpToDate)
+	}
+}
+
+func TestSelectDiff_allFields(t *testing.T) {
+	diff := selectionDiff()
+
+	got, err := anisync.SelectDiff(*diff, anisync.Selection{ID: 1})
+	if err != nil {
+		t.Fatal("SelectDiff returned err:", err)
+	}
+	if !reflect.DeepEqual(got.NeedUpdate, diff.NeedUpdate) {
+		t.Errorf("SelectDiff NeedUpdate = \n%+v, want \n%+v", got.NeedUpdate, diff.NeedUpdate)
+	}
+	if len(got.Missing) != 0 {
+		t.Errorf("SelectDiff Missing = %+v, want none", got.Missing)
+	}
+}
+
+func TestSelectDiff_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		sel  []anisync.Selection
+	}{
+		{"up to date", []anisync.Selection{{ID: 2}}},
+		{"not in lists", []anisync.Selection{{ID: 5}}},
+		{"twice", []anisync.Selection{{ID: 3}, {ID: 3}}},
+		{"missing with fields", []anisync.Selection{{ID: 3, Fields: []string{anisync.FieldStatus}}}},
+		{"unknown field", []anisync.Selection{{ID: 1, Fields: []string{"Title"}}}},
+		{"field does not differ", []anisync.Selection{{ID: 1, Fields: []string{anisync.FieldRewatching}}}},
+	}
+	for _, tt := range tests {
+		if _, err := anisync.SelectDiff(*selectionDiff(), tt.sel...); err == nil {
+			t.Errorf("SelectDiff %s expected to return err", tt.name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package shikimori
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// The statuses of user rates.
+const (
+	StatusPlanned    = "planned"
+	StatusWatching   = "watching"
+	StatusRewatching = "rewatching"
+	StatusCompleted  = "completed"
+	StatusOnHold     = "on_hold"
+	StatusDropped    = "dropped"
+)
+
+// pageLimit is the number of rates requested per page, the most that
+// Shikimori allows.
+const pageLimit = 5000
+
+// animeRate is a user rate of the list of a user, with its anime.
+type animeRate struct {
+	ID        int       `json:"id"`
+	Score     int       `json:"score"`
+	Status    string    `json:"status"`
+	Text      string    `json:"text"`
+	Episodes  int       `json:"episodes"`
+	Rewatches int       `json:"rewatches"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Anime     struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Episodes int    `json:"episodes"`
+		Image    struct {
+			Preview string `json:"preview"`
+		} `json:"image"`
+	} `json:"anime"`
+}
+
+// AnimeRates returns the anime list of a user, given by nickname or ID,
+// following the pages until the last one.
+//
+// A page holds one more rate than the limit when there are more pages, and
+// that rate starts the next page. As Shikimori may serve smaller pages than
+// the limit that is asked for, the pages are followed until one has no rates
+// that were not seen before, rather than until one is smaller than the limit.
+func (c *Client) AnimeRates(user string) ([]anisync.Anime, error) {
+	var anime []anisync.Anime
+	seen := make(map[int]bool)
+	for page := 1; ; page++ {
+		q := url.Values{"limit": {strconv.Itoa(pageLimit)}, "page": {strconv.Itoa(page)}}
+		var rates []animeRate
+		if err := c.do("GET", "api/users/"+url.PathEscape(user)+"/anime_rates?"+q.Encode(), nil, &rates); err != nil {
+			return nil, err
+		}
+		more := false
+		for _, r := range rates {
+			if seen[r.ID] {
+				continue
+			}
+			seen[r.ID] = true
+			more = true
+			a, err := c.fromRate(r)
+			if err != nil {
+				return nil, fmt.Errorf("shikimori: anime %d (%s): %v", r.Anime.ID, r.Anime.Name, err)
+			}
+			anime = append(anime, a)
+		}
+		if !more {
+			return anime, nil
+		}
+	}
+}
+
+func (c *Client) fromRate(r animeRate) (anisync.Anime, error) {
+	a := anisync.Anime{
+		ID:              r.Anime.ID,
+		Title:           r.Anime.Name,
+		Episodes:        r.Anime.Episodes,
+		EpisodesWatched: r.Episodes,
+		TimesRewatched:  r.Rewatches,
+		Notes:           r.Text,
+		Rating:          rating(r.Score),
+	}
+	if !r.UpdatedAt.IsZero() {
+		t := r.UpdatedAt.UTC()
+		a.LastUpdated = &t
+	}
+	if r.Anime.Image.Preview != "" {
+		// The images are relative to the site.
+		if u, err := c.BaseURL.Parse(r.Anime.Image.Preview); err == nil {
+			a.Image = u.String()
+		}
+	}
+	var err error
+	a.Status, a.Rewatching, err = fromStatus(r.Status)
+	return a, err
+}
+
+// rating converts a score to a rating of anisync.Anime. A score of 0 means
+// the anime is not scored and converts to an empty rating.
+func rating(score int) string {
+	if score <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", float64(score)/2)
+}
+
+// score converts a rating of anisync.Anime to a score.
+func score(rating string) (int, error) {
+	if rating == "" {
+		return 0, nil
+	}
+	r, err := strconv.ParseFloat(rating, 64)
+	if err != nil || r < 0 || r > 5 {
+		return 0, fmt.Errorf("shikimori: invalid rating %q", rating)
+	}
+	return int(math.Round(r * 2)), nil
+}
+
+// fromStatus returns the status of an anime of a rate status and whether it
+// is being rewatched. Anime that are being rewatched are current and
+// rewatching, as on Kitsu.io.
+func fromStatus(status string) (anisync.Status, bool, error) {
+	switch status {
+	case StatusWatching:
+		return anisync.Current, false, nil
+	case StatusPlanned:
+		return anisync.Planned, false, nil
+	case StatusCompleted:
+		return anisync.Completed, false, nil
+	case StatusOnHold:
+		return anisync.OnHold, false, nil
+	case StatusDropped:
+		return anisync.Dropped, false, nil
+	case StatusRewatching:
+		return anisync.Current, true, nil
+	}
+	return anisync.Unknown, false, fmt.Errorf("unknown status %q", status)
+}
+
+// toStatus returns the rate status of an anime. Current and completed anime
+// that are being rewatched are rewatching.
+func toStatus(a anisync.Anime) (string, error) {
+	switch a.Status {
+	case anisync.Current, anisync.Completed:
+		if a.Rewatching {
+			return StatusRewatching, nil
+		}
+		if a.Status == anisync.Current {
+			return StatusWatching, nil
+		}
+		return StatusCompleted, nil
+	case anisync.Planned:
+		return StatusPlanned, nil
+	case anisync.OnHold:
+		return StatusOnHold, nil
+	case anisync.Dropped:
+		return StatusDropped, nil
+	}
+	return "", fmt.Errorf("shikimori: no status for %v", a.Status)
+}
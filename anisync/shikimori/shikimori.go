@@ -0,0 +1,137 @@
+// Package shikimori is a client of the REST API of Shikimori.one. Shikimori
+// uses the MyAnimeList.net IDs of the anime, so its user rates, the entries of
+// the anime lists, are read as anisync.Anime without any mapping. The rates
+// of the user of an access token can also be created and updated.
+//
+// Scores on Shikimori are from 1 to 10 like on MyAnimeList.net and are
+// converted from and to the 0 to 5 ratings of anisync.Anime.
+package shikimori
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultBaseURL = "https://shikimori.one/"
+	// userAgent identifies the client, which Shikimori requires.
+	userAgent = "anisync"
+)
+
+// Client sends requests to the Shikimori API.
+type Client struct {
+	// BaseURL is the base URL of the API. It can be changed to the one of a
+	// fake server for testing.
+	BaseURL *url.URL
+
+	client *http.Client
+	token  string
+}
+
+// NewClient returns a client that uses httpClient, or http.DefaultClient if it
+// is nil. The OAuth2 access token is only needed to write user rates and can
+// be empty to only read lists.
+func NewClient(httpClient *http.Client, token string) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	baseURL, _ := url.Parse(defaultBaseURL)
+	return &Client{BaseURL: baseURL, client: httpClient, token: token}
+}
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *Error) Error() string {
+	msg := strings.Join(e.Messages, "; ")
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("shikimori: %d: %s", e.StatusCode, msg)
+}
+
+// NotFound reports whether the error is about something that does not exist,
+// such as a user.
+func (e *Error) NotFound() bool { return e.StatusCode == http.StatusNotFound }
+
+// do sends a request to path, relative to the base URL, with body encoded as
+// JSON if not nil, and decodes the response into v if not nil.
+func (c *Client) do(method, path string, body, v interface{}) error {
+	u, err := c.BaseURL.Parse(path)
+	if err != nil {
+		return err
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return decodeError(resp)
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("shikimori: decoding %s %s: %v", method, u.Path, err)
+	}
+	return nil
+}
+
+// decodeError returns the error of a response, whose body is either a message
+// or a list of errors, depending on the endpoint.
+func decodeError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Message string          `json:"message"`
+		Errors  json.RawMessage `json:"errors"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) != nil {
+		return e
+	}
+	if body.Message != "" {
+		e.Messages = append(e.Messages, body.Message)
+	}
+	var list []string
+	if json.Unmarshal(body.Errors, &list) == nil {
+		e.Messages = append(e.Messages, list...)
+	}
+	var fields map[string][]string
+	if json.Unmarshal(body.Errors, &fields) == nil {
+		for field, msgs := range fields {
+			for _, m := range msgs {
+				e.Messages = append(e.Messages, field+" "+m)
+			}
+		}
+	}
+	return e
+}
@@ -0,0 +1,107 @@
+package shikimori_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/anisynctest"
+	"github.com/nstratos/anisync/anisync/shikimori"
+)
+
+func TestAnimeRates(t *testing.T) {
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	srv := anisynctest.NewShikimoriServer()
+	defer srv.Close()
+	// Pages smaller than the limit that is asked for make the list span
+	// three pages.
+	srv.MaxPageLimit = 2
+	srv.AddUser(7, "Fan", "",
+		anisynctest.ShikimoriRate{AnimeID: 1, Title: "Cowboy Bebop", Episodes: 26, Status: shikimori.StatusCompleted, Score: 9, Watched: 26, Rewatches: 1, Text: "Bang", UpdatedAt: updated},
+		anisynctest.ShikimoriRate{AnimeID: 6, Title: "Trigun", Episodes: 26, Status: shikimori.StatusRewatching, Watched: 3, UpdatedAt: updated},
+		anisynctest.ShikimoriRate{AnimeID: 30, Title: "Neon Genesis Evangelion", Status: shikimori.StatusOnHold, Score: 4, UpdatedAt: updated},
+		anisynctest.ShikimoriRate{AnimeID: 43, Title: "Ghost in the Shell", Status: shikimori.StatusPlanned, UpdatedAt: updated},
+		anisynctest.ShikimoriRate{AnimeID: 47, Title: "Akira", Status: shikimori.StatusDropped, Watched: 1, UpdatedAt: updated},
+	)
+	c := srv.Client("")
+
+	got, err := c.AnimeRates("fan")
+	if err != nil {
+		t.Fatalf("AnimeRates returned err: %v", err)
+	}
+	image := func(id string) string { return srv.URL + "system/animes/preview/" + id + ".jpg" }
+	want := []anisync.Anime{
+		{ID: 1, Title: "Cowboy Bebop", Episodes: 26, Status: anisync.Completed, Rating: "4.5", EpisodesWatched: 26, TimesRewatched: 1, Notes: "Bang", LastUpdated: &updated, Image: image("1")},
+		{ID: 6, Title: "Trigun", Episodes: 26, Status: anisync.Current, Rewatching: true, EpisodesWatched: 3, LastUpdated: &updated, Image: image("6")},
+		{ID: 30, Title: "Neon Genesis Evangelion", Status: anisync.OnHold, Rating: "2.0", LastUpdated: &updated, Image: image("30")},
+		{ID: 43, Title: "Ghost in the Shell", Status: anisync.Planned, LastUpdated: &updated, Image: image("43")},
+		{ID: 47, Title: "Akira", Status: anisync.Dropped, EpisodesWatched: 1, LastUpdated: &updated, Image: image("47")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AnimeRates = \n%+v, want \n%+v", got, want)
+	}
+
+	// The lists can also be read by user ID.
+	if byID, err := c.AnimeRates("7"); err != nil || len(byID) != 5 {
+		t.Errorf("AnimeRates by ID returned %d anime, err %v, want 5", len(byID), err)
+	}
+
+	_, err = c.AnimeRates("nobody")
+	var e *shikimori.Error
+	if !errors.As(err, &e) || !e.NotFound() {
+		t.Errorf("AnimeRates of unknown user returned err %v, want a not found *shikimori.Error", err)
+	}
+}
+
+func TestSaveRate(t *testing.T) {
+	srv := anisynctest.NewShikimoriServer()
+	defer srv.Close()
+	srv.AddUser(7, "Fan", "secret",
+		anisynctest.ShikimoriRate{AnimeID: 1, Title: "Cowboy Bebop", Status: shikimori.StatusWatching, Watched: 3},
+	)
+	srv.AddAnime(6, "Trigun", 26)
+	c := srv.Client("secret")
+
+	u, err := c.Whoami()
+	if err != nil {
+		t.Fatalf("Whoami returned err: %v", err)
+	}
+	if u.ID != 7 || u.Nickname != "Fan" {
+		t.Errorf("Whoami = %+v, want user 7 Fan", u)
+	}
+
+	// An update of an anime of the list and an add of one that is not.
+	if _, err := c.SaveRate(u.ID, anisync.Anime{ID: 1, Status: anisync.Completed, EpisodesWatched: 26, Rating: "4.5", Notes: "Bang"}); err != nil {
+		t.Fatalf("SaveRate update returned err: %v", err)
+	}
+	if _, err := c.SaveRate(u.ID, anisync.Anime{ID: 6, Status: anisync.Completed, Rewatching: true, TimesRewatched: 2}); err != nil {
+		t.Fatalf("SaveRate add returned err: %v", err)
+	}
+	got := srv.Rates(7)
+	if len(got) != 2 {
+		t.Fatalf("list has %d rates after saving, want 2: %+v", len(got), got)
+	}
+	if r := got[0]; r.Status != shikimori.StatusCompleted || r.Score != 9 || r.Watched != 26 || r.Text != "Bang" {
+		t.Errorf("updated rate = %+v, want completed with score 9, 26 episodes and the text", r)
+	}
+	if r := got[1]; r.Status != shikimori.StatusRewatching || r.Score != 0 || r.Rewatches != 2 || r.Title != "Trigun" {
+		t.Errorf("added rate = %+v, want Trigun rewatching, not scored and rewatched twice", r)
+	}
+
+	if _, err := c.SaveRate(u.ID, anisync.Anime{ID: 999, Status: anisync.Current}); err == nil || !strings.Contains(err.Error(), "Target not found") {
+		t.Errorf("SaveRate of unknown anime returned err %v, want target not found", err)
+	}
+	if _, err := c.SaveRate(u.ID, anisync.Anime{ID: 1, Status: anisync.Current, Rating: "six"}); err == nil {
+		t.Error("SaveRate with invalid rating returned no error")
+	}
+	var e *shikimori.Error
+	if _, err := srv.Client("wrong").Whoami(); !errors.As(err, &e) || e.StatusCode != 401 {
+		t.Errorf("Whoami with wrong token returned err %v, want a 401 *shikimori.Error", err)
+	}
+	if _, err := srv.Client("wrong").SaveRate(7, anisync.Anime{ID: 6, Status: anisync.Dropped}); !errors.As(err, &e) || e.StatusCode != 403 {
+		t.Errorf("SaveRate with wrong token returned err %v, want a 403 *shikimori.Error", err)
+	}
+}
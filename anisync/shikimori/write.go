@@ -0,0 +1,81 @@
+package shikimori
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// User is a user of Shikimori.
+type User struct {
+	ID       int    `json:"id"`
+	Nickname string `json:"nickname"`
+}
+
+// Whoami returns the user of the access token of the client.
+func (c *Client) Whoami() (*User, error) {
+	var u *User
+	if err := c.do("GET", "api/users/whoami", nil, &u); err != nil {
+		return nil, err
+	}
+	if u == nil {
+		// Shikimori answers null when the token is not valid.
+		return nil, &Error{StatusCode: 401, Messages: []string{"not logged in"}}
+	}
+	return u, nil
+}
+
+// userRate is a user rate as the v2 API reads and writes it.
+type userRate struct {
+	ID         int    `json:"id,omitempty"`
+	UserID     int    `json:"user_id"`
+	TargetID   int    `json:"target_id"`
+	TargetType string `json:"target_type"`
+	Status     string `json:"status"`
+	Score      int    `json:"score"`
+	Episodes   int    `json:"episodes"`
+	Rewatches  int    `json:"rewatches"`
+	Text       string `json:"text"`
+}
+
+// SaveRate creates or updates the rate of the anime, whose ID is a
+// MyAnimeList.net ID as on Shikimori, in the list of the user with userID,
+// who must be the user of the access token. It returns the ID of the rate.
+func (c *Client) SaveRate(userID int, a anisync.Anime) (int, error) {
+	status, err := toStatus(a)
+	if err != nil {
+		return 0, err
+	}
+	sc, err := score(a.Rating)
+	if err != nil {
+		return 0, err
+	}
+	rate := userRate{
+		UserID:     userID,
+		TargetID:   a.ID,
+		TargetType: "Anime",
+		Status:     status,
+		Score:      sc,
+		Episodes:   a.EpisodesWatched,
+		Rewatches:  a.TimesRewatched,
+		Text:       a.Notes,
+	}
+
+	q := url.Values{"user_id": {strconv.Itoa(userID)}, "target_id": {strconv.Itoa(a.ID)}, "target_type": {"Anime"}}
+	var existing []userRate
+	if err := c.do("GET", "api/v2/user_rates?"+q.Encode(), nil, &existing); err != nil {
+		return 0, err
+	}
+	body := map[string]interface{}{"user_rate": rate}
+	var saved userRate
+	if len(existing) == 0 {
+		err = c.do("POST", "api/v2/user_rates", body, &saved)
+	} else {
+		err = c.do("PATCH", "api/v2/user_rates/"+strconv.Itoa(existing[0].ID), body, &saved)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return saved.ID, nil
+}
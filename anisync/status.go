@@ -1,6 +1,9 @@
 package anisync
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/nstratos/go-kitsu/kitsu"
 	"github.com/nstratos/go-myanimelist/mal"
 )
@@ -33,6 +36,28 @@ func (s Status) String() string {
 	}
 }
 
+// ParseStatus parses a status from its name. It accepts the short names
+// current, planned, completed, onhold and dropped as well as the names
+// returned by Status.String, ignoring case, spaces and dashes.
+func ParseStatus(name string) (Status, error) {
+	s := strings.ToLower(name)
+	s = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(s)
+	switch s {
+	case "current", "currentlywatching", "watching":
+		return Current, nil
+	case "planned", "plantowatch":
+		return Planned, nil
+	case "completed":
+		return Completed, nil
+	case "onhold":
+		return OnHold, nil
+	case "dropped":
+		return Dropped, nil
+	default:
+		return Unknown, fmt.Errorf("unknown status %q", name)
+	}
+}
+
 func fromKitsuStatus(status string) Status {
 	switch status {
 	case kitsu.LibraryEntryStatusCurrent:
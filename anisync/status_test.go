@@ -63,3 +63,35 @@ func TestToMALStatus(t *testing.T) {
 //		t.Errorf("toMALStatus(%q) expected to return err", in)
 //	}
 //}
+
+var parseStatusTests = []struct {
+	in  string
+	out Status
+}{
+	{"current", Current},
+	{"Currently watching", Current},
+	{"planned", Planned},
+	{"plan-to-watch", Planned},
+	{"Completed", Completed},
+	{"on-hold", OnHold},
+	{"onhold", OnHold},
+	{"dropped", Dropped},
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, tt := range parseStatusTests {
+		got, err := ParseStatus(tt.in)
+		if err != nil {
+			t.Errorf("ParseStatus(%q) returned err: %v", tt.in, err)
+		}
+		if want := tt.out; got != want {
+			t.Errorf("ParseStatus(%q) => %v, want %v", tt.in, got, want)
+		}
+	}
+}
+
+func TestParseStatus_invalidStatus(t *testing.T) {
+	if _, err := ParseStatus("watched"); err == nil {
+		t.Error("ParseStatus with invalid status expected to return err")
+	}
+}
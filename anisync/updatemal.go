@@ -48,10 +48,43 @@ func MakeUpdateFail(d AniDiff, err error) UpdateFail {
 }
 
 func (c *Client) SyncMALAnime(diff Diff) *SyncResult {
+	return c.SyncMALAnimeFunc(diff, nil)
+}
+
+// SyncEvent describes the outcome of a single write of a sync. Done is the
+// number of writes attempted so far, including this one, out of Total.
+type SyncEvent struct {
+	Op     JournalOp
+	Anime  Anime
+	Error  error  `json:"-"`
+	Reason string `json:",omitempty"`
+	Done   int
+	Total  int
+}
+
+// SyncMALAnimeFunc is like SyncMALAnime but it also calls fn, if not nil,
+// after each write so that the progress of the sync can be reported while it
+// is running.
+func (c *Client) SyncMALAnimeFunc(diff Diff, fn func(SyncEvent)) *SyncResult {
+	total := len(diff.Missing) + len(diff.NeedUpdate)
+	done := 0
+	report := func(op JournalOp, a Anime, err error) {
+		done++
+		if fn == nil {
+			return
+		}
+		e := SyncEvent{Op: op, Anime: a, Error: err, Done: done, Total: total}
+		if err != nil {
+			e.Reason = err.Error()
+		}
+		fn(e)
+	}
+
 	var adds []AddSuccess
 	var addf []AddFail
 	for _, a := range diff.Missing {
 		err := c.AddMALAnime(a)
+		report(JournalAdd, a, err)
 		if err != nil {
 			addf = append(addf, MakeAddFail(a, err))
 			continue
@@ -63,6 +96,7 @@ func (c *Client) SyncMALAnime(diff Diff) *SyncResult {
 	var updf []UpdateFail
 	for _, d := range diff.NeedUpdate {
 		err := c.UpdateMALAnime(d.Anime)
+		report(JournalUpdate, d.Anime, err)
 		if err != nil {
 			updf = append(updf, MakeUpdateFail(d, err))
 			continue
@@ -93,6 +127,14 @@ func (c *Client) AddMALAnime(a Anime) error {
 	return nil
 }
 
+func (c *Client) DeleteMALAnime(id int) error {
+	_, err := c.resources.DeleteMALAnimeEntry(id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func toMALEntry(a Anime) mal.AnimeEntry {
 	e := mal.AnimeEntry{
 		Episode:        a.EpisodesWatched,
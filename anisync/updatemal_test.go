@@ -96,6 +96,31 @@ func TestClient_AddMALAnime_invalidID(t *testing.T) {
 	}
 }
 
+func (c *MALClientStub) DeleteMALAnimeEntry(id int) (*mal.Response, error) {
+	switch {
+	case id == validAnimeID:
+		return &mal.Response{Body: []byte{}, Response: &http.Response{}}, nil
+	case id == notFoundAnimeID:
+		return &mal.Response{Body: []byte{}, Response: &http.Response{}}, fmt.Errorf("anime not found")
+	default:
+		return &mal.Response{Body: []byte{}, Response: &http.Response{}}, fmt.Errorf("invalid ID")
+	}
+}
+
+func TestClient_DeleteMALAnime(t *testing.T) {
+	err := client.DeleteMALAnime(validAnimeID)
+	if err != nil {
+		t.Errorf("DeleteMALAnime returned error %v", err)
+	}
+}
+
+func TestClient_DeleteMALAnime_invalidID(t *testing.T) {
+	err := client.DeleteMALAnime(0)
+	if err == nil {
+		t.Errorf("DeleteMALAnime with invalid ID expected to return err")
+	}
+}
+
 var syncTests = []struct {
 	name       string
 	diff       anisync.Diff
@@ -252,3 +277,30 @@ func TestClient_SyncMALAnime(t *testing.T) {
 		}
 	}
 }
+
+func TestClient_SyncMALAnimeFunc(t *testing.T) {
+	var events []anisync.SyncEvent
+	for _, tt := range syncTests {
+		events = events[:0]
+		got := client.SyncMALAnimeFunc(tt.diff, func(e anisync.SyncEvent) {
+			events = append(events, e)
+		})
+		if want := tt.syncResult; !reflect.DeepEqual(got, want) {
+			t.Errorf("SyncMALAnimeFunc %q returned \n%+v, want \n%+v", tt.name, got, want)
+		}
+		if got, want := len(events), 2; got != want {
+			t.Fatalf("SyncMALAnimeFunc %q reported %d events, want %d", tt.name, got, want)
+		}
+		for i, e := range events {
+			if got, want := e.Done, i+1; got != want {
+				t.Errorf("SyncMALAnimeFunc %q event #%d Done = %d, want %d", tt.name, i, got, want)
+			}
+			if got, want := e.Total, 2; got != want {
+				t.Errorf("SyncMALAnimeFunc %q event #%d Total = %d, want %d", tt.name, i, got, want)
+			}
+		}
+		if got, want := events[1].Reason, "anime not found"; got != want {
+			t.Errorf("SyncMALAnimeFunc %q second event Reason = %q, want %q", tt.name, got, want)
+		}
+	}
+}
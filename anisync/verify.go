@@ -0,0 +1,109 @@
+package anisync
+
+import "fmt"
+
+// The names of the fields that a sync writes to MyAnimeList.net.
+const (
+	FieldStatus          = "Status"
+	FieldEpisodesWatched = "EpisodesWatched"
+	FieldRating          = "Rating"
+	FieldRewatching      = "Rewatching"
+)
+
+// Fields returns the names of the fields that differ between the two lists
+// and are written by a sync. LastUpdated is not included as a sync cannot
+// write it.
+func (d AniDiff) Fields() []string {
+	var fields []string
+	if d.Status != nil {
+		fields = append(fields, FieldStatus)
+	}
+	if d.EpisodesWatched != nil {
+		fields = append(fields, FieldEpisodesWatched)
+	}
+	if d.Rating != nil {
+		fields = append(fields, FieldRating)
+	}
+	if d.Rewatching != nil {
+		fields = append(fields, FieldRewatching)
+	}
+	return fields
+}
+
+// Verification is the result of checking whether the anime written by a sync
+// converged, meaning that after the sync they are in the MyAnimeList.net list
+// and have the same values as the source list.
+type Verification struct {
+	Diff        *Diff
+	Converged   []Anime
+	Unconverged []Unconverged
+}
+
+// Unconverged is an anime that still differs after being written. Missing is
+// true if the anime is still missing from MyAnimeList.net. Otherwise Fields
+// holds the names of the fields which failed to stick and AniDiff holds their
+// values.
+type Unconverged struct {
+	AniDiff
+	Missing bool
+	Fields  []string
+}
+
+// AllConverged reports whether all the verified anime converged.
+func (v *Verification) AllConverged() bool { return len(v.Unconverged) == 0 }
+
+// VerifySync fetches the MyAnimeList.net list again, compares it to the
+// source list, which should be fetched again too, and checks whether the
+// anime with the provided IDs, which are typically the ones written by a
+// sync, converged.
+func (c *Client) VerifySync(malUsername string, source []Anime, ids ...int) (*Verification, error) {
+	malist, _, err := c.GetMyAnimeList(malUsername)
+	if err != nil {
+		return nil, fmt.Errorf("getting MyAnimeList.net list: %v", err)
+	}
+	return Verify(Compare(malist, source), ids...), nil
+}
+
+// Verify checks whether the anime with the provided IDs converged according
+// to diff. Anime that are not part of the right list of diff are ignored.
+func Verify(diff *Diff, ids ...int) *Verification {
+	v := &Verification{Diff: diff}
+	for _, id := range ids {
+		if a := findAnime(diff.Missing, id); a != nil {
+			v.Unconverged = append(v.Unconverged, Unconverged{AniDiff: AniDiff{Anime: *a}, Missing: true})
+			continue
+		}
+		if d := findAniDiff(diff.NeedUpdate, id); d != nil {
+			v.Unconverged = append(v.Unconverged, Unconverged{AniDiff: *d, Fields: d.Fields()})
+			continue
+		}
+		if a := findAnime(diff.UpToDate, id); a != nil {
+			v.Converged = append(v.Converged, *a)
+			continue
+		}
+		if d := findAniDiff(diff.Uncertain, id); d != nil {
+			v.Converged = append(v.Converged, d.Anime)
+		}
+	}
+	return v
+}
+
+// findAnime is like FindByID but it does not sort anime as the order of the
+// lists of Diff is meaningful.
+func findAnime(anime []Anime, id int) *Anime {
+	for i := range anime {
+		if anime[i].ID == id {
+			return &anime[i]
+		}
+	}
+	return nil
+}
+
+func findAniDiff(diffs []AniDiff, id int) *AniDiff {
+	for i := range diffs {
+		if diffs[i].Anime.ID == id {
+			return &diffs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package anisync_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+func TestVerify(t *testing.T) {
+	left := []anisync.Anime{
+		{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 3, LastUpdated: &before},
+		{ID: 2, Title: "Anime2", Status: anisync.Completed, Rating: "4.0"},
+		{ID: 4, Title: "Anime4", Status: anisync.Dropped},
+	}
+	right := []anisync.Anime{
+		{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 3, LastUpdated: &now},
+		{ID: 2, Title: "Anime2", Status: anisync.Completed, Rating: "4.5"},
+		{ID: 3, Title: "Anime3", Status: anisync.Planned},
+		{ID: 4, Title: "Anime4", Status: anisync.Dropped},
+	}
+	diff := anisync.Compare(left, right)
+
+	v := anisync.Verify(diff, 1, 2, 3, 4, 5)
+
+	if v.AllConverged() {
+		t.Error("Verify AllConverged = true, want false")
+	}
+	if got, want := len(v.Converged), 2; got != want {
+		t.Errorf("Verify returned %d converged anime, want %d", got, want)
+	}
+	want := []anisync.Unconverged{
+		{
+			AniDiff: anisync.AniDiff{
+				Anime:  right[1],
+				Rating: &anisync.RatingDiff{Got: "4.0", Want: "4.5"},
+			},
+			Fields: []string{anisync.FieldRating},
+		},
+		{
+			AniDiff: anisync.AniDiff{Anime: right[2]},
+			Missing: true,
+		},
+	}
+	if got := v.Unconverged; !reflect.DeepEqual(got, want) {
+		t.Errorf("Verify unconverged = \n%+v, want \n%+v", got, want)
+	}
+}
+
+func TestVerify_converged(t *testing.T) {
+	list := []anisync.Anime{{ID: 1, Title: "Anime1", Status: anisync.Current}}
+	v := anisync.Verify(anisync.Compare(list, list), 1)
+	if !v.AllConverged() {
+		t.Errorf("Verify of equal lists returned unconverged anime %+v", v.Unconverged)
+	}
+}
+
+func TestAniDiff_Fields(t *testing.T) {
+	d := anisync.AniDiff{
+		Status:          &anisync.StatusDiff{Got: anisync.Current, Want: anisync.Completed},
+		EpisodesWatched: &anisync.EpisodesWatchedDiff{Got: 1, Want: 2},
+		Rewatching:      &anisync.RewatchingDiff{Got: false, Want: true},
+		LastUpdated:     &anisync.LastUpdatedDiff{Got: before, Want: now},
+	}
+	want := []string{anisync.FieldStatus, anisync.FieldEpisodesWatched, anisync.FieldRewatching}
+	if got := d.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AniDiff.Fields() = %v, want %v", got, want)
+	}
+}
+
+func TestClient_VerifySync_invalidUsername(t *testing.T) {
+	_, err := client.VerifySync("InvalidTestUser", nil, 1)
+	if err == nil {
+		t.Error("VerifySync for invalid user expected to return err")
+	}
+}
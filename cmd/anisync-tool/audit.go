@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/audit"
+)
+
+// exitTampered is the exit status of audit when the chain of the audit log is
+// broken.
+const exitTampered = 4
+
+func auditPath() string {
+	if *auditFlag != "" {
+		return *auditFlag
+	}
+	return configPath("audit.jsonl")
+}
+
+// runAudit verifies the chain of the audit log. With anime IDs as arguments,
+// it also prints the records of the writes of those anime.
+func runAudit() error {
+	path := auditPath()
+	ids := make(map[int]bool)
+	for _, arg := range flag.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid anime ID %q", arg)
+		}
+		ids[id] = true
+	}
+
+	n, verr := audit.Verify(path)
+	if errors.Is(verr, os.ErrNotExist) {
+		fmt.Printf("No audit log found at %s.\n", path)
+		return nil
+	}
+	var cerr *audit.ChainError
+	if verr != nil && !errors.As(verr, &cerr) {
+		return verr
+	}
+	// Records are read even if the chain is broken, up to the first one that
+	// cannot be decoded, to help find out what happened.
+	records, err := audit.Read(path, nil)
+	if err != nil && !errors.As(err, &cerr) {
+		return err
+	}
+
+	if len(ids) != 0 {
+		found := 0
+		for _, r := range records {
+			if ids[r.AnimeID] {
+				printAuditRecord(r)
+				found++
+			}
+		}
+		if found == 0 {
+			fmt.Println("No writes of these anime were audited.")
+		}
+	}
+
+	if verr != nil {
+		return &exitError{code: exitTampered, err: verr}
+	}
+	last := "none"
+	if n != 0 {
+		last = records[n-1].Hash
+	}
+	fmt.Printf("Audit log %s is intact: %d records, last hash %s.\n", path, n, last)
+	return nil
+}
+
+func printAuditRecord(r audit.Record) {
+	status := "-"
+	if r.Status != 0 {
+		status = strconv.Itoa(r.Status)
+	}
+	fmt.Printf("#%-5d %s  %-6s %7d  %-20s status %s  %v\n",
+		r.Seq, r.Time.Local().Format(time.DateTime), r.Op, r.AnimeID, r.MALUsername, status, r.Duration.Round(time.Millisecond))
+	if e := r.Entry; e != nil {
+		fmt.Printf("\t\t|-> status %d, episode %d, score %d, rewatching %d, times rewatched %d\n",
+			e.Status, e.Episode, e.Score, e.EnableRewatching, e.TimesRewatched)
+	}
+	if r.Error != "" {
+		fmt.Printf("\t\t|-> error: %s\n", r.Error)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/anilist"
+	"github.com/nstratos/anisync/anisync/listfile"
+	"github.com/nstratos/anisync/anisync/malxml"
+	"github.com/nstratos/anisync/anisync/shikimori"
+)
+
+// readListFile reads an anime list from a JSON snapshot, CSV or
+// MyAnimeList.net XML list file, gzipped or not.
+func readListFile(path string) ([]anisync.Anime, error) {
+	l, err := listfile.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return l.Anime, nil
+}
+
+// getMALList returns the MyAnimeList.net list, from the file of -mal-file if
+// given.
+func getMALList(c *anisync.Client) ([]anisync.Anime, error) {
+	if *malFileFlag != "" {
+		list, err := readListFile(*malFileFlag)
+		if err != nil {
+			return nil, fmt.Errorf("could not read MyAnimeList.net list file: %v", err)
+		}
+		return list, nil
+	}
+	list, _, err := c.GetMyAnimeList(*malUsername)
+	if err != nil {
+		return nil, fmt.Errorf("could not get MyAnimeList.net anime list %v", err)
+	}
+	return list, nil
+}
+
+// getKitsuList returns the Kitsu.io list, from the file of -kitsu-file if
+// given.
+func getKitsuList(c *anisync.Client) ([]anisync.Anime, error) {
+	if *kitsuFileFlag != "" {
+		list, err := readListFile(*kitsuFileFlag)
+		if err != nil {
+			return nil, fmt.Errorf("could not read Kitsu.io list file: %v", err)
+		}
+		return list, nil
+	}
+	list, _, err := c.GetKitsuAnimeList(*kitsuUserID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get Kitsu.io anime list %v", err)
+	}
+	return list, nil
+}
+
+// getAniList returns the AniList.co list of -anilist-user, leaving out the
+// anime that have no MyAnimeList.net ID.
+func getAniList() ([]anisync.Anime, error) {
+	c := anilist.NewClient(httpClient, "")
+	if aniListBaseURL != nil {
+		c.BaseURL = aniListBaseURL
+	}
+	l, err := c.AnimeList(*aniListUser)
+	if err != nil {
+		return nil, fmt.Errorf("could not get AniList.co anime list: %v", err)
+	}
+	if len(l.Unmapped) != 0 {
+		fmt.Fprintf(os.Stderr, "%d anime of the AniList.co list have no MyAnimeList.net ID and are left out.\n", len(l.Unmapped))
+	}
+	return l.Anime, nil
+}
+
+// getShikimoriList returns the Shikimori.one list of -shikimori-user.
+func getShikimoriList() ([]anisync.Anime, error) {
+	c := shikimori.NewClient(httpClient, "")
+	if shikimoriBaseURL != nil {
+		c.BaseURL = shikimoriBaseURL
+	}
+	list, err := c.AnimeRates(*shikimoriUser)
+	if err != nil {
+		return nil, fmt.Errorf("could not get Shikimori.one anime list: %v", err)
+	}
+	return list, nil
+}
+
+// getSourceList returns the list to sync to MyAnimeList.net, which is the
+// AniList.co list of -anilist-user or the Shikimori.one list of
+// -shikimori-user if given and the Kitsu.io list otherwise.
+func getSourceList(c *anisync.Client) ([]anisync.Anime, error) {
+	switch {
+	case *kitsuFileFlag != "":
+		return getKitsuList(c)
+	case *aniListUser != "":
+		return getAniList()
+	case *shikimoriUser != "":
+		return getShikimoriList()
+	}
+	return getKitsuList(c)
+}
+
+// sourceName returns the name of the list that getSourceList returns, as it
+// is shown next to MyAnimeList.net.
+func sourceName() string {
+	switch {
+	case *kitsuFileFlag != "":
+		return filepath.Base(*kitsuFileFlag)
+	case *aniListUser != "":
+		return "AniList.co"
+	case *shikimoriUser != "":
+		return "Shikimori.one"
+	}
+	return "Kitsu.io"
+}
+
+// sourceAccount returns the provider and user of the list that
+// getSourceList returns, as recorded in the journals and the history. A list
+// file is recorded with its absolute path so that it can be found again.
+func sourceAccount() (provider, user string) {
+	switch {
+	case *kitsuFileFlag != "":
+		path, err := filepath.Abs(*kitsuFileFlag)
+		if err != nil {
+			path = *kitsuFileFlag
+		}
+		return anisync.ProviderFile, path
+	case *aniListUser != "":
+		return anisync.ProviderAniList, *aniListUser
+	case *shikimoriUser != "":
+		return anisync.ProviderShikimori, *shikimoriUser
+	}
+	return anisync.ProviderKitsu, *kitsuUserID
+}
+
+// setSource makes the list of user in provider, as returned by sourceAccount,
+// the one that getSourceList returns.
+func setSource(provider, user string) error {
+	*kitsuFileFlag, *kitsuUserID, *aniListUser, *shikimoriUser = "", "", "", ""
+	switch provider {
+	case anisync.ProviderKitsu:
+		*kitsuUserID = user
+	case anisync.ProviderAniList:
+		*aniListUser = user
+	case anisync.ProviderShikimori:
+		*shikimoriUser = user
+	case anisync.ProviderFile:
+		// The list is read from the file again, which must still be there.
+		if _, err := os.Stat(user); err != nil {
+			return fmt.Errorf("the source list file cannot be read again: %v", err)
+		}
+		*kitsuFileFlag = user
+	default:
+		return fmt.Errorf("unknown source list provider %q", provider)
+	}
+	askSource()
+	return nil
+}
+
+// askSource asks for the Kitsu.io user ID unless the source list is given by
+// -kitsu-file, -anilist-user or -shikimori-user.
+func askSource() {
+	if *kitsuUserID == "" && *kitsuFileFlag == "" && *aniListUser == "" && *shikimoriUser == "" {
+		*kitsuUserID = ask("Enter Kitsu.io user ID: ")
+	}
+}
+
+// runExport writes the list of -from to the file of -o, in the format of its
+// extension and gzipped if its name ends in .gz, or to stdout in the format of
+// -format.
+func runExport() error {
+	format, err := listfile.ParseFormat(*formatFlag)
+	if *outFlag != "" && *outFlag != "-" {
+		format, err = listfile.FormatOf(*outFlag)
+	}
+	if err != nil {
+		return err
+	}
+
+	l := listfile.List{Taken: time.Now().UTC()}
+	c := newClient()
+	switch *fromFlag {
+	case "kitsu":
+		if *kitsuUserID == "" && *kitsuFileFlag == "" {
+			*kitsuUserID = ask("Enter Kitsu.io user ID: ")
+		}
+		l.Provider, l.User = anisync.ProviderKitsu, *kitsuUserID
+		l.Anime, err = getKitsuList(c)
+	case "anilist":
+		if *aniListUser == "" {
+			*aniListUser = ask("Enter AniList.co username: ")
+		}
+		l.Provider, l.User = anisync.ProviderAniList, *aniListUser
+		l.Anime, err = getAniList()
+	case "shikimori":
+		if *shikimoriUser == "" {
+			*shikimoriUser = ask("Enter Shikimori.one nickname: ")
+		}
+		l.Provider, l.User = anisync.ProviderShikimori, *shikimoriUser
+		l.Anime, err = getShikimoriList()
+	case "mal":
+		if *malUsername == "" && *malFileFlag == "" {
+			*malUsername = ask("Enter MyAnimeList.net username: ")
+		}
+		l.Provider, l.User = anisync.ProviderMAL, *malUsername
+		l.Anime, err = getMALList(c)
+	default:
+		return fmt.Errorf("unknown list %q to export, want kitsu, anilist, shikimori or mal", *fromFlag)
+	}
+	if err != nil {
+		return err
+	}
+	if format == listfile.XML && *malUsername != "" {
+		// The file is meant to be imported to this account.
+		l.User = *malUsername
+	}
+
+	if *outFlag == "" || *outFlag == "-" {
+		return listfile.Encode(os.Stdout, format, l)
+	}
+	if err := listfile.Write(*outFlag, l); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d anime to %s.\n", len(l.Anime), *outFlag)
+	if format == listfile.XML {
+		if skipped := len(l.Anime) - len(malxml.MakeFile(l.User, l.Anime).Anime); skipped != 0 {
+			fmt.Printf("%d anime with an unknown status were left out.\n", skipped)
+		}
+	}
+	return nil
+}
+
+// runDiff compares the lists, from the accounts or from list files, and shows
+// what a sync would add and update without writing anything.
+func runDiff(filters []anisync.Filter) error {
+	askSource()
+	if *malUsername == "" && *malFileFlag == "" {
+		*malUsername = ask("Enter MyAnimeList.net username: ")
+	}
+
+	diff, skipped, err := getDiff(newClient(), filters)
+	if err != nil {
+		return err
+	}
+
+	printDiffReport(diff, sourceName())
+	printFilteredReport(skipped)
+	return nil
+}
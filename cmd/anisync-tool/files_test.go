@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+func TestSourceAccountFile(t *testing.T) {
+	defer func(file, id string) { *kitsuFileFlag, *kitsuUserID = file, id }(*kitsuFileFlag, *kitsuUserID)
+	path := filepath.Join(t.TempDir(), "kitsu.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	*kitsuFileFlag, *kitsuUserID = path, "42"
+
+	// A sync from a list file is recorded as one, not as the Kitsu.io user.
+	provider, user := sourceAccount()
+	if provider != anisync.ProviderFile || user != path {
+		t.Fatalf("sourceAccount = %s %q, want %s %q", provider, user, anisync.ProviderFile, path)
+	}
+	if got := sourceName(); got != "kitsu.json" {
+		t.Errorf("sourceName = %q, want %q", got, "kitsu.json")
+	}
+
+	// Verifying reads the file again instead of the Kitsu.io list.
+	if err := setSource(provider, user); err != nil {
+		t.Fatal("setSource returned err:", err)
+	}
+	if *kitsuFileFlag != path || *kitsuUserID != "" {
+		t.Errorf("after setSource -kitsu-file = %q and -kitsuid = %q, want the file only", *kitsuFileFlag, *kitsuUserID)
+	}
+
+	// A file that is gone cannot be verified against.
+	os.Remove(path)
+	if err := setSource(provider, user); err == nil {
+		t.Error("setSource of a removed list file expected to return err")
+	}
+}
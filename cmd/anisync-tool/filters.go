@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+const sinceLayout = "2006-01-02"
+
+// parseFilters creates the sync filters out of the filter options. It returns
+// no filters if none of the filter options have been provided.
+func parseFilters() ([]anisync.Filter, error) {
+	var filters []anisync.Filter
+	if *statusFilter != "" {
+		var statuses []anisync.Status
+		for _, name := range splitList(*statusFilter) {
+			s, err := anisync.ParseStatus(name)
+			if err != nil {
+				return nil, fmt.Errorf("-status: %v", err)
+			}
+			statuses = append(statuses, s)
+		}
+		filters = append(filters, anisync.FilterStatus(statuses...))
+	}
+	if *idsFilter != "" {
+		var ids []int
+		for _, s := range splitList(*idsFilter) {
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("-ids: invalid MyAnimeList ID %q", s)
+			}
+			ids = append(ids, id)
+		}
+		filters = append(filters, anisync.FilterIDs(ids...))
+	}
+	if *sinceFilter != "" {
+		t, err := time.ParseInLocation(sinceLayout, *sinceFilter, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("-since: date must be in the format YYYY-MM-DD: %v", err)
+		}
+		filters = append(filters, anisync.FilterUpdatedSince(t))
+	}
+	if *titleFilter != "" {
+		re, err := regexp.Compile("(?i)" + *titleFilter)
+		if err != nil {
+			return nil, fmt.Errorf("-title: %v", err)
+		}
+		filters = append(filters, anisync.FilterTitle(re))
+	}
+	if *onlyFilter != "" {
+		var categories []anisync.Category
+		for _, s := range splitList(*onlyFilter) {
+			switch strings.ToLower(s) {
+			case "missing":
+				categories = append(categories, anisync.Missing)
+			case "update":
+				categories = append(categories, anisync.NeedUpdate)
+			default:
+				return nil, fmt.Errorf("-only: unknown category %q (use missing or update)", s)
+			}
+		}
+		filters = append(filters, anisync.FilterCategory(categories...))
+	}
+	return filters, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func printFilteredReport(skipped anisync.Diff) {
+	if len(skipped.Missing) == 0 && len(skipped.NeedUpdate) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Filtered out (will not be synced):")
+	for _, m := range skipped.Missing {
+		fmt.Printf("(-x-) %7v \t%v\n", m.ID, m.Title)
+	}
+	for _, u := range skipped.NeedUpdate {
+		fmt.Printf("(<x<) %7v \t%v\n", u.Anime.ID, u.Anime.Title)
+	}
+	fmt.Printf("(-x-) Missing filtered out: %v\n", len(skipped.Missing))
+	fmt.Printf("(<x<) Need update filtered out: %v\n", len(skipped.NeedUpdate))
+}
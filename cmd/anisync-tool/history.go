@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/history"
+)
+
+func historyPath() string {
+	if *historyFlag != "" {
+		return *historyFlag
+	}
+	return configPath("history.jsonl")
+}
+
+func openHistory() (*history.FileStore, error) {
+	retention := history.Retention{MaxRuns: *historyMaxRuns, MaxAge: *historyMaxAge}
+	s, err := history.OpenFileStore(historyPath(), retention)
+	if err != nil {
+		return nil, fmt.Errorf("opening sync history: %v", err)
+	}
+	return s, nil
+}
+
+// recordHistory adds a sync run to the history. The run gets the run ID of
+// its journal, if it has one, so that the two can be matched.
+func recordHistory(source, runID string, started time.Time, result *anisync.SyncResult, err error) error {
+	s, herr := openHistory()
+	if herr != nil {
+		return herr
+	}
+	provider, user := sourceAccount()
+	run := history.MakeRun(source, *malUsername, provider, user, started, result, err)
+	run.ID = runID
+	_, herr = s.Add(run)
+	return herr
+}
+
+// runHistory lists the recorded sync runs, newest first, or shows the run with
+// the ID given as argument.
+func runHistory() error {
+	s, err := openHistory()
+	if err != nil {
+		return err
+	}
+	if flag.NArg() != 0 {
+		run, err := s.Get(flag.Arg(0))
+		if errors.Is(err, history.ErrNotFound) {
+			return fmt.Errorf("no sync run %q in %s", flag.Arg(0), historyPath())
+		}
+		if err != nil {
+			return err
+		}
+		printRun(run)
+		return nil
+	}
+
+	q := history.Query{
+		MALUsername: *malUsername,
+		FailedOnly:  *failedFlag,
+		Limit:       *limitFlag,
+	}
+	if *kitsuUserID != "" || *aniListUser != "" || *shikimoriUser != "" {
+		q.Provider, q.User = sourceAccount()
+	}
+	runs, err := s.List(q)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No sync runs found in %s.\n", historyPath())
+		return nil
+	}
+	for _, r := range runs {
+		failed := ""
+		if r.Failed() {
+			failed = " FAILED"
+		}
+		fmt.Printf("%s  %-6s %-20s %-20s %3d added %3d updated %3d failed%s\n",
+			r.ID, r.Source, r.MALUsername, r.Provider+":"+r.User,
+			r.Counts.Adds, r.Counts.Updates, r.Counts.AddFails+r.Counts.UpdateFails, failed)
+	}
+	return nil
+}
+
+func printRun(r history.Run) {
+	fmt.Printf("Run:      %s (%s)\n", r.ID, r.Source)
+	fmt.Printf("Accounts: %s %q to MyAnimeList.net %q\n", r.Provider, r.User, r.MALUsername)
+	fmt.Printf("Started:  %s, took %v\n", r.Started.Local().Format(time.DateTime), r.Finished.Sub(r.Started).Round(time.Millisecond))
+	fmt.Printf("Result:   %d added, %d updated, %d failed to be added, %d failed to be updated\n",
+		r.Counts.Adds, r.Counts.Updates, r.Counts.AddFails, r.Counts.UpdateFails)
+	if r.Error != "" {
+		fmt.Printf("Error:    %s\n", r.Error)
+	}
+	for _, e := range r.Entries {
+		mark := "(+++)"
+		if e.Op == anisync.JournalUpdate {
+			mark = "(upd)"
+		}
+		if e.Error != "" {
+			mark = "(!!!)"
+		}
+		line := fmt.Sprintf("%s %7v \t%v", mark, e.ID, e.Title)
+		if len(e.Fields) != 0 {
+			line += " [" + strings.Join(e.Fields, ", ") + "]"
+		}
+		if e.Error != "" {
+			line += ": " + e.Error
+		}
+		fmt.Println(line)
+	}
+}
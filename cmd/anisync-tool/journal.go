@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/history"
+)
+
+// configPath returns the path of a file or directory under the anisync
+// directory of the user config directory. If the user config directory is not
+// known, it returns a path relative to the working directory.
+func configPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "anisync-" + name
+	}
+	return filepath.Join(dir, "anisync", name)
+}
+
+func journalDir() string {
+	if *journalFlag != "" {
+		return *journalFlag
+	}
+	return configPath("journal")
+}
+
+// recordJournal saves the journal of a sync and returns its run ID. Nothing is
+// saved and the run ID is empty if the sync did not write anything.
+func recordJournal(diff anisync.Diff, result *anisync.SyncResult) (string, error) {
+	if result == nil || len(result.Adds) == 0 && len(result.Updates) == 0 {
+		return "", nil
+	}
+	runID := history.NewRunID(time.Now())
+	provider, user := sourceAccount()
+	j := anisync.MakeJournal(runID, *malUsername, provider, user, diff, result)
+	if err := saveJournal(journalDir(), j); err != nil {
+		return "", err
+	}
+	return runID, nil
+}
+
+func saveJournal(dir string, j anisync.Journal) error {
+	b, err := json.MarshalIndent(j, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, j.RunID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadJournal(dir, runID string) (anisync.Journal, error) {
+	var j anisync.Journal
+	if runID != filepath.Base(runID) {
+		return j, fmt.Errorf("invalid run ID %q", runID)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, runID+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return j, fmt.Errorf("no journal found for run ID %q in %s", runID, dir)
+	}
+	if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal(b, &j); err != nil {
+		return j, fmt.Errorf("decoding journal %q: %v", runID, err)
+	}
+	return j, nil
+}
+
+func listJournals(dir string) ([]anisync.Journal, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var journals []anisync.Journal
+	for _, p := range paths {
+		j, err := loadJournal(dir, strings.TrimSuffix(filepath.Base(p), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		journals = append(journals, j)
+	}
+	return journals, nil
+}
+
+// runRevert undoes the writes of the sync with the run ID given as argument.
+// Without an argument, it lists the saved journals.
+func runRevert() error {
+	dir := journalDir()
+	if flag.NArg() == 0 {
+		journals, err := listJournals(dir)
+		if err != nil {
+			return err
+		}
+		if len(journals) == 0 {
+			fmt.Printf("No sync journals found in %s.\n", dir)
+			return nil
+		}
+		for _, j := range journals {
+			reverted := ""
+			if j.RevertedAt != nil {
+				reverted = " (reverted " + j.RevertedAt.Local().Format(time.DateTime) + ")"
+			} else if n := revertedEntries(j); n != 0 {
+				reverted = fmt.Sprintf(" (%d reverted)", n)
+			}
+			fmt.Printf("%s  %-20s %3d writes%s\n", j.RunID, j.MALUsername, len(j.Entries), reverted)
+		}
+		return nil
+	}
+
+	j, err := loadJournal(dir, flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	if j.RevertedAt != nil {
+		return fmt.Errorf("run %s has already been reverted at %v", j.RunID, j.RevertedAt.Local())
+	}
+	if *malUsername != "" && *malUsername != j.MALUsername {
+		return fmt.Errorf("run %s synced MyAnimeList.net account %q, not %q", j.RunID, j.MALUsername, *malUsername)
+	}
+	*malUsername = j.MALUsername
+
+	for _, e := range j.Entries {
+		if e.Reverted {
+			continue
+		}
+		switch e.Op {
+		case anisync.JournalAdd:
+			fmt.Printf("(del) %7v \t%v\n", e.After.ID, e.After.Title)
+		case anisync.JournalUpdate:
+			fmt.Printf("(res) %7v \t%v\n", e.After.ID, e.After.Title)
+		}
+	}
+	fmt.Printf("Reverting run %s will delete and restore the above anime on MyAnimeList.net account %q.\n", j.RunID, j.MALUsername)
+	if !confirm() {
+		return nil
+	}
+
+	c, err := authenticate()
+	if err != nil {
+		return err
+	}
+
+	// The journal is saved even if some entries failed, so that reverting
+	// the run again only retries those.
+	res := c.Revert(&j)
+	if err := saveJournal(dir, j); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d restored, %d deleted.\n", len(res.Restored), len(res.Deleted))
+	if len(res.Fails) != 0 {
+		fmt.Printf("%d failed to be reverted.\n", len(res.Fails))
+		for i, f := range res.Fails {
+			fmt.Printf("#%d failed to revert %s (%v %v): %v\n", i+1, f.Op, f.After.ID, f.After.Title, f.Error)
+		}
+		return fmt.Errorf("%d of the writes of run %s failed to be reverted, run revert again to retry them", len(res.Fails), j.RunID)
+	}
+	return nil
+}
+
+// revertedEntries returns the number of entries of j that have been reverted.
+func revertedEntries(j anisync.Journal) int {
+	n := 0
+	for _, e := range j.Entries {
+		if e.Reverted {
+			n++
+		}
+	}
+	return n
+}
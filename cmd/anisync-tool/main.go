@@ -2,17 +2,25 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/nstratos/go-kitsu/kitsu"
 	"github.com/nstratos/go-myanimelist/mal"
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/audit"
+	"github.com/nstratos/anisync/anisync/cassette"
+	"github.com/nstratos/anisync/anisync/notify"
+	"github.com/nstratos/anisync/internal/baseurl"
 )
 
 var (
@@ -21,6 +29,41 @@ var (
 	malPassword = flag.String("malp", "", "MyAnimeList.net password (or set MAL_PASSWORD)")
 	yesFlag     = flag.Bool("y", false, "answer yes in final confirmation")
 	helpFlag    = flag.Bool("help", false, "show detailed help message")
+	noColorFlag = flag.Bool("no-color", false, "do not color the output")
+
+	statusFilter = flag.String("status", "", "only sync anime with these comma separated statuses")
+	idsFilter    = flag.String("ids", "", "only sync anime with these comma separated MyAnimeList IDs")
+	sinceFilter  = flag.String("since", "", "only sync anime updated since this date (YYYY-MM-DD)")
+	titleFilter  = flag.String("title", "", "only sync anime with a title matching this regular expression")
+	onlyFilter   = flag.String("only", "", "only sync anime in these comma separated categories (missing, update)")
+
+	scheduleFlag = flag.String("schedule", "1h", "watch: interval (e.g. 30m) or cron expression (e.g. '0 */6 * * *') of the syncs")
+	stateFlag    = flag.String("state", "", "watch: path of the state file (default is in the user config directory)")
+	malURLFlag   = flag.String("mal-url", "", "base URL of the MyAnimeList.net API, e.g. of a fake server for testing")
+	kitsuURLFlag = flag.String("kitsu-url", "", "base URL of the Kitsu.io API, e.g. of a fake server for testing")
+	recordFlag   = flag.String("record", "", "record the requests to MyAnimeList.net and Kitsu.io, without credentials, to this cassette file")
+	replayFlag   = flag.String("replay", "", "respond to the requests to MyAnimeList.net and Kitsu.io from this cassette file instead of the network")
+	journalFlag  = flag.String("journal", "", "directory of the sync journals used by revert (default is in the user config directory)")
+
+	historyFlag    = flag.String("history", "", "path of the sync history file (default is in the user config directory)")
+	historyMaxRuns = flag.Int("history-max-runs", 1000, "sync runs kept in the history, 0 for no limit")
+	historyMaxAge  = flag.Duration("history-max-age", 90*24*time.Hour, "how long sync runs are kept in the history, 0 for no limit")
+	limitFlag      = flag.Int("limit", 20, "history: number of sync runs to list, 0 for all")
+	failedFlag     = flag.Bool("failed", false, "history: only list the sync runs that failed or had failed writes")
+	smtpAddrFlag   = flag.String("smtp-addr", "", "host:port of the SMTP server of the email notifications")
+	smtpFromFlag   = flag.String("smtp-from", "", "from address of the email notifications")
+	smtpUserFlag   = flag.String("smtp-user", "", "username of the SMTP server, with the password in SMTP_PASSWORD")
+	notifyFlag     = notify.SpecsFlag("notify", "watch: notify trigger:kind:destination of the sync cycles, can be repeated")
+	malFileFlag    = flag.String("mal-file", "", "read the MyAnimeList.net list from this JSON, CSV or XML list file instead of the API")
+	kitsuFileFlag  = flag.String("kitsu-file", "", "read the Kitsu.io list from this JSON, CSV or XML list file instead of the API")
+	fromFlag       = flag.String("from", "kitsu", "export: list to export, kitsu, anilist, shikimori or mal")
+	outFlag        = flag.String("o", "", "export: path of the list file, in the format of its extension and gzipped if it ends in .gz, default is stdout")
+	formatFlag     = flag.String("format", "xml", "export: format of the list written to stdout, json, csv or xml")
+	aniListUser    = flag.String("anilist-user", "", "sync from the AniList.co list of this user instead of the Kitsu.io list")
+	aniListURLFlag = flag.String("anilist-url", "", "URL of the AniList.co GraphQL API, e.g. of a fake server for testing")
+	shikimoriUser  = flag.String("shikimori-user", "", "sync from the Shikimori.one list of this nickname or user ID instead of the Kitsu.io list")
+	shikimoriURL   = flag.String("shikimori-url", "", "base URL of the Shikimori.one API, e.g. of a fake server for testing")
+	auditFlag      = flag.String("audit", "", "path of the audit log of the writes to MyAnimeList.net (default is in the user config directory)")
 )
 
 func findAnimeInListByID(anime, list []anisync.Anime, w io.Writer) {
@@ -40,7 +83,18 @@ func findAnimeInListByID(anime, list []anisync.Anime, w io.Writer) {
 
 const help = `anisync-tool: Sync a Kitsu.io anime list back to MyAnimeList.net.
 
-Usage: anisync-tool [options]...
+Usage: anisync-tool [command] [options]...
+
+Commands:
+
+  sync     compare the lists and sync once (default)
+  watch    keep syncing on a schedule until stopped
+  revert   undo the writes of a previous sync, given its run ID
+  verify   check that the writes of a previous sync converged
+  history  list the previous syncs, or show one of them given its run ID
+  audit    verify the audit log and show the writes of the given anime IDs
+  diff     compare the lists, of the accounts or of list files, without syncing
+  export   write a list to a JSON, CSV or MyAnimeList.net XML list file
 
 Options:
 
@@ -49,6 +103,155 @@ Options:
   -malp    MyAnimeList.net password
   -y       answer yes in final confirmation
   -help    show detailed help message
+  -no-color  do not color the output (also disabled by setting NO_COLOR)
+  -mal-url   base URL of the MyAnimeList.net API, such as the one of a fake
+             server of the anisynctest package, default is the real one
+  -kitsu-url base URL of the Kitsu.io API, default is the real one
+  -anilist-url URL of the AniList.co GraphQL API, default is the real one
+  -shikimori-url base URL of the Shikimori.one API, default is the real one
+  -record    record the requests to MyAnimeList.net and Kitsu.io to this
+             cassette file, with the credentials scrubbed, to attach it to a
+             bug report
+  -replay    respond to the requests from this cassette file instead of the
+             network, to reproduce a recorded run offline
+
+AniList.co options:
+
+  -anilist-user sync from the AniList.co list of this user instead of the
+                Kitsu.io list. The anime are matched by the MyAnimeList.net
+                IDs that AniList.co keeps; the anime without one are left out.
+
+The scores of AniList.co are converted from the score format of the user to
+ratings in steps of half a star, and rewatching anime are currently watching
+and rewatching on MyAnimeList.net.
+
+Shikimori.one options:
+
+  -shikimori-user sync from the Shikimori.one list of this nickname or user
+                  ID instead of the Kitsu.io list. Shikimori.one uses the
+                  MyAnimeList.net IDs, so every anime can be matched.
+
+Rewatching anime on Shikimori.one are currently watching and rewatching on
+MyAnimeList.net, like the ones of AniList.co.
+
+The anime that are missing or need update are shown in a table which has the
+MyAnimeList.net and the Kitsu.io side of each anime next to each other. On a
+terminal the fields that differ are colored, otherwise they are marked with *.
+
+Filter options:
+
+  -status  only sync anime with these comma separated statuses
+           (current, planned, completed, onhold, dropped)
+  -ids     only sync anime with these comma separated MyAnimeList IDs
+  -since   only sync anime updated on Kitsu.io since this date (YYYY-MM-DD)
+  -title   only sync anime with a title matching this regular expression
+           (case insensitive)
+  -only    only sync anime in these comma separated categories
+           (missing, update)
+
+List file options:
+
+  -mal-file   read the MyAnimeList.net list from a list file instead of the
+              API, to compare offline. Nothing is synced.
+  -kitsu-file read the Kitsu.io list from a list file instead of the API, e.g.
+              to restore a backup
+  -from       list that export writes, kitsu (default), anilist, shikimori
+              or mal
+  -o          path of the file that export writes, default is stdout
+  -format     format of the list that export writes to stdout, json, csv or
+              xml (default)
+
+The format of a list file is chosen by its extension:
+
+  .json  a snapshot of anisync, with every field of the list and the account
+         it came from
+  .csv   a header of id,title,status,episodes_watched,episodes,rating,
+         times_rewatched,rewatching,last_updated,notes,image and one anime per
+         line. When read, the columns may be in any order and only id and
+         status are required.
+  .xml   the format of the export and import of MyAnimeList.net, so an
+         exported Kitsu.io list can be imported to MyAnimeList.net by hand
+
+Files whose name also ends in .gz are gzipped.
+
+The diff command shows the same table as sync and what a sync would add and
+update, but never asks for a password nor writes anything. Either list can come
+from a file or from an account.
+
+Every sync that writes to MyAnimeList.net saves a journal with the state of
+each entry before the sync and prints its run ID.
+
+  -journal  directory of the sync journals, default is anisync/journal in the
+            user config directory
+
+Running revert with a run ID restores the updated entries to their state
+before that sync and deletes the newly added ones. Comments cannot be restored
+as the MyAnimeList.net API does not return them. If some writes fail to be
+reverted, revert exits with an error and running it again retries only those.
+Running revert without a run ID lists the saved journals.
+
+Running verify fetches the MyAnimeList.net list and the list that the sync
+was from again and reports the anime written by the sync which are still
+missing or still differ, along with the fields that failed to stick. It
+verifies the latest sync unless a run ID is given. It exits with status 3 when
+some anime did not converge.
+
+Every sync and every watch cycle is also recorded in the sync history with its
+accounts, times, counts and the outcome of each anime that was written. The
+runs that wrote to MyAnimeList.net have the run ID of their journal.
+
+History options:
+
+  -history          path of the history file, default is anisync/history.jsonl
+                    in the user config directory
+  -history-max-runs sync runs kept in the history, default 1000, 0 for no limit
+  -history-max-age  how long sync runs are kept, default 2160h (90 days), 0 for
+                    no limit
+  -limit            number of sync runs that history lists, default 20
+  -failed           only list the sync runs that failed or had failed writes
+
+The history command lists the runs of the accounts given by -malu and by
+-kitsuid, -anilist-user or -shikimori-user, or of all accounts if they are not
+given.
+
+Every write to MyAnimeList.net, by sync, watch or revert, is appended to an
+audit log with the entry that was sent, the status of the response and how long
+it took. Each record holds the hash of the one before it, so that changes to
+the log can be detected.
+
+  -audit  path of the audit log, default is anisync/audit.jsonl in the user
+          config directory
+
+Running audit verifies the chain of the audit log and prints the hash of its
+last record, which can be noted down to later detect records removed from the
+end. Given anime IDs, it also prints the records of their writes. It exits with
+status 4 when the chain is broken.
+
+Watch options:
+
+  -schedule  interval such as 30m or cron expression such as '0 */6 * * *'
+             (minute hour day-of-month month day-of-week) of the syncs,
+             default 1h
+  -state     path of the file where watch keeps the last run, default is
+             anisync/watch.json in the user config directory
+  -notify    notify trigger:kind:destination about the cycles, can be
+             repeated. The trigger is always, change (the cycles that wrote
+             something or failed) or failure (the cycles that failed or had
+             failed writes). The kind is webhook (the cycle as JSON), chat (a
+             message as the text of a JSON object, as Slack and Mattermost
+             expect), discord (the message as content) or email (comma
+             separated addresses).
+  -smtp-addr host:port of the SMTP server of the email notifications
+  -smtp-from from address of the email notifications
+  -smtp-user username of the SMTP server, the password is taken from the
+             SMTP_PASSWORD environment variable
+
+The watch command never asks for confirmation, so all the credentials must be
+provided through options or environment variables. It syncs from the same
+source lists as sync: Kitsu.io by default, or the list of -anilist-user,
+-shikimori-user or -kitsu-file. It writes one log line per cycle to stderr and
+backs off exponentially (up to an hour) while the cycles fail. It stops after
+the running cycle on SIGINT or SIGTERM.
 
 By default, the program will ask for any credentials not provided by the
 options and will ask for confirmation one final time before syncing. The -y
@@ -73,27 +276,129 @@ Examples:
   All the credentials are provided through environment variables. The program
   will ask for confirmation before syncing.
 
+% anisync-tool -kitsuid='AnimeFan' -status=current -since=2026-07-01
+
+  Only the currently watching anime that were updated on Kitsu.io since July
+  1st will be synced. The rest will be reported as filtered out.
+
+% anisync-tool watch -schedule='0 */6 * * *' -kitsuid='AnimeFan' -malu='AnimeFan' -malp='password'
+
+  Syncs every six hours until the program is stopped.
+
+% anisync-tool watch -notify='failure:chat:https://hooks.slack.com/services/...' -kitsuid='AnimeFan' -malu='AnimeFan' -malp='password'
+
+  Syncs every hour and posts a message to a Slack channel when a cycle fails.
+
+% anisync-tool revert -malp='password' 20261019T101500Z
+
+  Undoes the sync with run ID 20261019T101500Z after asking for confirmation.
+
+% anisync-tool export -kitsuid='AnimeFan' -o=kitsu.xml.gz
+
+  Writes the Kitsu.io list to a gzipped MyAnimeList.net XML list file.
+
+% anisync-tool export -kitsuid='AnimeFan' -o=kitsu.json
+
+  Writes a snapshot of the Kitsu.io list to take on a flight.
+
+% anisync-tool diff -mal-file=animelist.xml -kitsu-file=kitsu.json
+
+  Compares two list files offline.
+
+% anisync-tool diff -kitsu-file=kitsu.csv -malu='AnimeFan'
+
+  Compares a hand edited list to the MyAnimeList.net account without syncing.
+
+% anisync-tool diff -anilist-user='AnimeFan' -malu='AnimeFan'
+
+  Shows what a sync from the AniList.co list would write.
+
+% anisync-tool -shikimori-user='AnimeFan' -malu='AnimeFan'
+
+  Syncs the Shikimori.one list to MyAnimeList.net.
+
+% anisync-tool audit 21 1735
+
+  Verifies the audit log and shows every write of the anime with
+  MyAnimeList.net IDs 21 and 1735.
+
+% anisync-tool history -failed -limit=5
+
+  Lists the last five syncs that failed or had failed writes.
+
 `
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage: anisync-tool [options]...")
+		fmt.Fprintln(os.Stderr, "Usage: anisync-tool [command] [options]...")
 		flag.PrintDefaults()
 	}
-	flag.Parse()
+	command, args := "sync", os.Args[1:]
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
-	if err := run(); err != nil {
+	if err := run(command); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		var e *exitError
+		if errors.As(err, &e) {
+			os.Exit(e.code)
+		}
 		os.Exit(1)
 	}
 }
 
-func run() error {
+// exitError is an error that makes the program exit with a specific code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+func run(command string) error {
 	if *helpFlag {
 		fmt.Fprint(os.Stderr, help)
 		os.Exit(2)
 	}
 
+	filters, err := parseFilters()
+	if err != nil {
+		return err
+	}
+	if malBaseURL, err = baseurl.Parse(*malURLFlag); err != nil {
+		return fmt.Errorf("parsing -mal-url: %v", err)
+	}
+	if kitsuBaseURL, err = baseurl.Parse(*kitsuURLFlag); err != nil {
+		return fmt.Errorf("parsing -kitsu-url: %v", err)
+	}
+	if aniListBaseURL, err = baseurl.Parse(*aniListURLFlag); err != nil {
+		return fmt.Errorf("parsing -anilist-url: %v", err)
+	}
+	if shikimoriBaseURL, err = baseurl.Parse(*shikimoriURL); err != nil {
+		return fmt.Errorf("parsing -shikimori-url: %v", err)
+	}
+	if *aniListUser != "" && *shikimoriUser != "" {
+		return fmt.Errorf("-anilist-user and -shikimori-user cannot be used together")
+	}
+	switch {
+	case *recordFlag != "" && *replayFlag != "":
+		return fmt.Errorf("-record and -replay cannot be used together")
+	case *recordFlag != "":
+		httpClient = &http.Client{Transport: cassette.NewRecorder(*recordFlag, nil)}
+	case *replayFlag != "":
+		r, err := cassette.NewReplayer(*replayFlag)
+		if err != nil {
+			return fmt.Errorf("loading cassette: %v", err)
+		}
+		httpClient = &http.Client{Transport: r}
+	}
+
+	if notifyTargets, err = parseNotifyTargets(); err != nil {
+		return err
+	}
+
 	if *kitsuUserID == "" {
 		*kitsuUserID = os.Getenv("KITSU_USER_ID")
 	}
@@ -104,78 +409,182 @@ func run() error {
 		*malPassword = os.Getenv("MAL_PASSWORD")
 	}
 
-	if *kitsuUserID == "" {
-		sc := bufio.NewScanner(os.Stdin)
-		fmt.Print("Enter Kitsu.io user ID: ")
-		sc.Scan()
-		*kitsuUserID = sc.Text()
+	switch command {
+	case "sync", "watch", "revert":
+		// Only the commands that write to MyAnimeList.net are audited.
+		if auditLog, err = audit.Open(auditPath()); err != nil {
+			return fmt.Errorf("opening audit log: %v", err)
+		}
 	}
 
-	if *malUsername == "" {
-		sc := bufio.NewScanner(os.Stdin)
-		fmt.Print("Enter MyAnimeList.net username: ")
-		sc.Scan()
-		*malUsername = sc.Text()
+	switch command {
+	case "sync":
+		return runSync(filters)
+	case "watch":
+		return runWatch(filters)
+	case "revert":
+		return runRevert()
+	case "verify":
+		return runVerify()
+	case "history":
+		return runHistory()
+	case "audit":
+		return runAudit()
+	case "export":
+		return runExport()
+	case "diff":
+		return runDiff(filters)
+	default:
+		return fmt.Errorf("unknown command %q (see -help)", command)
 	}
+}
 
-	resources := anisync.NewResources(
-		mal.NewClient(mal.Auth(*malUsername, *malPassword)),
-		kitsu.NewClient(nil),
-	)
-	c := anisync.NewClient(resources)
+func runSync(filters []anisync.Filter) error {
+	askSource()
 
-	myAnimeList, _, err := c.GetMyAnimeList(*malUsername)
-	if err != nil {
-		return fmt.Errorf("could not get MyAnimeList.net anime list %v", err)
+	if *malUsername == "" {
+		*malUsername = ask("Enter MyAnimeList.net username: ")
 	}
 
-	kitsuList, _, err := c.GetKitsuAnimeList(*kitsuUserID)
+	c := newClient()
+
+	diff, skipped, err := getDiff(c, filters)
 	if err != nil {
-		return fmt.Errorf("could not get Kitsu.io anime list %v", err)
+		return err
 	}
 
-	diff := anisync.Compare(myAnimeList, kitsuList)
-
-	printDiffReport(*diff)
+	printDiffReport(diff, sourceName())
+	printFilteredReport(skipped)
 
 	if len(diff.Missing) == 0 && len(diff.NeedUpdate) == 0 {
 		fmt.Printf("No anime need to be added or updated in MyAnimeList.net account %q.\n", *malUsername)
 		return nil
 	}
-
-	proceed := false
-	if !*yesFlag {
-		sc := bufio.NewScanner(os.Stdin)
-		fmt.Printf("Do you want to continue? [y/N] ")
-		sc.Scan()
-		answer := sc.Text()
-		proceed = strings.HasPrefix(strings.ToLower(answer), "y")
-	} else {
-		proceed = true
+	if *malFileFlag != "" {
+		fmt.Println("The MyAnimeList.net list was read from a file, nothing will be synced.")
+		return nil
 	}
-	// nothing to do
-	if !proceed {
+
+	if !confirm() {
 		return nil
 	}
 
+	c, err = authenticate()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Starting Update...")
+
+	started := time.Now()
+	syncResult := c.SyncMALAnime(diff)
+
+	printSyncResult(syncResult)
+
+	runID, err := recordJournal(diff, syncResult)
+	if err != nil {
+		return fmt.Errorf("could not save sync journal: %v", err)
+	}
+	if err := recordHistory("cli", runID, started, syncResult, nil); err != nil {
+		return fmt.Errorf("could not save sync history: %v", err)
+	}
+	if runID != "" {
+		fmt.Printf("Sync journal saved. To undo this sync run: anisync-tool revert %s\n", runID)
+	}
+
+	return nil
+}
+
+func ask(prompt string) string {
+	sc := bufio.NewScanner(os.Stdin)
+	fmt.Print(prompt)
+	sc.Scan()
+	return sc.Text()
+}
+
+// confirm asks the user for confirmation unless -y was provided.
+func confirm() bool {
+	if *yesFlag {
+		return true
+	}
+	sc := bufio.NewScanner(os.Stdin)
+	fmt.Printf("Do you want to continue? [y/N] ")
+	sc.Scan()
+	answer := sc.Text()
+	return strings.HasPrefix(strings.ToLower(answer), "y")
+}
+
+// authenticate asks for the MyAnimeList.net password if it has not been
+// provided, verifies the credentials and returns a client that uses them.
+func authenticate() (*anisync.Client, error) {
 	if *malPassword == "" {
 		fmt.Printf("Enter MyAnimeList.net password for username %v:\n", *malUsername)
 		pass, err := terminal.ReadPassword(0)
 		if err != nil {
-			return fmt.Errorf("reading password: %v", err)
+			return nil, fmt.Errorf("reading password: %v", err)
 		}
 		*malPassword = string(pass)
 	}
 
+	c := newClient()
 	if _, _, err := c.VerifyMALCredentials(*malUsername, *malPassword); err != nil {
-		return fmt.Errorf("MyAnimeList.net username and password do not match")
+		return nil, fmt.Errorf("MyAnimeList.net username and password do not match")
 	}
 	fmt.Println("Verification was successful!")
+	return c, nil
+}
 
-	fmt.Println("Starting Update...")
+// The base URLs of the APIs given by -mal-url and -kitsu-url, nil for the
+// real ones.
+var malBaseURL, kitsuBaseURL *url.URL
+
+// The URLs of the AniList.co and Shikimori.one APIs given by -anilist-url and
+// -shikimori-url, nil for the real ones.
+var aniListBaseURL, shikimoriBaseURL *url.URL
 
-	syncResult := c.SyncMALAnime(*diff)
+// httpClient sends the requests to the APIs. It records or replays them with
+// -record and -replay.
+var httpClient = http.DefaultClient
 
+// auditLog records the writes to MyAnimeList.net of the clients of newClient.
+// It is nil for the commands that do not write.
+var auditLog *audit.Log
+
+func newClient() *anisync.Client {
+	malClient := mal.NewClient(mal.Auth(*malUsername, *malPassword), mal.HTTPClient(httpClient))
+	if malBaseURL != nil {
+		malClient.BaseURL = malBaseURL
+	}
+	kitsuClient := kitsu.NewClient(httpClient)
+	if kitsuBaseURL != nil {
+		kitsuClient.BaseURL = kitsuBaseURL
+	}
+	r := anisync.NewResources(malClient, kitsuClient)
+	if auditLog != nil {
+		r = audit.Wrap(r, auditLog, *malUsername)
+	}
+	return anisync.NewClient(r)
+}
+
+// getDiff gets both anime lists, compares them and applies the filters to the
+// difference. It returns the difference that should be synced and the one that
+// was filtered out.
+func getDiff(c *anisync.Client, filters []anisync.Filter) (diff, skipped anisync.Diff, err error) {
+	myAnimeList, err := getMALList(c)
+	if err != nil {
+		return diff, skipped, err
+	}
+
+	kitsuList, err := getSourceList(c)
+	if err != nil {
+		return diff, skipped, err
+	}
+
+	diff, skipped = anisync.FilterDiff(*anisync.Compare(myAnimeList, kitsuList), filters...)
+	return diff, skipped, nil
+}
+
+func printSyncResult(syncResult *anisync.SyncResult) {
 	fmt.Printf("%d updated, %d newly added.\n", len(syncResult.Updates), len(syncResult.Adds))
 	if len(syncResult.UpdateFails) != 0 {
 		fmt.Printf("%d failed to be updated.\n", len(syncResult.UpdateFails))
@@ -189,27 +598,27 @@ func run() error {
 			fmt.Printf("#%d failed to add (%v %v): %v\n", i+1, addf.Anime.ID, addf.Anime.Title, addf.Error)
 		}
 	}
-
-	return nil
 }
 
-func printDiffReport(diff anisync.Diff) {
+// printDiffReport shows the anime of diff, with source as the name of the list
+// that is synced from.
+func printDiffReport(diff anisync.Diff, source string) {
 	for _, u := range diff.UpToDate {
 		fmt.Printf("(===) %7v \t%v\n", u.ID, u.Title)
 	}
+	t := newDiffTable(useColor(os.Stdout), source)
 	for _, u := range diff.Uncertain {
-		fmt.Printf("( < ) %7v \t%v\n", u.Anime.ID, u.Anime.Title)
-		printAniDiff(u)
+		t.addAnime("( < )", anisync.FindByID(diff.Left, u.Anime.ID), u)
 	}
 	for _, m := range diff.Missing {
-		fmt.Printf("(---) %7v \t%v\n", m.ID, m.Title)
+		t.addAnime("(---)", nil, anisync.AniDiff{Anime: m})
 	}
 	for _, u := range diff.NeedUpdate {
-		fmt.Printf("(<<<) %7v \t%v\n", u.Anime.ID, u.Anime.Title)
-		printAniDiff(u)
+		t.addAnime("(<<<)", anisync.FindByID(diff.Left, u.Anime.ID), u)
 	}
+	t.render(os.Stdout)
 	fmt.Println()
-	fmt.Printf("Kitsu entries: %v\n", len(diff.Right))
+	fmt.Printf("%s entries: %v\n", source, len(diff.Right))
 	fmt.Printf("MyAnimelist entries: %v\n", len(diff.Left))
 	fmt.Printf("(===) Up to date: %v\n", len(diff.UpToDate))
 	fmt.Printf("( < ) Okay: %v\n", len(diff.Uncertain))
@@ -218,21 +627,3 @@ func printDiffReport(diff anisync.Diff) {
 	fmt.Println("After this operation, there will be:")
 	fmt.Printf("%v updated and %v newly added anime on MyAnimeList.net account %q.\n", len(diff.NeedUpdate), len(diff.Missing), *malUsername)
 }
-
-func printAniDiff(d anisync.AniDiff) {
-	if d.Status != nil {
-		fmt.Printf("\t\t|-> Status: got %v, want %v\n", d.Status.Got, d.Status.Want)
-	}
-	if d.EpisodesWatched != nil {
-		fmt.Printf("\t\t|-> EpisodesWatched: got %v, want %v\n", d.EpisodesWatched.Got, d.EpisodesWatched.Want)
-	}
-	if d.Rating != nil {
-		fmt.Printf("\t\t|-> Rating: got %v, want %v\n", d.Rating.Got, d.Rating.Want)
-	}
-	if d.Rewatching != nil {
-		fmt.Printf("\t\t|-> Rewatching: got %v, want %v\n", d.Rewatching.Got, d.Rewatching.Want)
-	}
-	if d.LastUpdated != nil {
-		fmt.Printf("\t\t|-> LastUpdated: got %v, want %v\n", d.LastUpdated.Got.Local(), d.LastUpdated.Want.Local())
-	}
-}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/notify"
+)
+
+// notifyTimeout is how long the notifications of a cycle can take.
+const notifyTimeout = 30 * time.Second
+
+// notifyTargets are the targets of -notify, told about the watch cycles.
+var notifyTargets notify.Targets
+
+func parseNotifyTargets() (notify.Targets, error) {
+	smtp := notify.SMTPConfig{
+		Addr:     *smtpAddrFlag,
+		From:     *smtpFromFlag,
+		User:     *smtpUserFlag,
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+	return smtp.Targets(*notifyFlag)
+}
+
+func sendNotifications(e notify.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	return notifyTargets.Notify(ctx, e)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorBold  = "\x1b[1m"
+
+	maxTitleWidth = 32
+)
+
+// useColor reports whether the output written to f should be colored. Colors
+// are only used on terminals and can be disabled with -no-color or by setting
+// the NO_COLOR environment variable.
+func useColor(f *os.File) bool {
+	if *noColorFlag || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+// diffTable renders the anime of a Diff as a table which shows the
+// MyAnimeList.net side and the source list side of each anime next to each
+// other.
+type diffTable struct {
+	color bool
+	now   time.Time
+	rows  [][]cell
+}
+
+type cell struct {
+	text    string
+	changed bool
+	side    int // 0 for no side, 1 for MyAnimeList.net and 2 for the source list.
+}
+
+// newDiffTable returns an empty table whose source list column is headed by
+// source, the name of the list that is synced from.
+func newDiffTable(color bool, source string) *diffTable {
+	t := &diffTable{color: color, now: time.Now()}
+	t.rows = append(t.rows, []cell{{text: ""}, {text: "ID"}, {text: "Title"}, {text: "Field"}, {text: "MyAnimeList.net"}, {text: source}})
+	return t
+}
+
+// addAnime adds the rows of an anime. The left anime is the one found on
+// MyAnimeList.net and it is nil when the anime is missing. The right one is
+// the anime of d, from the source list.
+func (t *diffTable) addAnime(marker string, left *anisync.Anime, d anisync.AniDiff) {
+	right := d.Anime
+	fields := []struct {
+		name        string
+		left, right string
+		changed     bool
+	}{
+		{"Status", "", right.Status.String(), d.Status != nil},
+		{"Episodes", "", episodes(right), d.EpisodesWatched != nil},
+		{"Rating", "", rating(right.Rating), d.Rating != nil},
+		{"Rewatching", "", yesNo(right.Rewatching), d.Rewatching != nil},
+		{"Updated", "", t.relative(right.LastUpdated), d.LastUpdated != nil},
+	}
+	if left != nil {
+		fields[0].left = left.Status.String()
+		fields[1].left = episodes(*left)
+		fields[2].left = rating(left.Rating)
+		fields[3].left = yesNo(left.Rewatching)
+		fields[4].left = t.relative(left.LastUpdated)
+	} else {
+		for i := range fields {
+			fields[i].left = "-"
+			fields[i].changed = true
+		}
+	}
+	for i, f := range fields {
+		row := []cell{{text: ""}, {text: ""}, {text: ""}}
+		if i == 0 {
+			row = []cell{{text: marker}, {text: fmt.Sprint(right.ID)}, {text: truncate(right.Title, maxTitleWidth)}}
+		}
+		name := f.name
+		if !t.color {
+			name = "  " + name
+			if f.changed {
+				name = "* " + f.name
+			}
+		}
+		row = append(row,
+			cell{text: name},
+			cell{text: f.left, changed: f.changed, side: 1},
+			cell{text: f.right, changed: f.changed, side: 2},
+		)
+		t.rows = append(t.rows, row)
+	}
+}
+
+func (t *diffTable) render(w io.Writer) {
+	if len(t.rows) == 1 {
+		return
+	}
+	fmt.Fprintln(w)
+	widths := make([]int, len(t.rows[0]))
+	for _, row := range t.rows {
+		for i, c := range row {
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for r, row := range t.rows {
+		var b strings.Builder
+		for i, c := range row {
+			text := c.text
+			if i != len(row)-1 {
+				text += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c.text)+2)
+			}
+			b.WriteString(t.paint(text, c, r == 0))
+		}
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+	}
+}
+
+func (t *diffTable) paint(text string, c cell, header bool) string {
+	switch {
+	case !t.color:
+		return text
+	case header:
+		return colorBold + text + colorReset
+	case c.changed && c.side == 1:
+		return colorRed + text + colorReset
+	case c.changed && c.side == 2:
+		return colorGreen + text + colorReset
+	default:
+		return text
+	}
+}
+
+// relative formats t relative to the time the table was created, for example
+// "3 hours ago".
+func (t *diffTable) relative(tm *time.Time) string {
+	if tm == nil {
+		return "-"
+	}
+	d := t.now.Sub(*tm)
+	suffix := "ago"
+	if d < 0 {
+		d, suffix = -d, "from now"
+	}
+	var n int
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		n, unit = int(d/(24*time.Hour)), "day"
+	case d < 365*24*time.Hour:
+		n, unit = int(d/(30*24*time.Hour)), "month"
+	default:
+		n, unit = int(d/(365*24*time.Hour)), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s %s", n, unit, suffix)
+}
+
+func episodes(a anisync.Anime) string {
+	if a.Episodes == 0 {
+		return fmt.Sprintf("%d/?", a.EpisodesWatched)
+	}
+	return fmt.Sprintf("%d/%d", a.EpisodesWatched, a.Episodes)
+}
+
+func rating(r string) string {
+	if r == "" || r == "0.0" {
+		return "-"
+	}
+	return r
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+func TestDiffTable(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-3*time.Hour), now.Add(-90*time.Second)
+	left := anisync.Anime{ID: 1, Title: "Cowboy Bebop", Status: anisync.Completed, EpisodesWatched: 26, Episodes: 26, Rating: "4.0", LastUpdated: &before}
+	right := anisync.Anime{ID: 1, Title: "Cowboy Bebop", Status: anisync.Current, EpisodesWatched: 3, Episodes: 26, Rating: "4.0", Rewatching: true, LastUpdated: &after}
+	missing := anisync.Anime{ID: 30, Title: "Neon Genesis Evangelion: The End of Evangelion", Status: anisync.Planned}
+
+	tbl := &diffTable{now: now}
+	tbl.rows = newDiffTable(false, "Kitsu.io").rows
+	tbl.addAnime("( < )", &left, anisync.AniDiff{
+		Anime:           right,
+		Status:          &anisync.StatusDiff{Got: left.Status, Want: right.Status},
+		EpisodesWatched: &anisync.EpisodesWatchedDiff{Got: 26, Want: 3},
+		Rewatching:      &anisync.RewatchingDiff{Got: false, Want: true},
+		LastUpdated:     &anisync.LastUpdatedDiff{Got: before, Want: after},
+	})
+	tbl.addAnime("(---)", nil, anisync.AniDiff{Anime: missing})
+	var buf bytes.Buffer
+	tbl.render(&buf)
+
+	want := `
+       ID  Title                             Field         MyAnimeList.net  Kitsu.io
+( < )  1   Cowboy Bebop                      * Status      Completed        Currently watching
+                                             * Episodes    26/26            3/26
+                                               Rating      4.0              4.0
+                                             * Rewatching  no               yes
+                                             * Updated     3 hours ago      1 minute ago
+(---)  30  Neon Genesis Evangelion: The En…  * Status      -                Plan to watch
+                                             * Episodes    -                0/?
+                                             * Rating      -                -
+                                             * Rewatching  -                no
+                                             * Updated     -                -
+`
+	if got := buf.String(); got != want {
+		t.Errorf("render =\n%s\nwant\n%s", got, want)
+	}
+
+	// An empty table renders nothing.
+	buf.Reset()
+	newDiffTable(false, "Kitsu.io").render(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("render of empty table = %q, want nothing", buf.String())
+	}
+}
+
+func TestDiffTableSource(t *testing.T) {
+	tbl := newDiffTable(false, "AniList.co")
+	tbl.addAnime("(---)", nil, anisync.AniDiff{Anime: anisync.Anime{ID: 1, Title: "Trigun"}})
+	var buf bytes.Buffer
+	tbl.render(&buf)
+	header, _, _ := strings.Cut(strings.TrimPrefix(buf.String(), "\n"), "\n")
+	if !strings.HasSuffix(header, "MyAnimeList.net  AniList.co") || strings.Contains(buf.String(), "Kitsu.io") {
+		t.Errorf("header of an AniList.co diff = %q, want the AniList.co column next to MyAnimeList.net", header)
+	}
+}
+
+func TestDiffTableColor(t *testing.T) {
+	tbl := newDiffTable(true, "Kitsu.io")
+	a := anisync.Anime{ID: 1, Title: "Trigun", Rewatching: true}
+	tbl.addAnime("( < )", &anisync.Anime{ID: 1, Title: "Trigun"}, anisync.AniDiff{
+		Anime:      a,
+		Rewatching: &anisync.RewatchingDiff{Got: false, Want: true},
+	})
+	var buf bytes.Buffer
+	tbl.render(&buf)
+	for _, want := range []string{colorRed + "no", colorGreen + "yes", colorBold + "Field"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("render with color = %q, want it to contain %q", buf.String(), want)
+		}
+	}
+}
+
+func TestRelative(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tbl := &diffTable{now: now}
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{10 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{5 * time.Hour, "5 hours ago"},
+		{-2 * 24 * time.Hour, "2 days from now"},
+		{60 * 24 * time.Hour, "2 months ago"},
+		{400 * 24 * time.Hour, "1 year ago"},
+	}
+	for _, tt := range tests {
+		tm := now.Add(-tt.d)
+		if got := tbl.relative(&tm); got != tt.want {
+			t.Errorf("relative(now - %v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+	if got := tbl.relative(nil); got != "-" {
+		t.Errorf("relative(nil) = %q, want %q", got, "-")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// exitUnconverged is the exit status of verify when some of the anime written
+// by a sync did not converge.
+const exitUnconverged = 3
+
+// runVerify checks that the anime written by the sync with the run ID given as
+// argument converged. Without an argument, it verifies the latest sync.
+func runVerify() error {
+	dir := journalDir()
+	var j anisync.Journal
+	if flag.NArg() != 0 {
+		var err error
+		if j, err = loadJournal(dir, flag.Arg(0)); err != nil {
+			return err
+		}
+	} else {
+		journals, err := listJournals(dir)
+		if err != nil {
+			return err
+		}
+		if len(journals) == 0 {
+			return fmt.Errorf("no sync journals found in %s", dir)
+		}
+		j = journals[len(journals)-1]
+	}
+	if *malUsername != "" && *malUsername != j.MALUsername {
+		return fmt.Errorf("run %s synced MyAnimeList.net account %q, not %q", j.RunID, j.MALUsername, *malUsername)
+	}
+	*malUsername = j.MALUsername
+	// The anime are compared to the list that the run synced from.
+	if err := setSource(j.Provider, j.User); err != nil {
+		return fmt.Errorf("cannot verify run %s: %v", j.RunID, err)
+	}
+
+	c := newClient()
+	source, err := getSourceList(c)
+	if err != nil {
+		return err
+	}
+	v, err := c.VerifySync(*malUsername, source, j.IDs()...)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range v.Unconverged {
+		if u.Missing {
+			fmt.Printf("(!!!) %7v \t%v: still missing\n", u.Anime.ID, u.Anime.Title)
+			continue
+		}
+		fmt.Printf("(!!!) %7v \t%v: %s did not stick\n", u.Anime.ID, u.Anime.Title, strings.Join(u.Fields, ", "))
+		printFieldDiffs(u.AniDiff)
+	}
+	if !v.AllConverged() {
+		err := fmt.Errorf("%d of %d anime written by run %s did not converge", len(v.Unconverged), len(j.Entries), j.RunID)
+		return &exitError{code: exitUnconverged, err: err}
+	}
+	fmt.Printf("All %d anime written by run %s converged.\n", len(v.Converged), j.RunID)
+	return nil
+}
+
+func printFieldDiffs(d anisync.AniDiff) {
+	if d.Status != nil {
+		fmt.Printf("\t\t|-> %s: got %v, want %v\n", anisync.FieldStatus, d.Status.Got, d.Status.Want)
+	}
+	if d.EpisodesWatched != nil {
+		fmt.Printf("\t\t|-> %s: got %v, want %v\n", anisync.FieldEpisodesWatched, d.EpisodesWatched.Got, d.EpisodesWatched.Want)
+	}
+	if d.Rating != nil {
+		fmt.Printf("\t\t|-> %s: got %v, want %v\n", anisync.FieldRating, d.Rating.Got, d.Rating.Want)
+	}
+	if d.Rewatching != nil {
+		fmt.Printf("\t\t|-> %s: got %v, want %v\n", anisync.FieldRewatching, d.Rewatching.Got, d.Rewatching.Want)
+	}
+}
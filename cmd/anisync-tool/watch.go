@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/notify"
+	"github.com/nstratos/anisync/anisync/schedule"
+)
+
+const (
+	// minBackoff is how long watch waits at least after a failed cycle. It
+	// doubles with every consecutive failure up to maxBackoff.
+	minBackoff = time.Minute
+	maxBackoff = time.Hour
+)
+
+// watchState is kept in the state file between cycles so that watch can
+// resume its schedule and backoff after a restart.
+type watchState struct {
+	LastRun     time.Time
+	LastRunID   string // Run ID of the last cycle that wrote to MyAnimeList.net.
+	LastSuccess time.Time
+	NextRun     time.Time
+	Failures    int // Consecutive failed cycles.
+	LastError   string
+	Adds        int
+	Updates     int
+	AddFails    int
+	UpdateFails int
+}
+
+func defaultStatePath() string {
+	return configPath("watch.json")
+}
+
+func loadWatchState(path string) (watchState, error) {
+	var state watchState
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("reading watch state: %v", err)
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, fmt.Errorf("decoding watch state %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveWatchState writes the state to a temporary file first and then renames
+// it so that a crash cannot leave a half written state file behind.
+func saveWatchState(path string, state watchState) error {
+	b, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runWatch compares and syncs the lists on a schedule until it receives
+// SIGINT or SIGTERM. A cycle that is in progress is allowed to finish before
+// exiting. It never asks for confirmation so all the credentials have to be
+// provided through options or environment variables.
+func runWatch(filters []anisync.Filter) error {
+	noSource := *kitsuUserID == "" && *kitsuFileFlag == "" && *aniListUser == "" && *shikimoriUser == ""
+	if noSource || *malUsername == "" || *malPassword == "" {
+		return fmt.Errorf("watch needs the source list, the MyAnimeList.net username and the password to be provided by options or environment variables")
+	}
+	if *malFileFlag != "" {
+		return fmt.Errorf("watch cannot sync to a MyAnimeList.net list file")
+	}
+	sched, err := schedule.Parse(*scheduleFlag)
+	if err != nil {
+		return err
+	}
+	if sched.Next(time.Now()).IsZero() {
+		return fmt.Errorf("schedule %q never runs", *scheduleFlag)
+	}
+	statePath := *stateFlag
+	if statePath == "" {
+		statePath = defaultStatePath()
+	}
+	state, err := loadWatchState(statePath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	c := newClient()
+
+	next := time.Now()
+	if state.NextRun.After(next) {
+		next = state.NextRun
+	}
+	logger.Info("watch started", "schedule", *scheduleFlag, "state", statePath, "next_run", next)
+	for cycle := 1; ; cycle++ {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("watch stopped")
+			return nil
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		diff, skipped, result, err := runCycle(c, filters)
+		runID, jerr := recordJournal(diff, result)
+		if jerr != nil {
+			logger.Error("could not save sync journal", "err", jerr)
+		}
+		if herr := recordHistory("watch", runID, start, result, err); herr != nil {
+			logger.Error("could not save sync history", "err", herr)
+		}
+		provider, user := sourceAccount()
+		if nerr := sendNotifications(notify.MakeEvent("watch", *malUsername, provider, user, start, &diff, result, err)); nerr != nil {
+			logger.Error("could not send notifications", "err", nerr)
+		}
+		if runID != "" {
+			state.LastRunID = runID
+		}
+		state.LastRun = start
+		if result != nil {
+			state.Adds = len(result.Adds)
+			state.Updates = len(result.Updates)
+			state.AddFails = len(result.AddFails)
+			state.UpdateFails = len(result.UpdateFails)
+		} else {
+			state.Adds, state.Updates, state.AddFails, state.UpdateFails = 0, 0, 0, 0
+		}
+		if err != nil {
+			state.Failures++
+			state.LastError = err.Error()
+		} else {
+			state.Failures = 0
+			state.LastError = ""
+			state.LastSuccess = start
+		}
+		next = nextRun(sched, time.Now(), state.Failures)
+		state.NextRun = next
+		if err := saveWatchState(statePath, state); err != nil {
+			logger.Error("could not save watch state", "state", statePath, "err", err)
+		}
+
+		attrs := []any{
+			"cycle", cycle,
+			"run_id", runID,
+			"duration", time.Since(start).Round(time.Millisecond),
+			"missing", len(diff.Missing),
+			"need_update", len(diff.NeedUpdate),
+			"filtered", len(skipped.Missing) + len(skipped.NeedUpdate),
+			"adds", state.Adds,
+			"updates", state.Updates,
+			"add_fails", state.AddFails,
+			"update_fails", state.UpdateFails,
+			"failures", state.Failures,
+			"next_run", next,
+		}
+		if err != nil {
+			logger.Error("sync cycle failed", append(attrs, "err", err)...)
+			continue
+		}
+		logger.Info("sync cycle", attrs...)
+	}
+}
+
+// runCycle runs a single compare and sync. A cycle fails if any of the lists
+// cannot be fetched, if the MyAnimeList.net credentials cannot be verified or
+// if every attempted write failed.
+func runCycle(c *anisync.Client, filters []anisync.Filter) (diff, skipped anisync.Diff, result *anisync.SyncResult, err error) {
+	diff, skipped, err = getDiff(c, filters)
+	if err != nil {
+		return diff, skipped, nil, err
+	}
+	if len(diff.Missing) == 0 && len(diff.NeedUpdate) == 0 {
+		return diff, skipped, &anisync.SyncResult{}, nil
+	}
+	if _, _, err := c.VerifyMALCredentials(*malUsername, *malPassword); err != nil {
+		return diff, skipped, nil, fmt.Errorf("could not verify MyAnimeList.net credentials: %v", err)
+	}
+	result = c.SyncMALAnime(diff)
+	if len(result.Adds) == 0 && len(result.Updates) == 0 {
+		return diff, skipped, result, fmt.Errorf("all %d writes to MyAnimeList.net failed", len(result.AddFails)+len(result.UpdateFails))
+	}
+	return diff, skipped, result, nil
+}
+
+// nextRun returns when the next cycle should run. After consecutive failures
+// it backs off exponentially, unless the schedule is already less frequent.
+func nextRun(sched schedule.Schedule, now time.Time, failures int) time.Time {
+	next := sched.Next(now)
+	if failures == 0 {
+		return next
+	}
+	backoff := maxBackoff
+	if failures <= 6 {
+		backoff = minBackoff << uint(failures-1)
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	if retry := now.Add(backoff); retry.After(next) {
+		return retry
+	}
+	return next
+}
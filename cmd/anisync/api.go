@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/history"
+)
+
+// apiPrefix is the prefix of the current version of the API. The same handlers
+// are also served under /api, without a version, for older clients. Those
+// routes keep responding with the old error shapes.
+const apiPrefix = "/api/v1"
+
+// The request and response types of the API. They are also used to generate
+// the OpenAPI description of the API so any change to them is documented.
+type (
+	// CheckResponse is the difference between the MyAnimeList.net and Kitsu.io
+	// lists of an account.
+	CheckResponse struct {
+		MalUsername string
+		*anisync.Diff
+	}
+
+	// SyncRequest starts a sync for the account of the current session.
+	// MALUsername is optional and if provided it must match the session.
+	// Select limits the sync to the chosen anime and fields. If it is
+	// missing, the whole difference is synced, while an empty selection is
+	// rejected. ShikimoriUser, a nickname or user ID, syncs from the
+	// Shikimori.one list instead of the Kitsu.io list.
+	SyncRequest struct {
+		KitsuUserID   string               `json:"kitsuUserID"`
+		ShikimoriUser string               `json:"shikimoriUser,omitempty"`
+		MALUsername   string               `json:"malUsername,omitempty"`
+		Select        *[]anisync.Selection `json:"select,omitempty"`
+	}
+
+	// SyncSummary is the data of the summary event of a sync job. Diff is the
+	// difference between the lists after the sync.
+	SyncSummary struct {
+		MalUsername string
+		Sync        *anisync.SyncResult
+		*anisync.Diff
+	}
+
+	// JobResponse is returned when a background job starts. Its events can
+	// be streamed from EventsURL.
+	JobResponse struct {
+		JobID     string
+		EventsURL string
+	}
+
+	// LoginRequest holds the MyAnimeList.net credentials to log in with.
+	LoginRequest struct {
+		MALUsername string `json:"malUsername"`
+		MALPassword string `json:"malPassword"`
+	}
+
+	// SessionResponse describes the current session.
+	SessionResponse struct {
+		MalUsername string
+		Expires     time.Time
+	}
+
+	// HistoryResponse lists sync runs, newest first.
+	HistoryResponse struct {
+		Runs []history.Run
+	}
+
+	// RegistrationRequest registers a Kitsu.io account to be synced to the
+	// MyAnimeList.net account of the session on a schedule, which is an
+	// interval such as "6h" or a cron expression such as "0 */6 * * *".
+	RegistrationRequest struct {
+		KitsuUserID string `json:"kitsuUserID"`
+		Schedule    string `json:"schedule"`
+	}
+
+	// RegistrationResponse describes a registration. The stored password is
+	// never returned.
+	RegistrationResponse struct {
+		ID          string
+		MALUsername string
+		KitsuUserID string
+		Schedule    string
+		Paused      bool
+		Created     time.Time
+		NextRun     time.Time
+		LastRun     time.Time
+		LastJobID   string `json:",omitempty"` // The job of the last run, whose events can be streamed.
+		LastError   string `json:",omitempty"`
+		Failures    int    // Consecutive failed runs. The registration is paused after 5.
+	}
+
+	// ErrorResponse is the envelope of every error of the API.
+	ErrorResponse struct {
+		Error APIError
+	}
+
+	// APIError describes an error. Code is a short machine readable name of
+	// the error, Message is meant for humans and Cause is the underlying error.
+	// Upstream is set when the error was caused by a call to MyAnimeList.net
+	// or Kitsu.io.
+	APIError struct {
+		Code       string
+		Message    string
+		Cause      string
+		StatusCode int
+		Upstream   *Upstream `json:",omitempty"`
+	}
+
+	// Upstream is the response of MyAnimeList.net or Kitsu.io that caused an
+	// error.
+	Upstream struct {
+		StatusCode int
+		Method     string
+		URL        string
+	}
+)
+
+// codeUpstream is the code of the errors caused by MyAnimeList.net or Kitsu.io.
+const codeUpstream = "upstream_error"
+
+// newErrorResponse converts any error returned by a handler to the error
+// envelope of the API.
+func newErrorResponse(err error) ErrorResponse {
+	var e APIError
+	switch err := err.(type) {
+	case *appErr:
+		e = APIError{Message: err.Message, Cause: err.Cause, StatusCode: err.StatusCode}
+	case *remoteErr:
+		e = APIError{Code: codeUpstream, Message: err.Message, Cause: err.Cause, StatusCode: err.StatusCode}
+		if rr := err.RemoteResponse; rr != nil {
+			e.Upstream = &Upstream{StatusCode: rr.StatusCode, Method: rr.Request.Method, URL: rr.Request.URL}
+		}
+	default:
+		e = APIError{Message: "Internal error.", Cause: err.Error(), StatusCode: http.StatusInternalServerError}
+	}
+	if e.Code == "" {
+		e.Code = errorCode(e.StatusCode)
+	}
+	return ErrorResponse{Error: e}
+}
+
+// errorCode returns the status text of code in snake case, for example
+// "not_found" for 404.
+func errorCode(code int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(code)), " ", "_")
+}
+
+// apiHandler is like appHandler but every error is written using the error
+// envelope of the API.
+type apiHandler func(http.ResponseWriter, *http.Request) error
+
+func (fn apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if err := fn(w, r); err != nil {
+		resp := newErrorResponse(err)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(resp.Error.StatusCode)
+		writeJSON(w, resp)
+	}
+	log.Printf("%s\t%s\t%s", r.Method, r.RequestURI, time.Since(start))
+}
+
+// handleAPI registers fn for method and path under both the versioned and the
+// unversioned API prefix. An empty method matches all methods.
+func handleAPI(mux *http.ServeMux, method, path string, fn func(http.ResponseWriter, *http.Request) error) {
+	if method != "" {
+		method += " "
+	}
+	mux.Handle(method+"/api"+path, appHandler(fn))
+	mux.Handle(method+apiPrefix+path, apiHandler(fn))
+}
+
+// handleNotFound responds to the requests under the API prefix that do not
+// match any route.
+func handleNotFound(w http.ResponseWriter, r *http.Request) error {
+	err := fmt.Errorf("%s %s does not exist", r.Method, r.URL.Path)
+	return NewAppError(err, "Unknown API endpoint or method.", http.StatusNotFound)
+}
+
+// apiBase returns the prefix of the API that r was made to.
+func apiBase(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+		return apiPrefix
+	}
+	return "/api"
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+type cacheKey struct {
+	provider string
+	user     string
+}
+
+// cacheEntry is a list that is either being fetched or has been fetched.
+// ready is closed once the fetch is done and list, err and fetched are set.
+type cacheEntry struct {
+	ready   chan struct{}
+	list    []anisync.Anime
+	err     error
+	fetched time.Time
+}
+
+// listCache caches the anime lists fetched from the providers for ttl.
+// Concurrent fetches of the same list are collapsed into one and failed
+// fetches are not cached.
+type listCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+func newListCache(ttl time.Duration) *listCache {
+	return &listCache{ttl: ttl, entries: make(map[cacheKey]*cacheEntry)}
+}
+
+func newCacheKey(provider, user string) cacheKey {
+	// MyAnimeList.net usernames and Shikimori.one nicknames are not case
+	// sensitive.
+	if provider == anisync.ProviderMAL || provider == anisync.ProviderShikimori {
+		user = strings.ToLower(user)
+	}
+	return cacheKey{provider, user}
+}
+
+// get returns the list of user from the cache or calls fetch to get it. It
+// also returns the time that the list was fetched.
+func (c *listCache) get(provider, user string, fetch func() ([]anisync.Anime, error)) ([]anisync.Anime, time.Time, error) {
+	key := newCacheKey(provider, user)
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && c.expired(e) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if ok {
+		c.mu.Unlock()
+		<-e.ready
+		return e.list, e.fetched, e.err
+	}
+	e = &cacheEntry{ready: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.list, e.err = fetch()
+	e.fetched = time.Now()
+	close(e.ready)
+
+	if e.err != nil || c.ttl <= 0 {
+		c.mu.Lock()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	return e.list, e.fetched, e.err
+}
+
+// expired reports whether e has been fetched more than ttl ago. Entries that
+// are still being fetched never expire. It must be called with mu held.
+func (c *listCache) expired(e *cacheEntry) bool {
+	select {
+	case <-e.ready:
+		return time.Since(e.fetched) > c.ttl
+	default:
+		return false
+	}
+}
+
+// invalidate removes the list of user from the cache, typically after writing
+// to it. A fetch that is in progress is not cached when it completes.
+func (c *listCache) invalidate(provider, user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, newCacheKey(provider, user))
+}
+
+// expire removes the expired lists every interval. It never returns.
+func (c *listCache) expire(interval time.Duration) {
+	for range time.Tick(interval) {
+		c.mu.Lock()
+		for key, e := range c.entries {
+			if c.expired(e) {
+				delete(c.entries, key)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/malxml"
+)
+
+// handleExport serves the Kitsu.io, Shikimori.one or MyAnimeList.net list of an
+// account as a MyAnimeList.net XML list file, which can be imported to
+// MyAnimeList.net by hand or kept as a backup. The list is chosen by list,
+// kitsu, shikimori or mal, and the file is gzipped if gzip is true.
+func (app *App) handleExport(w http.ResponseWriter, r *http.Request) error {
+	c := app.newClient(r, "", "")
+	malUsername := r.FormValue("malUsername")
+	if malUsername == "" {
+		if sess, err := app.sessions.get(r); err == nil {
+			malUsername = sess.MALUsername
+		}
+	}
+	var gz bool
+	if v := r.FormValue("gzip"); v != "" {
+		var err error
+		if gz, err = strconv.ParseBool(v); err != nil {
+			return NewAppError(err, "Export: gzip must be true or false.", http.StatusBadRequest)
+		}
+	}
+
+	var (
+		list []anisync.Anime
+		name string
+		err  error
+	)
+	switch r.FormValue("list") {
+	case "", "kitsu":
+		kitsuUserID := r.FormValue("kitsuUserID")
+		if kitsuUserID == "" {
+			err := errors.New("missing kitsuUserID")
+			return NewAppError(err, "Export: Please provide a Kitsu user ID.", http.StatusBadRequest)
+		}
+		name = "kitsu-" + kitsuUserID
+		list, _, err = app.lists.get(anisync.ProviderKitsu, kitsuUserID, func() ([]anisync.Anime, error) {
+			list, resp, err := c.GetKitsuAnimeList(kitsuUserID)
+			if err != nil {
+				return nil, NewKitsuError(resp.Response, err, "Could not get Kitsu list to export.", http.StatusConflict)
+			}
+			return list, nil
+		})
+		if malUsername == "" {
+			malUsername = kitsuUserID
+		}
+	case "shikimori":
+		shikimoriUser := r.FormValue("shikimoriUser")
+		if shikimoriUser == "" {
+			err := errors.New("missing shikimoriUser")
+			return NewAppError(err, "Export: Please provide a Shikimori user.", http.StatusBadRequest)
+		}
+		name = "shikimori-" + shikimoriUser
+		list, _, err = app.getSourceList(c, listSource{anisync.ProviderShikimori, shikimoriUser})
+		if malUsername == "" {
+			malUsername = shikimoriUser
+		}
+	case "mal":
+		if malUsername == "" {
+			err := errors.New("missing malUsername")
+			return NewAppError(err, "Export: Please provide a MyAnimeList username.", http.StatusBadRequest)
+		}
+		name = "mal-" + malUsername
+		list, _, err = app.lists.get(anisync.ProviderMAL, malUsername, func() ([]anisync.Anime, error) {
+			list, resp, err := c.GetMyAnimeList(malUsername)
+			if err != nil {
+				return nil, NewMALError(resp, err, "Could not get MyAnimeList to export.", http.StatusConflict)
+			}
+			return list, nil
+		})
+	default:
+		err := fmt.Errorf("unknown list %q", r.FormValue("list"))
+		return NewAppError(err, "Export: The list must be kitsu, shikimori or mal.", http.StatusBadRequest)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Encoding to a buffer first so that errors can still be responded with.
+	var buf bytes.Buffer
+	filename := name + ".xml"
+	contentType := "application/xml; charset=UTF-8"
+	if gz {
+		filename += ".gz"
+		contentType = "application/gzip"
+		zw := gzip.NewWriter(&buf)
+		zw.Name = name + ".xml"
+		err = malxml.Encode(zw, malxml.MakeFile(malUsername, list))
+		if err == nil {
+			err = zw.Close()
+		}
+	} else {
+		err = malxml.Encode(&buf, malxml.MakeFile(malUsername, list))
+	}
+	if err != nil {
+		return NewAppError(err, "Export: Could not write list file.", http.StatusInternalServerError)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Write(buf.Bytes())
+	return nil
+}
@@ -1,19 +1,45 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/audit"
+	"github.com/nstratos/anisync/anisync/history"
+	"github.com/nstratos/anisync/anisync/notify"
+	"github.com/nstratos/anisync/anisync/shikimori"
 	"github.com/nstratos/go-kitsu/kitsu"
 	"github.com/nstratos/go-myanimelist/mal"
 )
 
 type App struct {
-	httpClient *http.Client
+	httpClient   *http.Client
+	jobs         *jobManager
+	sessions     *sessionStore
+	lists        *listCache
+	limits       *limits
+	metrics      *appMetrics
+	probes       []probe
+	scenarios    map[string]*scenario
+	history      history.Store  // Nil if no history is kept.
+	audit        *audit.Log     // Nil if the writes are not audited.
+	scheduler    *scheduler     // Nil if scheduled syncs are disabled.
+	notify       notify.Targets // Told about the scheduled syncs.
+	malURL       *url.URL       // Base URLs of the APIs, nil for the real ones.
+	kitsuURL     *url.URL
+	shikimoriURL *url.URL
+
+	shuttingDown atomic.Bool
 }
 
 type appErr struct {
@@ -112,192 +138,308 @@ func writeJSON(w http.ResponseWriter, data interface{}) {
 	}
 }
 
-func getDiff(c *anisync.Client, malUsername, kitsuEmail string) (*anisync.Diff, error) {
-	malist, resp, err := c.GetMyAnimeList(malUsername)
+// listSource is the list that is synced to MyAnimeList.net, the Kitsu.io list
+// of a user ID or the Shikimori.one list of a nickname or user ID.
+type listSource struct {
+	provider string
+	user     string
+}
+
+// sourceOf returns the list source of a request, which gives either a Kitsu.io
+// user ID or a Shikimori.one user.
+func sourceOf(kitsuUserID, shikimoriUser string) (listSource, error) {
+	switch {
+	case kitsuUserID != "" && shikimoriUser != "":
+		err := errors.New("both kitsuUserID and shikimoriUser given")
+		return listSource{}, NewAppError(err, "Please provide either a Kitsu user ID or a Shikimori user, not both.", http.StatusBadRequest)
+	case shikimoriUser != "":
+		return listSource{anisync.ProviderShikimori, shikimoriUser}, nil
+	}
+	return listSource{anisync.ProviderKitsu, kitsuUserID}, nil
+}
+
+// getSourceList returns the list of a source, taking it from the list cache
+// if possible, and the time that it was fetched.
+func (app *App) getSourceList(c *anisync.Client, src listSource) ([]anisync.Anime, time.Time, error) {
+	if src.provider == anisync.ProviderShikimori {
+		return app.lists.get(anisync.ProviderShikimori, src.user, func() ([]anisync.Anime, error) {
+			list, err := app.newShikimoriClient().AnimeRates(src.user)
+			if err != nil {
+				return nil, newRemoteError(nil, err, "Could not get Shikimori list to compare.", http.StatusConflict)
+			}
+			return list, nil
+		})
+	}
+	return app.lists.get(anisync.ProviderKitsu, src.user, func() ([]anisync.Anime, error) {
+		kitsuList, kitsuResp, err := c.GetKitsuAnimeList(src.user)
+		if err != nil {
+			return nil, NewKitsuError(kitsuResp.Response, err, "Could not get Kitsu list to compare.", http.StatusConflict)
+		}
+		return kitsuList, nil
+	})
+}
+
+// getDiff compares the MyAnimeList.net list and the list of the source, taking
+// them from the list cache if possible. It also returns the time that the most
+// recently fetched of the two lists was fetched.
+func (app *App) getDiff(c *anisync.Client, malUsername string, src listSource) (*anisync.Diff, time.Time, error) {
+	malist, malFetched, err := app.lists.get(anisync.ProviderMAL, malUsername, func() ([]anisync.Anime, error) {
+		malist, resp, err := c.GetMyAnimeList(malUsername)
+		if err != nil {
+			return nil, NewMALError(resp, err, "Could not get MyAnimeList to compare.", http.StatusConflict)
+		}
+		return malist, nil
+	})
 	if err != nil {
-		return nil, NewMALError(resp, err, "Could not get MyAnimeList to compare.", http.StatusConflict)
+		return nil, time.Time{}, err
 	}
 
-	kitsuList, kitsuResp, err := c.GetKitsuAnimeList(kitsuEmail)
+	srcList, srcFetched, err := app.getSourceList(c, src)
 	if err != nil {
-		return nil, NewKitsuError(kitsuResp.Response, err, "Could not get Kitsu list to compare.", http.StatusConflict)
+		return nil, time.Time{}, err
 	}
-	diff := anisync.Compare(malist, kitsuList)
+	diff := anisync.Compare(malist, srcList)
 
-	return diff, err
+	lastModified := malFetched
+	if srcFetched.After(lastModified) {
+		lastModified = srcFetched
+	}
+	return diff, lastModified, nil
 }
 
-func (app *App) handleCheck(w http.ResponseWriter, r *http.Request) error {
-	// preparing anisync client
+// newShikimoriClient returns a Shikimori.one client that uses the -shikimori-url
+// base URL when set and the HTTP client of the app. Its requests are recorded
+// in the upstream metrics like the calls of the other providers.
+func (app *App) newShikimoriClient() *shikimori.Client {
+	c := shikimori.NewClient(app.metrics.client(app.httpClient, anisync.ProviderShikimori, "anime_list"), "")
+	if app.shikimoriURL != nil {
+		u := *app.shikimoriURL
+		c.BaseURL = &u
+	}
+	return c
+}
+
+// newClient prepares an anisync client for a request, authenticated with the
+// MyAnimeList.net credentials if a password is given. The clients use the
+// -mal-url and -kitsu-url base URLs when set and the HTTP client of the app,
+// which records or replays the requests with -record and -replay.
+func (app *App) newClient(r *http.Request, malUsername, malPassword string) *anisync.Client {
 	httpcl := httpClientFromRequest(r)
-	malClient := mal.NewClient(
-		mal.HTTPClient(httpcl),
-	)
-	kitsuClient := kitsu.NewClient(httpcl)
-	resources := anisync.NewResources(malClient, kitsuClient)
-	c := anisync.NewClient(resources)
+	if httpcl == nil {
+		httpcl = app.httpClient
+	}
+	return app.newClientWith(httpcl, httpcl, malUsername, malPassword)
+}
+
+// newClientWith is like newClient but it makes the requests to
+// MyAnimeList.net with malHTTP and the ones to Kitsu.io with kitsuHTTP.
+func (app *App) newClientWith(malHTTP, kitsuHTTP *http.Client, malUsername, malPassword string) *anisync.Client {
+	malClient := mal.NewClient(mal.HTTPClient(malHTTP))
+	if malPassword != "" {
+		mal.Auth(malUsername, malPassword)(malClient)
+	}
+	if app.malURL != nil {
+		u := *app.malURL
+		malClient.BaseURL = &u
+	}
+	kitsuClient := kitsu.NewClient(kitsuHTTP)
+	if app.kitsuURL != nil {
+		u := *app.kitsuURL
+		kitsuClient.BaseURL = &u
+	}
+	resources := app.metrics.resources(anisync.NewResources(malClient, kitsuClient))
+	if app.audit != nil {
+		resources = audit.Wrap(resources, app.audit, malUsername)
+	}
+	return anisync.NewClient(resources)
+}
+
+func (app *App) handleCheck(w http.ResponseWriter, r *http.Request) error {
+	c := app.newClient(r, "", "")
 
 	malUsername := r.FormValue("malUsername")
-	kitsuUserID := r.FormValue("kitsuUserID")
-	diff, err := getDiff(c, malUsername, kitsuUserID)
+	if malUsername == "" {
+		if sess, err := app.sessions.get(r); err == nil {
+			malUsername = sess.MALUsername
+		}
+	}
+	src, err := sourceOf(r.FormValue("kitsuUserID"), r.FormValue("shikimoriUser"))
+	if err != nil {
+		return err
+	}
+	diff, lastModified, err := app.getDiff(c, malUsername, src)
 	if err != nil {
 		return err
 	}
 
 	// Including MyAnimeList account username in response.
-	resp := struct {
-		MalUsername string
-		*anisync.Diff
-	}{
-		malUsername,
-		diff,
+	resp := CheckResponse{
+		MalUsername: malUsername,
+		Diff:        diff,
 	}
 
 	bytes, err := json.Marshal(resp)
 	if err != nil {
 		return NewAppError(err, "Check: Could not encode list difference.", http.StatusInternalServerError)
 	}
+	if notModified(w, r, bytes, lastModified) {
+		return nil
+	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write(bytes)
 	return nil
 }
 
+// notModified sets the ETag and Last-Modified headers of a response with body
+// and responds with Not Modified if the request is conditional and the client
+// already has the response. It reports whether it responded.
+func notModified(w http.ResponseWriter, r *http.Request, body []byte, lastModified time.Time) bool {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			if t = strings.TrimSpace(t); t == etag || t == "W/"+etag || t == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.Truncate(time.Second).After(ims) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// handleSync starts syncing in the background and responds right away with the
+// ID of the sync job. The progress and the result of the sync are streamed by
+// handleJobEvents. The MyAnimeList.net credentials are taken from the session
+// created by handleLogin so the request body only needs the Kitsu.io user ID,
+// or the Shikimori.one user to sync from Shikimori.one instead.
+// The request can also select which anime and fields to sync, in which case
+// the difference is computed again and the selected anime must still need to
+// be synced.
 func (app *App) handleSync(w http.ResponseWriter, r *http.Request) error {
+	sess, err := app.sessions.get(r)
+	if err != nil {
+		return NewAppError(err, "Sync: Please log in to MyAnimeList first.", http.StatusUnauthorized)
+	}
+
 	// Receiving json from POST body.
-	t := struct {
-		KitsuUserID string `json:"kitsuUserID"`
-		MALUsername string `json:"malUsername"`
-		MALPassword string `json:"malPassword"`
-	}{}
-	err := json.NewDecoder(r.Body).Decode(&t)
+	var t SyncRequest
+	err = json.NewDecoder(r.Body).Decode(&t)
 	if err != nil {
 		return NewAppError(err, "Sync: Could not decode request.", http.StatusBadRequest)
 	}
-
-	// preparing anisync client
-	httpcl := httpClientFromRequest(r)
-	malClient := mal.NewClient(
-		mal.HTTPClient(httpcl),
-		mal.Auth(t.MALUsername, t.MALPassword),
-	)
-	kitsuClient := kitsu.NewClient(httpcl)
-	resources := anisync.NewResources(malClient, kitsuClient)
-	c := anisync.NewClient(resources)
-
-	diff, err := getDiff(c, t.MALUsername, t.KitsuUserID)
+	if t.MALUsername != "" && t.MALUsername != sess.MALUsername {
+		err := fmt.Errorf("session is for %q, not %q", sess.MALUsername, t.MALUsername)
+		return NewAppError(err, "Sync: Please log in to this MyAnimeList account first.", http.StatusUnauthorized)
+	}
+	t.MALUsername = sess.MALUsername
+	src, err := sourceOf(t.KitsuUserID, t.ShikimoriUser)
 	if err != nil {
 		return err
 	}
-
-	//if _, resp, err := c.VerifyMALCredentials(t.MALUsername, t.MALPassword); err != nil {
-	//	return NewMALError(resp, err, "Sync: Could not verify MAL credentials.", http.StatusUnauthorized)
-	//}
-
-	syncResp := c.SyncMALAnime(*diff)
-
-	diff, err = getDiff(c, t.MALUsername, t.KitsuUserID)
-	if err != nil {
+	if err := checkSelection(t.Select); err != nil {
 		return err
 	}
 
-	// Including MyAnimeList account username in response.
-	resp := struct {
-		MalUsername string
-		Sync        *anisync.SyncResult
-		*anisync.Diff
-	}{
-		t.MALUsername,
-		syncResp,
-		diff,
-	}
+	c := app.newClient(r, sess.MALUsername, sess.MALPassword)
 
-	bytes, err := json.Marshal(resp)
-	if err != nil {
-		return NewAppError(err, "Sync: Could not encode response.", http.StatusInternalServerError)
+	if !app.limits.syncs.acquire(sess.MALUsername) {
+		err := fmt.Errorf("too many syncs running for %s", sess.MALUsername)
+		return tooManyRequests(w, syncRetryAfter, err)
 	}
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes)
+	job := app.jobs.start(func(j *job) (_ interface{}, err error) {
+		defer app.limits.syncs.release(sess.MALUsername)
+		started := time.Now()
+		var syncResp *anisync.SyncResult
+		defer func() {
+			app.recordRun(history.MakeRun("server", t.MALUsername, src.provider, src.user, started, syncResp, err))
+		}()
+
+		// The lists are fetched again so that the sync does not act on what
+		// the client saw when it checked, which may have changed since.
+		app.lists.invalidate(anisync.ProviderMAL, t.MALUsername)
+		app.lists.invalidate(src.provider, src.user)
+		diff, _, err := app.getDiff(c, t.MALUsername, src)
+		if err != nil {
+			return nil, err
+		}
+		toSync, err := selectDiff(diff, t.Select)
+		if err != nil {
+			return nil, err
+		}
 
-	return nil
-}
+		syncResp = c.SyncMALAnimeFunc(*toSync, func(e anisync.SyncEvent) {
+			j.emit(eventEntry, e)
+		})
+		app.metrics.observeSync(syncResp)
 
-/*
-handleMALVerify is a handler that asks the MAL API for username and password
-verification. It expects a request body that looks like this:
+		// The cached MyAnimeList.net list is stale after writing to it.
+		app.lists.invalidate(anisync.ProviderMAL, t.MALUsername)
+		diff, _, err = app.getDiff(c, t.MALUsername, src)
+		if err != nil {
+			return nil, err
+		}
 
-	{
-		"malPassword": "some-password",
-		"malUsername": "some-username"
-	}
+		// Including MyAnimeList account username in response.
+		return SyncSummary{
+			MalUsername: t.MALUsername,
+			Sync:        syncResp,
+			Diff:        diff,
+		}, nil
+	})
 
-It returns a JSON response that is required by ngRemoteValidate, which should
-look as follows:
+	return writeJob(w, r, job)
+}
 
-	{
-		isValid: bool, 		// Is the value received valid.
-		value: 'myPassword!' 	// value received from server.
-	}
-
-In our case, we send two values to the server. As we can only return back one
-value, we choose that to be the username.
-*/
-func (app *App) handleMALVerify(w http.ResponseWriter, r *http.Request) error {
-	// Receiving json from POST body.
-	t := struct {
-		MALUsername string `json:"malUsername"`
-		MALPassword string `json:"malPassword"`
-	}{}
-	err := json.NewDecoder(r.Body).Decode(&t)
-	if err != nil {
-		return NewAppError(nil, "Verify: Could not decode request.", http.StatusBadRequest)
+// checkSelection rejects a selection that is present but empty. Syncing
+// nothing is never intended and must not be mistaken for syncing everything.
+func checkSelection(sel *[]anisync.Selection) error {
+	if sel != nil && len(*sel) == 0 {
+		err := errors.New("empty selection")
+		return NewAppError(err, "Sync: Please select at least one anime to sync.", http.StatusBadRequest)
 	}
+	return nil
+}
 
-	// Asking MAL for verification of username and password and returning
-	// a json response with the result.
-	res := struct {
-		IsValid bool   `json:"isValid"`
-		Value   string `json:"value"` // We use username as the returned value.
-	}{
-		false,
-		t.MALUsername,
+// selectDiff returns the part of diff that was selected to sync, or all of diff
+// if there is no selection.
+func selectDiff(diff *anisync.Diff, sel *[]anisync.Selection) (*anisync.Diff, error) {
+	if sel == nil {
+		return diff, nil
 	}
-
-	// preparing anisync client
-	httpcl := httpClientFromRequest(r)
-	malClient := mal.NewClient(
-		mal.HTTPClient(httpcl),
-		mal.Auth(t.MALUsername, t.MALPassword),
-	)
-	kitsuClient := kitsu.NewClient(httpcl)
-	resources := anisync.NewResources(malClient, kitsuClient)
-	c := anisync.NewClient(resources)
-
-	_, _, err = c.VerifyMALCredentials(t.MALUsername, t.MALPassword)
-	if err == nil {
-		res.IsValid = true
+	if err := checkSelection(sel); err != nil {
+		return nil, err
 	}
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		return NewAppError(err, "Verify: Could not encode response.", http.StatusInternalServerError)
+	selected, err := anisync.SelectDiff(*diff, *sel...)
+	if err != nil {
+		return nil, NewAppError(err, "Sync: The selected anime have changed since they were checked.", http.StatusConflict)
 	}
-
-	return nil
+	return &selected, nil
 }
 
-func (app *App) handleTestMALVerify(w http.ResponseWriter, r *http.Request) error {
-	res := struct {
-		IsValid bool `json:"isValid"`
-	}{
-		true,
+// writeJob responds with the ID of a job that has just started and the URL of
+// its event stream.
+func writeJob(w http.ResponseWriter, r *http.Request, j *job) error {
+	resp := JobResponse{
+		JobID:     j.ID,
+		EventsURL: apiBase(r) + "/jobs/" + j.ID + "/events",
 	}
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		return NewAppError(err, "Verify: Could not encode response.", http.StatusInternalServerError)
+	bytes, err := json.Marshal(resp)
+	if err != nil {
+		return NewAppError(err, "Sync: Could not encode response.", http.StatusInternalServerError)
 	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Location", resp.EventsURL)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(bytes)
 	return nil
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// probeTimeout is how long readiness waits for each upstream probe.
+const probeTimeout = 5 * time.Second
+
+// probe is an upstream that readiness checks by requesting its base URL.
+type probe struct {
+	Name string
+	URL  string
+}
+
+// probeResult is the result of a single probe.
+type probeResult struct {
+	OK      bool
+	Status  int    `json:",omitempty"`
+	Error   string `json:",omitempty"`
+	Latency string
+}
+
+// handleHealthz reports that the server is alive. It does not check anything
+// else so that a slow upstream never gets the server restarted.
+func (app *App) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, struct{ Status string }{"ok"})
+}
+
+// handleReadyz reports whether the server should receive traffic. It is not
+// ready while shutting down or if any of the configured upstream probes fail.
+func (app *App) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Status string
+		Checks map[string]probeResult `json:",omitempty"`
+	}{Status: "ready"}
+	status := http.StatusOK
+	if app.shuttingDown.Load() {
+		resp.Status, status = "shutting down", http.StatusServiceUnavailable
+	}
+
+	if len(app.probes) != 0 {
+		resp.Checks = app.runProbes(r.Context())
+		for _, res := range resp.Checks {
+			if !res.OK && status == http.StatusOK {
+				resp.Status, status = "not ready", http.StatusServiceUnavailable
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	writeJSON(w, resp)
+}
+
+// runProbes requests the base URL of every probe at the same time. A probe
+// succeeds if the upstream responds without a server error. The probes use a
+// plain client so that -record does not write them to the cassette.
+func (app *App) runProbes(ctx context.Context) map[string]probeResult {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]probeResult, len(app.probes))
+	)
+	for _, p := range app.probes {
+		wg.Add(1)
+		go func(p probe) {
+			defer wg.Done()
+			start := time.Now()
+			res := probeResult{}
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.URL, nil)
+			if err == nil {
+				var resp *http.Response
+				if resp, err = http.DefaultClient.Do(req); err == nil {
+					resp.Body.Close()
+					res.Status = resp.StatusCode
+					if resp.StatusCode >= 500 {
+						err = fmt.Errorf("%s responded %s", p.URL, resp.Status)
+					}
+				}
+			}
+			res.OK = err == nil
+			if err != nil {
+				res.Error = err.Error()
+			}
+			res.Latency = time.Since(start).Round(time.Millisecond).String()
+			mu.Lock()
+			results[p.Name] = res
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/history"
+)
+
+const (
+	// historyLimit is how many runs /history returns by default and
+	// historyMaxLimit is the most it returns.
+	historyLimit    = 20
+	historyMaxLimit = 100
+)
+
+// recordRun adds a run to the history, if the history is enabled.
+func (app *App) recordRun(run history.Run) {
+	if app.history == nil {
+		return
+	}
+	if _, err := app.history.Add(run); err != nil {
+		log.Println("Could not record sync history:", err)
+	}
+}
+
+// historyStore returns the history store or an error if -history is not set.
+func (app *App) historyStore() (history.Store, error) {
+	if app.history == nil {
+		err := errors.New("history is not enabled on this server")
+		return nil, NewAppError(err, "History: Sync history is not kept.", http.StatusNotFound)
+	}
+	return app.history, nil
+}
+
+// handleHistory lists the sync runs of the MyAnimeList.net account of the
+// current session, newest first. They can be filtered by kitsuUserID or
+// shikimoriUser, since (RFC 3339) and failed, and limited by limit.
+func (app *App) handleHistory(w http.ResponseWriter, r *http.Request) error {
+	store, err := app.historyStore()
+	if err != nil {
+		return err
+	}
+	sess, err := app.sessions.get(r)
+	if err != nil {
+		return NewAppError(err, "History: Please log in to MyAnimeList first.", http.StatusUnauthorized)
+	}
+	q := history.Query{
+		MALUsername: sess.MALUsername,
+		Limit:       historyLimit,
+	}
+	src, err := sourceOf(r.FormValue("kitsuUserID"), r.FormValue("shikimoriUser"))
+	if err != nil {
+		return err
+	}
+	if src.user != "" {
+		q.Provider, q.User = src.provider, src.user
+	}
+	if v := r.FormValue("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return NewAppError(err, "History: since must be an RFC 3339 time.", http.StatusBadRequest)
+		}
+	}
+	if v := r.FormValue("failed"); v != "" {
+		if q.FailedOnly, err = strconv.ParseBool(v); err != nil {
+			return NewAppError(err, "History: failed must be true or false.", http.StatusBadRequest)
+		}
+	}
+	if v := r.FormValue("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > historyMaxLimit {
+			err = fmt.Errorf("limit %q is not between 1 and %d", v, historyMaxLimit)
+			return NewAppError(err, "History: Invalid limit.", http.StatusBadRequest)
+		}
+	}
+	runs, err := store.List(q)
+	if err != nil {
+		return NewAppError(err, "History: Could not read sync history.", http.StatusInternalServerError)
+	}
+	if runs == nil {
+		runs = []history.Run{}
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	writeJSON(w, HistoryResponse{Runs: runs})
+	return nil
+}
+
+// handleHistoryRun returns a single sync run, with the outcome of each
+// entry, if it belongs to the account of the current session.
+func (app *App) handleHistoryRun(w http.ResponseWriter, r *http.Request) error {
+	store, err := app.historyStore()
+	if err != nil {
+		return err
+	}
+	sess, err := app.sessions.get(r)
+	if err != nil {
+		return NewAppError(err, "History: Please log in to MyAnimeList first.", http.StatusUnauthorized)
+	}
+	run, err := store.Get(r.PathValue("id"))
+	if err == nil && !strings.EqualFold(run.MALUsername, sess.MALUsername) {
+		err = history.ErrNotFound
+	}
+	if errors.Is(err, history.ErrNotFound) {
+		return NewAppError(err, "History: No such sync run.", http.StatusNotFound)
+	}
+	if err != nil {
+		return NewAppError(err, "History: Could not read sync history.", http.StatusInternalServerError)
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	writeJSON(w, run)
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/metrics"
+)
+
+// jobRetention is how long a finished job is kept so that its events can
+// still be streamed by clients that connect late or reconnect.
+const jobRetention = 10 * time.Minute
+
+// The names of the events that a job emits.
+const (
+	eventEntry   = "entry"   // A single add or update of a sync.
+	eventSummary = "summary" // The final result. Same shape as the old sync response.
+	eventFailure = "failure" // The job failed, as an ErrorResponse. Not named error to avoid clashing with EventSource errors.
+)
+
+type jobEvent struct {
+	ID   int
+	Name string
+	Data []byte
+}
+
+// job is a long running operation, such as a sync, which runs in the
+// background. Its events are kept so that they can be streamed to any number
+// of clients from the start.
+type job struct {
+	ID string
+
+	mu     sync.Mutex
+	events []jobEvent
+	done   bool
+	// changed is closed and replaced every time there is a new event or the
+	// job is done, to wake up the clients that are waiting.
+	changed chan struct{}
+}
+
+func (j *job) emit(name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(newErrorResponse(NewAppError(err, "Could not encode job event.", http.StatusInternalServerError)))
+		name = eventFailure
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.events = append(j.events, jobEvent{ID: len(j.events) + 1, Name: name, Data: data})
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func (j *job) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done = true
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// eventsSince returns the events after the event with ID last, whether the
+// job is done and a channel that is closed when any of those change.
+func (j *job) eventsSince(last int) ([]jobEvent, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if last > len(j.events) {
+		last = len(j.events)
+	}
+	return j.events[last:], j.done, j.changed
+}
+
+// jobManager runs jobs in the background and keeps track of them.
+type jobManager struct {
+	mu       sync.Mutex
+	jobs     map[string]*job
+	wg       sync.WaitGroup
+	inFlight *metrics.GaugeVec
+	// closing is closed when the server shuts down to end the event streams.
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func newJobManager(inFlight *metrics.GaugeVec) *jobManager {
+	return &jobManager{jobs: make(map[string]*job), inFlight: inFlight, closing: make(chan struct{})}
+}
+
+// wait waits until all the running jobs are done or ctx is done.
+func (m *jobManager) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeStreams ends all the event streams so that the server can shut down.
+// Clients that reconnect continue from where they left off if the server
+// comes back in time.
+func (m *jobManager) closeStreams() {
+	m.closeOnce.Do(func() { close(m.closing) })
+}
+
+// start runs fn in the background as a new job. The value returned by fn is
+// emitted as the summary event of the job, or the error as a failure event.
+func (m *jobManager) start(fn func(j *job) (interface{}, error)) *job {
+	j := &job{ID: newJobID(), changed: make(chan struct{})}
+	m.mu.Lock()
+	m.jobs[j.ID] = j
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	m.inFlight.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer m.inFlight.Add(-1)
+		defer func() {
+			j.finish()
+			time.AfterFunc(jobRetention, func() { m.remove(j.ID) })
+		}()
+		v, err := fn(j)
+		if err != nil {
+			switch err.(type) {
+			case *appErr, *remoteErr:
+			default:
+				err = NewAppError(err, "Job failed.", http.StatusInternalServerError)
+			}
+			j.emit(eventFailure, newErrorResponse(err))
+			return
+		}
+		j.emit(eventSummary, v)
+	}()
+	return j
+}
+
+func (m *jobManager) get(id string) *job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jobs[id]
+}
+
+func (m *jobManager) remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// handleJobEvents streams the events of a job as Server-Sent Events. Clients
+// that reconnect with a Last-Event-ID header continue after that event. The
+// stream ends after the last event of a finished job and reconnecting after
+// that returns No Content.
+func (app *App) handleJobEvents(w http.ResponseWriter, r *http.Request) error {
+	j := app.jobs.get(r.PathValue("id"))
+	if j == nil {
+		return NewAppError(fmt.Errorf("job %q not found", r.PathValue("id")), "Events: Unknown job.", http.StatusNotFound)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return NewAppError(fmt.Errorf("response writer does not support flushing"), "Events: Streaming is not supported.", http.StatusInternalServerError)
+	}
+	last, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if events, done, _ := j.eventsSince(last); done && len(events) == 0 {
+		// No Content tells EventSource clients to stop reconnecting.
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	// Streams last as long as the job so they are exempt from the write
+	// timeout of the server.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		events, done, changed := j.eventsSince(last)
+		for _, e := range events {
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Name, e.Data)
+			last = e.ID
+		}
+		flusher.Flush()
+		if done {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return nil
+		case <-app.jobs.closing:
+			return nil
+		}
+	}
+}
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/audit"
+	"github.com/nstratos/anisync/anisync/cassette"
+	"github.com/nstratos/anisync/anisync/history"
+	"github.com/nstratos/anisync/anisync/notify"
+	"github.com/nstratos/anisync/internal/baseurl"
 )
 
 func main() {
@@ -15,37 +28,277 @@ func main() {
 	}
 }
 
-const assetsFolder = "ui/"
-
 func run() error {
 	var (
-		httpAddr = flag.String("http", ":"+getenv("PORT", "8080"), "the host and port on which the server should serve HTTP requests")
+		httpAddr   = flag.String("http", ":"+getenv("PORT", "8080"), "the host and port on which the server should serve HTTP requests")
+		sessionKey = flag.String("session-key", os.Getenv("SESSION_KEY"), "hex encoded 32 byte key that encrypts the session cookies, random if empty")
+		sessionTTL = flag.Duration("session-ttl", 30*time.Minute, "how long a MyAnimeList.net login lasts")
+		cacheTTL   = flag.Duration("cache-ttl", time.Minute, "how long the fetched anime lists are cached, 0 to disable caching")
+
+		ipRate       = flag.Float64("ip-rate", 60, "requests per minute allowed from each client IP, 0 for no limit")
+		ipBurst      = flag.Int("ip-burst", 20, "requests allowed at once from each client IP")
+		accountRate  = flag.Float64("account-rate", 20, "requests per minute allowed for each MyAnimeList.net or Kitsu.io account, 0 for no limit")
+		accountBurst = flag.Int("account-burst", 10, "requests allowed at once for each MyAnimeList.net or Kitsu.io account")
+		maxSyncs     = flag.Int("max-syncs", 1, "syncs that can run at the same time for each MyAnimeList.net account, 0 for no limit")
+		trustProxy   = flag.Bool("trust-proxy", false, "take the client IP from the X-Forwarded-For header, only when behind a proxy that sets it")
+		proxyHops    = flag.Int("proxy-hops", 1, "with -trust-proxy, the number of trusted proxies in front of the server that append to X-Forwarded-For")
+
+		readTimeout       = flag.Duration("read-timeout", 10*time.Second, "maximum duration for reading a request, including the body")
+		readHeaderTimeout = flag.Duration("read-header-timeout", 5*time.Second, "maximum duration for reading the headers of a request")
+		writeTimeout      = flag.Duration("write-timeout", time.Minute, "maximum duration for writing a response, event streams are exempt")
+		idleTimeout       = flag.Duration("idle-timeout", 2*time.Minute, "how long to keep idle keep-alive connections open")
+		shutdownTimeout   = flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for running syncs and requests when shutting down")
+		malProbeURL       = flag.String("mal-probe-url", "", "MyAnimeList.net base URL that /readyz requests, no probe if empty")
+		kitsuProbeURL     = flag.String("kitsu-probe-url", "", "Kitsu.io base URL that /readyz requests, no probe if empty")
+		uiDir             = flag.String("ui-dir", "", "serve the web UI from this directory instead of the embedded one, for development")
+		malURL            = flag.String("mal-url", "", "base URL of the MyAnimeList.net API, e.g. of a fake server for testing, default is the real one")
+		kitsuURL          = flag.String("kitsu-url", "", "base URL of the Kitsu.io API, e.g. of a fake server for testing, default is the real one")
+		shikimoriURL      = flag.String("shikimori-url", "", "base URL of the Shikimori.one API, e.g. of a fake server for testing, default is the real one")
+		recordFile        = flag.String("record", "", "record the requests to MyAnimeList.net and Kitsu.io, without credentials, to this cassette file")
+		replayFile        = flag.String("replay", "", "respond to the requests to MyAnimeList.net and Kitsu.io from this cassette file instead of the network")
+		mockDir           = flag.String("mock-dir", "", "load the mock scenarios from the JSON fixtures in this directory instead of the embedded ones")
+		historyFile       = flag.String("history", "", "keep the history of the syncs in this file, no history if empty")
+		registrationsFile = flag.String("registrations", "", "enable scheduled syncs and keep the registered accounts in this file")
+		credentialsKey    = flag.String("credentials-key", os.Getenv("CREDENTIALS_KEY"), "hex encoded 32 byte key that encrypts the passwords of the registrations, required with -registrations")
+		minInterval       = flag.Duration("min-schedule-interval", 15*time.Minute, "shortest interval between the scheduled syncs of a registration")
+		upstreamMALRate   = flag.Float64("scheduler-mal-rate", 60, "requests per minute that the scheduled syncs make to MyAnimeList.net, 0 for no limit")
+		upstreamKitsuRate = flag.Float64("scheduler-kitsu-rate", 60, "requests per minute that the scheduled syncs make to Kitsu.io, 0 for no limit")
+		smtpAddr          = flag.String("smtp-addr", "", "host:port of the SMTP server of the email notifications")
+		smtpFrom          = flag.String("smtp-from", "", "from address of the email notifications")
+		smtpUser          = flag.String("smtp-user", "", "username of the SMTP server, with the password in SMTP_PASSWORD")
+		auditFile         = flag.String("audit", "", "append a hash-chained record of every write to MyAnimeList.net to this file, no audit log if empty")
+		historyMaxRuns    = flag.Int("history-max-runs", 10000, "sync runs kept in the history, 0 for no limit")
+		historyMaxAge     = flag.Duration("history-max-age", 90*24*time.Hour, "how long sync runs are kept in the history, 0 for no limit")
+		notifySpecs       = notify.SpecsFlag("notify", "notify trigger:kind:destination about the scheduled syncs, where trigger is always, change or failure and kind is webhook, chat, discord or email, can be repeated")
 	)
 	flag.Parse()
 
+	var key []byte
+	if *sessionKey != "" {
+		var err error
+		if key, err = hex.DecodeString(*sessionKey); err != nil {
+			return fmt.Errorf("decoding session key: %v", err)
+		}
+	}
+	sessions, err := newSessionStore(key, *sessionTTL)
+	if err != nil {
+		return fmt.Errorf("creating session store: %v", err)
+	}
+	go sessions.expire(time.Minute)
+
 	// Preparing ui
-	uiHandler := http.FileServer(http.Dir(assetsFolder))
-	http.Handle("/static/", http.StripPrefix("/static", uiHandler))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		uiHandler.ServeHTTP(w, r)
-	})
+	var ui http.Handler
+	if *uiDir != "" {
+		// Serving from a directory, without caching, so that the UI can be
+		// edited while the server is running.
+		ui = noCache(http.FileServer(http.Dir(*uiDir)))
+	} else {
+		fsys, err := fs.Sub(uiFiles, "ui")
+		if err != nil {
+			return fmt.Errorf("preparing ui: %v", err)
+		}
+		if ui, err = newUIHandler(fsys); err != nil {
+			return fmt.Errorf("preparing ui: %v", err)
+		}
+	}
+	http.Handle("/static/", http.StripPrefix("/static", ui))
+	http.Handle("/", ui)
+
+	// Preparing mock scenarios
+	var mockFiles fs.FS
+	if *mockDir != "" {
+		mockFiles = os.DirFS(*mockDir)
+	} else if mockFiles, err = fs.Sub(scenarioFiles, "scenarios"); err != nil {
+		return fmt.Errorf("loading mock scenarios: %v", err)
+	}
+	scenarios, err := loadScenarios(mockFiles)
+	if err != nil {
+		return fmt.Errorf("loading mock scenarios: %v", err)
+	}
 
+	httpClient, err := newHTTPClient(*recordFile, *replayFile)
+	if err != nil {
+		return err
+	}
+
+	var historyStore history.Store
+	if *historyFile != "" {
+		retention := history.Retention{MaxRuns: *historyMaxRuns, MaxAge: *historyMaxAge}
+		if historyStore, err = history.OpenFileStore(*historyFile, retention); err != nil {
+			return fmt.Errorf("opening history: %v", err)
+		}
+	}
+
+	var auditLog *audit.Log
+	if *auditFile != "" {
+		if auditLog, err = audit.Open(*auditFile); err != nil {
+			return fmt.Errorf("opening audit log: %v", err)
+		}
+	}
+
+	metrics := newAppMetrics()
 	app := &App{
-		httpClient: http.DefaultClient,
+		httpClient: httpClient,
+		jobs:       newJobManager(metrics.jobs),
+		metrics:    metrics,
+		sessions:   sessions,
+		scenarios:  scenarios,
+		history:    historyStore,
+		audit:      auditLog,
+		lists:      newListCache(*cacheTTL),
+		limits: &limits{
+			ip:        newRateLimiter(*ipRate, *ipBurst),
+			account:   newRateLimiter(*accountRate, *accountBurst),
+			syncs:     newSyncSlots(*maxSyncs),
+			proxyHops: *proxyHops,
+		},
+	}
+	if !*trustProxy {
+		app.limits.proxyHops = 0
+	}
+	if *registrationsFile != "" {
+		key, err := hex.DecodeString(*credentialsKey)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("-registrations needs a hex encoded 32 byte -credentials-key")
+		}
+		regs, err := newRegistrationStore(*registrationsFile, key)
+		if err != nil {
+			return fmt.Errorf("loading registrations: %v", err)
+		}
+		app.scheduler = newScheduler(app, regs, *minInterval, *upstreamMALRate, *upstreamKitsuRate)
+	}
+	smtp := notify.SMTPConfig{
+		Addr:     *smtpAddr,
+		From:     *smtpFrom,
+		User:     *smtpUser,
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+	if app.notify, err = smtp.Targets(*notifySpecs); err != nil {
+		return err
 	}
+	go app.lists.expire(time.Minute)
+	go app.limits.ip.expire(time.Minute)
+	go app.limits.account.expire(time.Minute)
 
 	// API handlers
-	http.Handle("/api/check", appHandler(app.handleCheck))
-	http.Handle("/api/sync", appHandler(app.handleSync))
-	http.Handle("/api/mal-verify", appHandler(app.handleMALVerify))
-	http.Handle("/api/mock/check", appHandler(app.handleTestCheck))
-	http.Handle("/api/mock/sync", appHandler(app.handleTestSync))
-	http.Handle("/api/mock/mal-verify", appHandler(app.handleTestMALVerify))
-
-	log.Println("Starting server at", *httpAddr)
-	if err := http.ListenAndServe(*httpAddr, nil); err != nil {
+	mux := http.DefaultServeMux
+	handleAPI(mux, "", "/check", app.limit(app.handleCheck))
+	handleAPI(mux, "", "/sync", app.limit(app.handleSync))
+	handleAPI(mux, "POST", "/login", app.limit(app.handleLogin))
+	handleAPI(mux, "POST", "/logout", app.handleLogout)
+	handleAPI(mux, "GET", "/session", app.handleSession)
+	handleAPI(mux, "GET", "/jobs/{id}/events", app.handleJobEvents)
+	handleAPI(mux, "GET", "/export", app.limit(app.handleExport))
+	handleAPI(mux, "GET", "/history", app.handleHistory)
+	handleAPI(mux, "GET", "/history/{id}", app.handleHistoryRun)
+	handleAPI(mux, "GET", "/registrations", app.handleRegistrations)
+	handleAPI(mux, "POST", "/registrations", app.limit(app.handleRegister))
+	handleAPI(mux, "GET", "/registrations/{id}", app.handleRegistration)
+	handleAPI(mux, "DELETE", "/registrations/{id}", app.handleUnregister)
+	handleAPI(mux, "POST", "/registrations/{id}/pause", app.handlePause(true))
+	handleAPI(mux, "POST", "/registrations/{id}/resume", app.handlePause(false))
+	handleAPI(mux, "", "/mock/check", app.limit(app.handleTestCheck))
+	handleAPI(mux, "", "/mock/sync", app.limit(app.handleTestSync))
+	handleAPI(mux, "POST", "/mock/login", app.limit(app.handleTestLogin))
+	handleAPI(mux, "GET", "/mock/scenarios", app.handleScenarios)
+	mux.Handle("GET "+apiPrefix+"/openapi.json", apiHandler(handleOpenAPI(newOpenAPI())))
+	mux.Handle(apiPrefix+"/", apiHandler(handleNotFound))
+	mux.Handle("GET /metrics", metrics.reg)
+
+	// Health checks
+	mux.HandleFunc("GET /healthz", app.handleHealthz)
+	mux.HandleFunc("GET /readyz", app.handleReadyz)
+	// The upstreams are not used while replaying, so they do not decide
+	// whether the server is ready.
+	if *malProbeURL != "" {
+		app.probes = append(app.probes, probe{Name: anisync.ProviderMAL, URL: *malProbeURL})
+	}
+	if *kitsuProbeURL != "" {
+		app.probes = append(app.probes, probe{Name: anisync.ProviderKitsu, URL: *kitsuProbeURL})
+	}
+	if *replayFile != "" && len(app.probes) != 0 {
+		log.Println("Not probing the upstreams while replaying them")
+		app.probes = nil
+	}
+	if app.malURL, err = baseurl.Parse(*malURL); err != nil {
+		return fmt.Errorf("parsing MyAnimeList.net URL: %v", err)
+	}
+	if app.kitsuURL, err = baseurl.Parse(*kitsuURL); err != nil {
+		return fmt.Errorf("parsing Kitsu.io URL: %v", err)
+	}
+	if app.shikimoriURL, err = baseurl.Parse(*shikimoriURL); err != nil {
+		return fmt.Errorf("parsing Shikimori.one URL: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:              *httpAddr,
+		Handler:           metrics.instrument(mux),
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if app.scheduler != nil {
+		go app.scheduler.run(ctx)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Println("Starting server at", *httpAddr)
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
 		return fmt.Errorf("ListenAndServe: %v", err)
+	case <-ctx.Done():
+		stop()
+	}
+	return shutdown(srv, app, *shutdownTimeout)
+}
+
+// newHTTPClient returns the client of the requests to the upstream APIs, which
+// records them to a cassette file or replays them from one if asked to.
+func newHTTPClient(recordFile, replayFile string) (*http.Client, error) {
+	switch {
+	case recordFile != "" && replayFile != "":
+		return nil, fmt.Errorf("-record and -replay cannot be used together")
+	case recordFile != "":
+		log.Println("Recording upstream requests to", recordFile)
+		return &http.Client{Transport: cassette.NewRecorder(recordFile, nil)}, nil
+	case replayFile != "":
+		r, err := cassette.NewReplayer(replayFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading cassette: %v", err)
+		}
+		log.Println("Replaying upstream requests from", replayFile)
+		return &http.Client{Transport: r}, nil
+	}
+	return http.DefaultClient, nil
+}
+
+// shutdown stops accepting new requests and waits for the running syncs to
+// finish, so that their clients still receive the results, before ending the
+// event streams and the rest of the requests.
+func shutdown(srv *http.Server, app *App, timeout time.Duration) error {
+	log.Println("Shutting down, waiting up to", timeout)
+	app.shuttingDown.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(ctx) }()
+	if err := app.jobs.wait(ctx); err != nil {
+		log.Println("Syncs still running at shutdown:", err)
+	}
+	app.jobs.closeStreams()
+	if err := <-done; err != nil {
+		return fmt.Errorf("shutdown: %v", err)
 	}
+	log.Println("Server stopped")
 	return nil
 }
 
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/metrics"
+)
+
+// appMetrics are the metrics of the server, served by /metrics.
+type appMetrics struct {
+	reg         *metrics.Registry
+	requests    *metrics.HistogramVec
+	syncEntries *metrics.CounterVec
+	jobs        *metrics.GaugeVec
+}
+
+func newAppMetrics() *appMetrics {
+	reg := metrics.NewRegistry()
+	m := &appMetrics{
+		reg: reg,
+		requests: reg.Histogram("anisync_http_request_duration_seconds",
+			"Latency of the HTTP requests by route and status code.",
+			nil, "route", "code"),
+		syncEntries: reg.Counter("anisync_sync_entries_total",
+			"Anime written to MyAnimeList.net by syncs, by outcome.",
+			"outcome"),
+		jobs: reg.Gauge("anisync_jobs_in_flight",
+			"Background jobs, such as syncs, that are running."),
+	}
+	m.jobs.Set(0)
+	return m
+}
+
+// resources returns Resources that record their calls in the metrics.
+func (m *appMetrics) resources(r anisync.Resources) anisync.Resources {
+	return anisync.InstrumentResources(r, m.reg)
+}
+
+// client returns a copy of c whose requests to provider, for op, are recorded
+// in the upstream metrics. It is for the API clients that are not part of
+// Resources.
+func (m *appMetrics) client(c *http.Client, provider, op string) *http.Client {
+	cc := *c
+	cc.Transport = anisync.InstrumentTransport(c.Transport, provider, op, m.reg)
+	return &cc
+}
+
+// observeSync counts the outcomes of the writes of a sync.
+func (m *appMetrics) observeSync(res *anisync.SyncResult) {
+	m.syncEntries.Add(float64(len(res.Adds)), "add")
+	m.syncEntries.Add(float64(len(res.Updates)), "update")
+	m.syncEntries.Add(float64(len(res.AddFails)), "add_fail")
+	m.syncEntries.Add(float64(len(res.UpdateFails)), "update_fail")
+}
+
+// instrument records the latency of the requests handled by mux, by the
+// pattern of the route that matched them.
+func (m *appMetrics) instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(sw, r)
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requests.Observe(time.Since(start).Seconds(), route, strconv.Itoa(sw.status))
+	})
+}
+
+// statusWriter keeps the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers, such as handleJobEvents, flush through the
+// statusWriter.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -2,7 +2,7 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -13,66 +13,66 @@ const imgPlaceholder = "/static/assets/img/placeholder_100x145.png"
 
 func (app *App) handleTestSync(w http.ResponseWriter, r *http.Request) error {
 	// Receiving json from POST body.
-	t := struct {
-		KitsuUserID string `json:"kitsuUserID"`
-		MALUsername string `json:"malUsername"`
-		MALPassword string `json:"malPassword"`
-	}{}
+	var t SyncRequest
 	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
 		return NewAppError(err, "Test sync: could not decode body.", http.StatusBadRequest)
 	}
-	kitsuUserID := t.KitsuUserID
-	malu := t.MALUsername
-
-	var malist, kitsuList []anisync.Anime
-	var syncFn syncFunc
-	switch {
-	case kitsuUserID == "test1" && kitsuUserID == malu:
-		malist, kitsuList, syncFn = test1()
-	case kitsuUserID == "test2" && kitsuUserID == malu:
-		malist, kitsuList, syncFn = test2()
-	case kitsuUserID == "test3" && kitsuUserID == malu:
-		malist, kitsuList, syncFn = test3()
-	case kitsuUserID == "test4" && kitsuUserID == malu:
-		malist, kitsuList, syncFn = test4()
-	default:
-		err := fmt.Errorf("accounts do not match or unknown test")
+	sc, err := app.scenario(t.KitsuUserID, t.MALUsername)
+	if err != nil {
 		return NewAppError(err, "Test sync: Could not run test case.", http.StatusUnauthorized)
 	}
-
-	diff := anisync.Compare(malist, kitsuList)
-	syncResult := syncMALAnimeTest(diff, syncFn)
-
-	// Including MyAnimeList account username in response.
-	resp := struct {
-		MalUsername string
-		Sync        *anisync.SyncResult
-		*anisync.Diff
-	}{
-		t.MALUsername,
-		syncResult,
-		diff,
+	if err := checkSelection(t.Select); err != nil {
+		return err
 	}
+	malist, kitsuList := sc.lists(time.Now())
 
-	bytes, err := json.Marshal(resp)
-	if err != nil {
-		return NewAppError(err, "Test sync: could not encode response.", http.StatusInternalServerError)
-	}
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write(bytes)
+	job := app.jobs.start(func(j *job) (interface{}, error) {
+		diff, err := selectDiff(anisync.Compare(malist, kitsuList), t.Select)
+		if err != nil {
+			return nil, err
+		}
+		syncResult := syncMALAnimeTest(diff, sc.write, func(e anisync.SyncEvent) {
+			j.emit(eventEntry, e)
+		})
+		if err := sc.check(syncResult); err != nil && t.Select == nil {
+			log.Println("Unexpected mock sync result:", err)
+		}
 
-	return nil
+		// Including MyAnimeList account username in response.
+		return SyncSummary{
+			MalUsername: t.MALUsername,
+			Sync:        syncResult,
+			Diff:        diff,
+		}, nil
+	})
+
+	return writeJob(w, r, job)
 }
 
-func syncMALAnimeTest(diff *anisync.Diff, syncFn func(index int, anime anisync.Anime) error) *anisync.SyncResult {
+// mockWriteDelay is how long each mock write takes so that the progress of a
+// mock sync can be seen. Tests turn it off.
+var mockWriteDelay = 300 * time.Millisecond
+
+func syncMALAnimeTest(diff *anisync.Diff, write func(op anisync.JournalOp, anime anisync.Anime) error, progress func(anisync.SyncEvent)) *anisync.SyncResult {
+	total, done := len(diff.Missing)+len(diff.NeedUpdate), 0
+	report := func(op anisync.JournalOp, a anisync.Anime, err error) {
+		time.Sleep(mockWriteDelay)
+		done++
+		e := anisync.SyncEvent{Op: op, Anime: a, Error: err, Done: done, Total: total}
+		if err != nil {
+			e.Reason = err.Error()
+		}
+		progress(e)
+	}
+
 	var (
 		adds              []anisync.AddSuccess
 		addf              []anisync.AddFail
 		removeFromMissing []int
 	)
-	for i, a := range diff.Missing {
-		err := syncFn(i, a)
+	for _, a := range diff.Missing {
+		err := write(anisync.JournalAdd, a)
+		report(anisync.JournalAdd, a, err)
 		if err != nil {
 			addf = append(addf, anisync.MakeAddFail(a, err))
 			continue
@@ -95,8 +95,9 @@ func syncMALAnimeTest(diff *anisync.Diff, syncFn func(index int, anime anisync.A
 		updf                 []anisync.UpdateFail
 		removeFromNeedUpdate []int
 	)
-	for i, d := range diff.NeedUpdate {
-		err := syncFn(i, d.Anime)
+	for _, d := range diff.NeedUpdate {
+		err := write(anisync.JournalUpdate, d.Anime)
+		report(anisync.JournalUpdate, d.Anime, err)
 		if err != nil {
 			updf = append(updf, anisync.MakeUpdateFail(d, err))
 			continue
@@ -135,347 +136,22 @@ func deleteAniDiffByID(diff []anisync.AniDiff, id int) []anisync.AniDiff {
 	return diff
 }
 
-// syncFunc is used to indicate which anime will return an error when
-// performing a mock sync.
-type syncFunc func(index int, anime anisync.Anime) error
-
-func test1() ([]anisync.Anime, []anisync.Anime, syncFunc) {
-	now := time.Now()
-	before := now.AddDate(0, 0, -1)
-
-	anime1 := "Death parade"
-	anime2 := "Ore monogatari"
-	anime3 := "Shingeki no Kyojin"
-	anime4 := "Kuroko no basuke"
-
-	malist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Rating:          "4.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 0,
-		},
-		{
-			ID:              3,
-			Title:           anime3,
-			Rating:          "3.5",
-			Image:           imgPlaceholder,
-			LastUpdated:     &before,
-			EpisodesWatched: 5,
-			Rewatching:      false,
-		},
-		{
-			ID:              4,
-			Title:           anime4,
-			Rating:          "4.5",
-			Image:           imgPlaceholder,
-			LastUpdated:     &before,
-			EpisodesWatched: 6,
-			Rewatching:      false,
-		},
-	}
-	hblist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Rating:          "4.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 0,
-		},
-		{
-			ID:          2,
-			Title:       anime2,
-			Rating:      "4.0",
-			Image:       imgPlaceholder,
-			LastUpdated: &now,
-			Status:      anisync.Current,
-		},
-		{
-			ID:              3,
-			Title:           anime3,
-			Rating:          "2.5",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			EpisodesWatched: 10,
-			Rewatching:      true,
-		},
-		{
-			ID:              4,
-			Title:           anime4,
-			Rating:          "5.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			EpisodesWatched: 6,
-			Rewatching:      true,
-		},
-	}
-	// One anime fails to update.
-	syncFn := func(index int, anime anisync.Anime) error {
-		switch anime.ID {
-		case 4:
-			return fmt.Errorf("anime failed to be updated (but that's normal!)")
-		default:
-			return nil
-		}
-		return nil
-	}
-	return malist, hblist, syncFn
-}
-
-func test2() ([]anisync.Anime, []anisync.Anime, syncFunc) {
-	now := time.Now()
-
-	anime1 := "One Piece"
-
-	malist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 2,
-		},
-	}
-
-	hblist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 2,
-		},
-	}
-	// All anime succeed.
-	syncFn := func(int, anisync.Anime) error {
-		return nil
-	}
-	return malist, hblist, syncFn
-}
-
-func test3() ([]anisync.Anime, []anisync.Anime, syncFunc) {
-	now := time.Now()
-	before := now.AddDate(0, 0, -1)
-
-	anime1 := "Berserk"
-	anime2 := "Cowboy Bebop"
-
-	malist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Image:           imgPlaceholder,
-			LastUpdated:     &before,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 0,
-		},
-	}
-
-	hblist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Rating:          "4.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.Current,
-			EpisodesWatched: 2,
-		},
-		{
-			ID:              2,
-			Title:           anime2,
-			Rating:          "3.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 0,
-		},
-	}
-	// All anime fail.
-	syncFn := func(index int, anime anisync.Anime) error {
-		switch anime.ID {
-		case 1:
-			return fmt.Errorf("anime failed to be updated (but that's normal!)")
-		case 2:
-			return fmt.Errorf("anime failed to be added (but that's normal!)")
-		default:
-			return nil
-		}
-	}
-	return malist, hblist, syncFn
-}
-
-func test4() ([]anisync.Anime, []anisync.Anime, syncFunc) {
-	now := time.Now()
-	before := now.AddDate(0, 0, -1)
-
-	anime1 := "Death parade"
-	anime2 := "Ore monogatari"
-	anime3 := "Shingeki no Kyojin"
-	anime4 := "Kuroko no basuke"
-	anime5 := "One Piece"
-	anime6 := "Berserk"
-	anime7 := "Cowboy Bebop"
-	anime8 := "Mob Psycho 100"
-
-	malist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 0,
-		},
-		{
-			ID:              2,
-			Title:           anime2,
-			Rating:          "3.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &before,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 0,
-		},
-		{
-			ID:              3,
-			Title:           anime3,
-			Rating:          "4.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &before,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 0,
-		},
-		{
-			ID:          7,
-			Title:       anime7,
-			Image:       imgPlaceholder,
-			LastUpdated: &before,
-			Status:      anisync.OnHold,
-		},
-		{
-			ID:          8,
-			Title:       anime8,
-			Image:       imgPlaceholder,
-			LastUpdated: &now,
-			Status:      anisync.OnHold,
-		},
-	}
-
-	hblist := []anisync.Anime{
-		{
-			ID:              1,
-			Title:           anime1,
-			Rating:          "4.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.Current,
-			EpisodesWatched: 2,
-		},
-		{
-			ID:              2,
-			Title:           anime2,
-			Rating:          "3.0",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.OnHold,
-			EpisodesWatched: 4,
-		},
-		{
-			ID:              3,
-			Title:           anime3,
-			Rating:          "4.5",
-			Image:           imgPlaceholder,
-			LastUpdated:     &now,
-			Status:          anisync.Planned,
-			EpisodesWatched: 8,
-		},
-		{
-			ID:          4,
-			Title:       anime4,
-			Image:       imgPlaceholder,
-			LastUpdated: &now,
-			Status:      anisync.Planned,
-		},
-		{
-			ID:          5,
-			Title:       anime5,
-			Image:       imgPlaceholder,
-			LastUpdated: &now,
-			Status:      anisync.Planned,
-		},
-		{
-			ID:          6,
-			Title:       anime6,
-			Image:       imgPlaceholder,
-			LastUpdated: &now,
-			Status:      anisync.Planned,
-		},
-		{
-			ID:          7,
-			Title:       anime7,
-			Image:       imgPlaceholder,
-			LastUpdated: &now,
-			Status:      anisync.OnHold,
-		},
-		{
-			ID:          8,
-			Title:       anime8,
-			Image:       imgPlaceholder,
-			LastUpdated: &now,
-			Status:      anisync.OnHold,
-		},
-	}
-	// Everything fails.
-	syncFn := func(index int, anime anisync.Anime) error {
-		switch anime.ID {
-		case 1, 2, 3:
-			return fmt.Errorf("anime failed to be updated (but that's normal!)")
-		case 4, 5, 6:
-			return fmt.Errorf("anime failed to be added (but that's normal!)")
-		case 7, 8:
-			return fmt.Errorf("this error should not appear because 7 and 8 are in sync")
-		default:
-			return nil
-		}
-	}
-	return malist, hblist, syncFn
-}
-
 func (app *App) handleTestCheck(w http.ResponseWriter, r *http.Request) error {
 	malu := r.FormValue("malUsername")
 	kitsuUserID := r.FormValue("kitsuUserID")
 
-	var malist, kitsuList []anisync.Anime
-	switch {
-	case kitsuUserID == "test1" && kitsuUserID == malu:
-		malist, kitsuList, _ = test1()
-	case kitsuUserID == "test2" && kitsuUserID == malu:
-		malist, kitsuList, _ = test2()
-	case kitsuUserID == "test3" && kitsuUserID == malu:
-		malist, kitsuList, _ = test3()
-	case kitsuUserID == "test4" && kitsuUserID == malu:
-		malist, kitsuList, _ = test4()
-	default:
-		err := fmt.Errorf("accounts do not match or unknown test")
+	sc, err := app.scenario(kitsuUserID, malu)
+	if err != nil {
 		return NewAppError(err, "Test check: Could not run test case.", http.StatusUnauthorized)
 	}
+	malist, kitsuList := sc.lists(time.Now())
 
 	diff := anisync.Compare(malist, kitsuList)
 
 	// Including MyAnimeList account username in mock response.
-	resp := struct {
-		MalUsername string
-		*anisync.Diff
-	}{
-		malu,
-		diff,
+	resp := CheckResponse{
+		MalUsername: malu,
+		Diff:        diff,
 	}
 
 	bytes, err := json.Marshal(resp)
@@ -487,3 +163,13 @@ func (app *App) handleTestCheck(w http.ResponseWriter, r *http.Request) error {
 	w.Write(bytes)
 	return nil
 }
+
+// handleTestLogin accepts any credentials without creating a session, as the
+// mock endpoints do not need one.
+func (app *App) handleTestLogin(w http.ResponseWriter, r *http.Request) error {
+	var t LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		return NewAppError(err, "Test login: could not decode body.", http.StatusBadRequest)
+	}
+	return writeSession(w, &session{MALUsername: t.MALUsername, Expires: time.Now().Add(30 * time.Minute)})
+}
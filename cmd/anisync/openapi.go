@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/history"
+)
+
+// object is a JSON object of the OpenAPI document.
+type object map[string]interface{}
+
+// schemaGen generates JSON schemas from Go types. Named struct types are added
+// to schemas once and are referenced from everywhere else.
+type schemaGen struct {
+	schemas object
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schema(t reflect.Type) object {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return object{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// Reserving the name first in case the type refers to itself.
+			g.schemas[t.Name()] = object{}
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return object{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	// Interfaces, such as the errors of the results, are encoded as is.
+	return object{}
+}
+
+// object returns the schema of a struct, following the rules of encoding/json
+// for field names and embedded structs.
+func (g *schemaGen) object(t reflect.Type) object {
+	props := object{}
+	g.fields(t, props)
+	return object{"type": "object", "properties": props}
+}
+
+func (g *schemaGen) fields(t reflect.Type, props object) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, props)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+func (g *schemaGen) ref(v interface{}) object {
+	return g.schema(reflect.TypeOf(v))
+}
+
+// newOpenAPI generates the OpenAPI description of the versioned API.
+func newOpenAPI() object {
+	g := &schemaGen{schemas: object{}}
+	jsonContent := func(v interface{}) object {
+		return object{"application/json": object{"schema": g.ref(v)}}
+	}
+	response := func(description string, v interface{}) object {
+		r := object{"description": description}
+		if v != nil {
+			r["content"] = jsonContent(v)
+		}
+		return r
+	}
+	operation := func(summary string, req interface{}, status string, resp object) object {
+		op := object{
+			"summary": summary,
+			"responses": object{
+				status:    resp,
+				"default": response("Error.", ErrorResponse{}),
+			},
+		}
+		if req != nil {
+			op["requestBody"] = object{"required": true, "content": jsonContent(req)}
+		}
+		return op
+	}
+	query := func(name, description string) object {
+		return object{"name": name, "in": "query", "description": description, "schema": object{"type": "string"}}
+	}
+
+	check := operation("Compares the MyAnimeList.net and Kitsu.io or Shikimori.one lists of an account.", nil, "200", response("The difference between the lists.", CheckResponse{}))
+	check["parameters"] = []object{
+		query("kitsuUserID", "The Kitsu.io user ID."),
+		query("shikimoriUser", "The Shikimori.one nickname or user ID, to compare the Shikimori.one list instead of the Kitsu.io list."),
+		query("malUsername", "The MyAnimeList.net username. Defaults to the account of the current session."),
+	}
+	check["responses"].(object)["304"] = response("The difference has not changed since the ETag or time of the conditional request.", nil)
+	events := operation("Streams the events of a job as Server-Sent Events.", nil, "200", object{
+		"description": "The events of the job. Entry events hold a SyncEvent, the summary event holds the result of the job, such as a SyncSummary, and failure events hold an ErrorResponse.",
+		"content":     object{"text/event-stream": object{"schema": object{"type": "string"}}},
+	})
+	events["parameters"] = []object{
+		{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}},
+		{"name": "Last-Event-ID", "in": "header", "description": "Continue after this event.", "schema": object{"type": "integer"}},
+	}
+	events["responses"].(object)["204"] = response("The job is done and there are no more events.", nil)
+	hist := operation("Lists the syncs of the account of the current session, newest first.", nil, "200", response("The sync runs.", HistoryResponse{}))
+	hist["parameters"] = []object{
+		query("kitsuUserID", "Only the syncs from this Kitsu.io user ID."),
+		query("since", "Only the syncs that started at or after this RFC 3339 time."),
+		query("failed", "If true, only the syncs that failed or had failed writes."),
+		query("limit", "At most this many syncs, between 1 and 100. Defaults to 20."),
+	}
+	histRun := operation("Describes a sync of the account of the current session, with the outcome of each anime.", nil, "200", response("The sync run.", history.Run{}))
+	histRun["parameters"] = []object{{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}}}
+	idParam := []object{{"name": "id", "in": "path", "required": true, "schema": object{"type": "string"}}}
+	withID := func(op object) object {
+		op["parameters"] = idParam
+		return op
+	}
+	export := operation("Exports a list as a MyAnimeList.net XML list file, to import to MyAnimeList.net by hand or keep as a backup.", nil, "200", object{
+		"description": "The list file.",
+		"content": object{
+			"application/xml":  object{"schema": object{"type": "string"}},
+			"application/gzip": object{"schema": object{"type": "string", "format": "binary"}},
+		},
+	})
+	export["parameters"] = []object{
+		query("list", "The list to export, kitsu (default), shikimori or mal."),
+		query("kitsuUserID", "The Kitsu.io user ID, for the kitsu list."),
+		query("shikimoriUser", "The Shikimori.one nickname or user ID, for the shikimori list."),
+		query("malUsername", "The MyAnimeList.net username. Defaults to the account of the current session."),
+		query("gzip", "If true, the file is gzipped."),
+	}
+	register := operation("Registers a Kitsu.io account to be synced to the account of the current session on a schedule, storing the password of the session encrypted.",
+		RegistrationRequest{}, "201", response("The new registration.", RegistrationResponse{}))
+	register["responses"].(object)["200"] = response("The accounts were already registered. Their schedule and password were replaced and the registration was resumed.", RegistrationResponse{})
+	g.ref(anisync.SyncEvent{})
+	g.ref(SyncSummary{})
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "anisync",
+			"description": "Syncs Kitsu.io anime lists to MyAnimeList.net.",
+			"version":     "1",
+		},
+		"servers": []object{{"url": apiPrefix}},
+		"paths": object{
+			"/check": object{"get": check},
+			"/sync": object{"post": operation("Starts syncing the account of the current session in the background.",
+				SyncRequest{}, "202", response("The sync job.", JobResponse{}))},
+			"/jobs/{id}/events": object{"get": events},
+			"/export":           object{"get": export},
+			"/history":          object{"get": hist},
+			"/history/{id}":     object{"get": histRun},
+			"/registrations": object{
+				"get": operation("Lists the scheduled syncs of the account of the current session.",
+					nil, "200", response("The registrations.", []RegistrationResponse{})),
+				"post": register,
+			},
+			"/registrations/{id}": object{
+				"get": withID(operation("Describes a registration of the account of the current session.",
+					nil, "200", response("The registration.", RegistrationResponse{}))),
+				"delete": withID(operation("Deletes a registration and its stored password.",
+					nil, "204", response("Deleted.", nil))),
+			},
+			"/registrations/{id}/pause": object{"post": withID(operation("Pauses the scheduled syncs of a registration.",
+				nil, "200", response("The registration.", RegistrationResponse{})))},
+			"/registrations/{id}/resume": object{"post": withID(operation("Resumes the scheduled syncs of a registration from now.",
+				nil, "200", response("The registration.", RegistrationResponse{})))},
+			"/login": object{"post": operation("Verifies MyAnimeList.net credentials and starts a session.",
+				LoginRequest{}, "200", response("The new session, also set as a cookie.", SessionResponse{}))},
+			"/logout": object{"post": operation("Ends the current session.",
+				nil, "204", response("Logged out.", nil))},
+			"/session": object{"get": operation("Describes the current session.",
+				nil, "200", response("The current session.", SessionResponse{}))},
+			"/mock/scenarios": object{"get": operation("Lists the mock scenarios, which are run by using their name as both accounts of the mock endpoints.",
+				nil, "200", response("The mock scenarios.", []ScenarioInfo{}))},
+			"/openapi.json": object{"get": operation("Returns this document.",
+				nil, "200", object{"description": "The OpenAPI description of the API."})},
+		},
+		"components": object{"schemas": g.schemas},
+	}
+}
+
+// handleOpenAPI serves the OpenAPI description of the API.
+func handleOpenAPI(doc object) func(http.ResponseWriter, *http.Request) error {
+	b, err := json.MarshalIndent(doc, "", "  ")
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err != nil {
+			return NewAppError(err, "OpenAPI: Could not encode document.", http.StatusInternalServerError)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+		return nil
+	}
+}
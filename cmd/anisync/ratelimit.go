@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncRetryAfter is how long clients are asked to wait when there are already
+// too many syncs running for their account.
+const syncRetryAfter = 10 * time.Second
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limits the rate of events per key using token buckets. Each key
+// can have up to burst events at once, refilled at rate per second.
+type rateLimiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// newRateLimiter creates a rate limiter that allows perMinute events per key.
+// A limiter with perMinute 0 allows everything.
+func newRateLimiter(perMinute float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: perMinute / 60, burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// allow reports whether an event for key is allowed now and if not, how long
+// until it will be.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// expire removes the buckets that have been refilled every interval, as they
+// are the same as new ones. It never returns.
+func (l *rateLimiter) expire(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		l.mu.Lock()
+		for key, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= float64(l.burst) {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// syncSlots caps the number of syncs that run at the same time for each
+// MyAnimeList.net account.
+type syncSlots struct {
+	max int
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func newSyncSlots(max int) *syncSlots {
+	return &syncSlots{max: max, running: make(map[string]int)}
+}
+
+// acquire takes a slot for account if one is free. A taken slot has to be
+// given back with release.
+func (s *syncSlots) acquire(account string) bool {
+	account = strings.ToLower(account)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.max > 0 && s.running[account] >= s.max {
+		return false
+	}
+	s.running[account]++
+	return true
+}
+
+func (s *syncSlots) release(account string) {
+	account = strings.ToLower(account)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[account]--; s.running[account] <= 0 {
+		delete(s.running, account)
+	}
+}
+
+// limits holds the rate limiters of the server.
+type limits struct {
+	ip        *rateLimiter
+	account   *rateLimiter
+	syncs     *syncSlots
+	proxyHops int // The trusted proxies that append to X-Forwarded-For, 0 to ignore it.
+}
+
+// limit wraps fn so that requests are rejected with Too Many Requests when
+// the client IP or any of the MyAnimeList.net and Kitsu.io accounts of the
+// request is over its limit.
+func (app *App) limit(fn func(http.ResponseWriter, *http.Request) error) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		now := time.Now()
+		if ok, wait := app.limits.ip.allow(clientIP(r, app.limits.proxyHops), now); !ok {
+			return tooManyRequests(w, wait, fmt.Errorf("too many requests from this address"))
+		}
+		for _, account := range app.requestAccounts(r) {
+			if ok, wait := app.limits.account.allow(account, now); !ok {
+				return tooManyRequests(w, wait, fmt.Errorf("too many requests for account %s", account))
+			}
+		}
+		return fn(w, r)
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration, err error) error {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return NewAppError(err, "Too many requests. Please try again later.", http.StatusTooManyRequests)
+}
+
+// clientIP returns the IP of the client that made r. Behind proxyHops trusted
+// proxies, each of which appends the address it got the request from to
+// X-Forwarded-For, it is the proxyHops-th address from the right. The
+// addresses before it are sent by the client and cannot be trusted.
+func clientIP(r *http.Request, proxyHops int) string {
+	if proxyHops > 0 {
+		var addrs []string
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			for _, a := range strings.Split(h, ",") {
+				if a = strings.TrimSpace(a); a != "" {
+					addrs = append(addrs, a)
+				}
+			}
+		}
+		if len(addrs) != 0 {
+			return addrs[max(len(addrs)-proxyHops, 0)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// maxPeekBody is how much of a request body requestAccounts reads.
+const maxPeekBody = 1 << 20
+
+// requestAccounts returns the upstream accounts that r acts on, from its
+// query, its JSON body and its session, as keys such as "mal:username". The
+// body is left intact for the handler.
+func (app *App) requestAccounts(r *http.Request) []string {
+	var t struct {
+		KitsuUserID   string `json:"kitsuUserID"`
+		ShikimoriUser string `json:"shikimoriUser"`
+		MALUsername   string `json:"malUsername"`
+	}
+	q := r.URL.Query()
+	t.KitsuUserID, t.ShikimoriUser, t.MALUsername = q.Get("kitsuUserID"), q.Get("shikimoriUser"), q.Get("malUsername")
+	if r.Body != nil && r.Method == http.MethodPost {
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+		if err == nil {
+			json.Unmarshal(b, &t)
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(b), r.Body))
+	}
+
+	var accounts []string
+	if t.MALUsername != "" {
+		accounts = append(accounts, "mal:"+strings.ToLower(t.MALUsername))
+	}
+	if sess, err := app.sessions.get(r); err == nil && !strings.EqualFold(sess.MALUsername, t.MALUsername) {
+		accounts = append(accounts, "mal:"+strings.ToLower(sess.MALUsername))
+	}
+	if t.KitsuUserID != "" {
+		accounts = append(accounts, "kitsu:"+t.KitsuUserID)
+	}
+	if t.ShikimoriUser != "" {
+		accounts = append(accounts, "shikimori:"+strings.ToLower(t.ShikimoriUser))
+	}
+	return accounts
+}
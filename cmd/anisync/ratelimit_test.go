@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+var clientIPTests = []struct {
+	name       string
+	remoteAddr string
+	forwarded  []string
+	proxyHops  int
+	want       string
+}{
+	{name: "no proxy", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+	{name: "no proxy ignores header", remoteAddr: "10.0.0.1:1234", forwarded: []string{"1.1.1.1"}, want: "10.0.0.1"},
+	{name: "remote without port", remoteAddr: "10.0.0.1", want: "10.0.0.1"},
+	{name: "proxy without header", remoteAddr: "10.0.0.1:1234", proxyHops: 1, want: "10.0.0.1"},
+	{name: "one proxy", remoteAddr: "10.0.0.1:1234", forwarded: []string{"2.2.2.2"}, proxyHops: 1, want: "2.2.2.2"},
+	{name: "one proxy spoofed", remoteAddr: "10.0.0.1:1234", forwarded: []string{"1.1.1.1, 2.2.2.2"}, proxyHops: 1, want: "2.2.2.2"},
+	{name: "one proxy spoofed headers", remoteAddr: "10.0.0.1:1234", forwarded: []string{"1.1.1.1", "2.2.2.2"}, proxyHops: 1, want: "2.2.2.2"},
+	{name: "two proxies", remoteAddr: "10.0.0.1:1234", forwarded: []string{"1.1.1.1, 2.2.2.2,3.3.3.3"}, proxyHops: 2, want: "2.2.2.2"},
+	{name: "fewer addresses than proxies", remoteAddr: "10.0.0.1:1234", forwarded: []string{"2.2.2.2"}, proxyHops: 3, want: "2.2.2.2"},
+	{name: "empty entries", remoteAddr: "10.0.0.1:1234", forwarded: []string{"2.2.2.2, ,"}, proxyHops: 1, want: "2.2.2.2"},
+}
+
+func TestClientIP(t *testing.T) {
+	for _, tt := range clientIPTests {
+		r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+		for _, f := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		if got := clientIP(r, tt.proxyHops); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		perMinute float64
+		burst     int
+		events    []time.Duration // Offsets from start.
+		want      []bool
+		wantWait  time.Duration // Of the last event.
+	}{
+		{name: "burst", perMinute: 60, burst: 3, events: []time.Duration{0, 0, 0, 0}, want: []bool{true, true, true, false}, wantWait: time.Second},
+		{name: "refill", perMinute: 60, burst: 1, events: []time.Duration{0, 500 * time.Millisecond, time.Second}, want: []bool{true, false, true}},
+		{name: "partial wait", perMinute: 60, burst: 1, events: []time.Duration{0, 250 * time.Millisecond}, want: []bool{true, false}, wantWait: 750 * time.Millisecond},
+		{name: "refill up to burst", perMinute: 60, burst: 2, events: []time.Duration{0, time.Hour, time.Hour, time.Hour}, want: []bool{true, true, true, false}, wantWait: time.Second},
+		{name: "no limit", perMinute: 0, burst: 1, events: []time.Duration{0, 0, 0}, want: []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		l := newRateLimiter(tt.perMinute, tt.burst)
+		var wait time.Duration
+		for i, off := range tt.events {
+			var ok bool
+			ok, wait = l.allow("key", start.Add(off))
+			if ok != tt.want[i] {
+				t.Errorf("%s: event %d allowed = %v, want %v", tt.name, i, ok, tt.want[i])
+			}
+		}
+		if wait != tt.wantWait {
+			t.Errorf("%s: wait = %v, want %v", tt.name, wait, tt.wantWait)
+		}
+		if ok, _ := l.allow("other", start); !ok {
+			t.Errorf("%s: other key not allowed", tt.name)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/schedule"
+)
+
+var errNoRegistration = errors.New("no such registration")
+
+// registration is a pair of accounts that the scheduler syncs on a schedule.
+type registration struct {
+	ID          string
+	MALUsername string
+	KitsuUserID string
+	Schedule    string
+	Paused      bool
+	Created     time.Time
+	// Password is the MyAnimeList.net password, sealed with the credentials
+	// key and the ID of the registration.
+	Password  []byte
+	NextRun   time.Time
+	LastRun   time.Time
+	LastJobID string
+	LastError string
+	Failures  int // Consecutive failed runs.
+}
+
+// registrationStore keeps the registrations in memory and saves them to a
+// file after every change. The passwords are only ever stored encrypted.
+type registrationStore struct {
+	path string
+	aead cipher.AEAD
+
+	mu      sync.Mutex
+	regs    map[string]*registration
+	running map[string]bool // IDs of the registrations that are being synced.
+}
+
+// newRegistrationStore loads the registrations from the file at path, if it
+// exists. The key encrypts the passwords and must be 32 bytes.
+func newRegistrationStore(path string, key []byte) (*registrationStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("credentials key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s := &registrationStore{path: path, aead: aead, regs: make(map[string]*registration), running: make(map[string]bool)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var regs []*registration
+	if err := json.Unmarshal(b, &regs); err != nil {
+		return nil, fmt.Errorf("decoding registrations %s: %v", path, err)
+	}
+	for _, reg := range regs {
+		if _, err := s.open(reg); err != nil {
+			return nil, fmt.Errorf("registration %s: %v", reg.ID, err)
+		}
+		s.regs[reg.ID] = reg
+	}
+	return s, nil
+}
+
+// save writes the registrations to a temporary file and renames it so that a
+// crash cannot leave a half written file behind. The store must be locked.
+func (s *registrationStore) save() error {
+	regs := make([]*registration, 0, len(s.regs))
+	for _, reg := range s.regs {
+		regs = append(regs, reg)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Created.Before(regs[j].Created) })
+	b, err := json.MarshalIndent(regs, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *registrationStore) seal(id, password string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, []byte(password), []byte(id)), nil
+}
+
+// open decrypts the password of a registration.
+func (s *registrationStore) open(reg *registration) (string, error) {
+	if len(reg.Password) < s.aead.NonceSize() {
+		return "", errors.New("invalid encrypted password")
+	}
+	nonce, ciphertext := reg.Password[:s.aead.NonceSize()], reg.Password[s.aead.NonceSize():]
+	password, err := s.aead.Open(nil, nonce, ciphertext, []byte(reg.ID))
+	if err != nil {
+		return "", errors.New("password cannot be decrypted, was the credentials key changed?")
+	}
+	return string(password), nil
+}
+
+// put registers a pair of accounts. If the pair is already registered, its
+// schedule and password are replaced and it is resumed. It reports whether the
+// registration is new.
+func (s *registrationStore) put(malUsername, malPassword, kitsuUserID, spec string, sched schedule.Schedule, now time.Time) (registration, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reg *registration
+	for _, r := range s.regs {
+		if strings.EqualFold(r.MALUsername, malUsername) && r.KitsuUserID == kitsuUserID {
+			reg = r
+		}
+	}
+	created := reg == nil
+	if created {
+		reg = &registration{ID: newJobID(), MALUsername: malUsername, KitsuUserID: kitsuUserID, Created: now}
+	}
+	password, err := s.seal(reg.ID, malPassword)
+	if err != nil {
+		return registration{}, false, err
+	}
+	old := *reg
+	reg.Password = password
+	reg.Schedule = spec
+	reg.Paused = false
+	reg.Failures = 0
+	reg.NextRun = sched.Next(now)
+	s.regs[reg.ID] = reg
+	if err := s.save(); err != nil {
+		if created {
+			delete(s.regs, reg.ID)
+		} else {
+			*reg = old
+		}
+		return registration{}, false, err
+	}
+	return *reg, created, nil
+}
+
+// list returns the registrations of a MyAnimeList.net account, oldest first.
+func (s *registrationStore) list(malUsername string) []registration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	regs := []registration{}
+	for _, reg := range s.regs {
+		if strings.EqualFold(reg.MALUsername, malUsername) {
+			regs = append(regs, *reg)
+		}
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Created.Before(regs[j].Created) })
+	return regs
+}
+
+// get returns a registration of a MyAnimeList.net account.
+func (s *registrationStore) get(malUsername, id string) (registration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reg, ok := s.regs[id]
+	if !ok || !strings.EqualFold(reg.MALUsername, malUsername) {
+		return registration{}, errNoRegistration
+	}
+	return *reg, nil
+}
+
+// delete removes a registration of a MyAnimeList.net account. A run that is in
+// progress is allowed to finish.
+func (s *registrationStore) delete(malUsername, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reg, ok := s.regs[id]
+	if !ok || !strings.EqualFold(reg.MALUsername, malUsername) {
+		return errNoRegistration
+	}
+	delete(s.regs, id)
+	if err := s.save(); err != nil {
+		s.regs[id] = reg
+		return err
+	}
+	return nil
+}
+
+// setPaused pauses or resumes a registration of a MyAnimeList.net account.
+// Resuming schedules the next run from now and forgets the past failures.
+func (s *registrationStore) setPaused(malUsername, id string, paused bool, now time.Time) (registration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reg, ok := s.regs[id]
+	if !ok || !strings.EqualFold(reg.MALUsername, malUsername) {
+		return registration{}, errNoRegistration
+	}
+	old := *reg
+	reg.Paused = paused
+	if !paused {
+		sched, err := schedule.Parse(reg.Schedule)
+		if err != nil {
+			return registration{}, err
+		}
+		reg.NextRun = sched.Next(now)
+		reg.Failures = 0
+	}
+	if err := s.save(); err != nil {
+		*reg = old
+		return registration{}, err
+	}
+	return *reg, nil
+}
+
+// due returns the registrations that should run at now and marks them as
+// running. They have to be given back with finish.
+func (s *registrationStore) due(now time.Time) []registration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var regs []registration
+	for _, reg := range s.regs {
+		if reg.Paused || s.running[reg.ID] || reg.NextRun.After(now) {
+			continue
+		}
+		s.running[reg.ID] = true
+		regs = append(regs, *reg)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].NextRun.Before(regs[j].NextRun) })
+	return regs
+}
+
+// finish records the outcome of a run of a registration that started at
+// started and schedules its next run. After maxFailures consecutive failures
+// the registration is paused. If the run did not start, because jobID is
+// empty, it is retried at retry instead.
+func (s *registrationStore) finish(id string, started time.Time, jobID string, runErr error, retry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, id)
+	reg, ok := s.regs[id]
+	if !ok {
+		return nil // Deleted while running.
+	}
+	if jobID == "" {
+		reg.NextRun = retry
+		return nil
+	}
+	reg.LastRun = started
+	reg.LastJobID = jobID
+	reg.LastError = ""
+	if runErr != nil {
+		reg.LastError = runErr.Error()
+		reg.Failures++
+	} else {
+		reg.Failures = 0
+	}
+	if reg.Failures >= maxRegistrationFailures {
+		reg.Paused = true
+	}
+	if sched, err := schedule.Parse(reg.Schedule); err == nil {
+		reg.NextRun = sched.Next(time.Now())
+	} else {
+		reg.Paused = true
+		reg.LastError = err.Error()
+	}
+	return s.save()
+}
+
+// parseRegistrationSchedule parses the schedule of a registration and checks
+// that it does not run more often than minInterval.
+func parseRegistrationSchedule(spec string, minInterval time.Duration, now time.Time) (schedule.Schedule, error) {
+	sched, err := schedule.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	next := sched.Next(now)
+	if next.IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", spec)
+	}
+	// The gaps of cron schedules vary, so a few runs are checked.
+	for i := 0; i < 24; i++ {
+		after := sched.Next(next)
+		if after.IsZero() {
+			break
+		}
+		if after.Sub(next) < minInterval {
+			return nil, fmt.Errorf("schedule %q runs more often than every %v", spec, minInterval)
+		}
+		next = after
+	}
+	return sched, nil
+}
+
+func newRegistrationResponse(reg registration) RegistrationResponse {
+	return RegistrationResponse{
+		ID:          reg.ID,
+		MALUsername: reg.MALUsername,
+		KitsuUserID: reg.KitsuUserID,
+		Schedule:    reg.Schedule,
+		Paused:      reg.Paused,
+		Created:     reg.Created,
+		NextRun:     reg.NextRun,
+		LastRun:     reg.LastRun,
+		LastJobID:   reg.LastJobID,
+		LastError:   reg.LastError,
+		Failures:    reg.Failures,
+	}
+}
+
+// registrationSession returns the scheduler and the session of a request to
+// the registrations API.
+func (app *App) registrationSession(r *http.Request) (*scheduler, *session, error) {
+	if app.scheduler == nil {
+		err := errors.New("scheduled syncs are not enabled on this server")
+		return nil, nil, NewAppError(err, "Registrations: Scheduled syncs are not enabled.", http.StatusNotFound)
+	}
+	sess, err := app.sessions.get(r)
+	if err != nil {
+		return nil, nil, NewAppError(err, "Registrations: Please log in to MyAnimeList first.", http.StatusUnauthorized)
+	}
+	return app.scheduler, sess, nil
+}
+
+// handleRegistrations lists the registrations of the account of the current
+// session.
+func (app *App) handleRegistrations(w http.ResponseWriter, r *http.Request) error {
+	sched, sess, err := app.registrationSession(r)
+	if err != nil {
+		return err
+	}
+	resp := []RegistrationResponse{}
+	for _, reg := range sched.regs.list(sess.MALUsername) {
+		resp = append(resp, newRegistrationResponse(reg))
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	writeJSON(w, resp)
+	return nil
+}
+
+// handleRegister registers a Kitsu.io account to be synced to the
+// MyAnimeList.net account of the current session on a schedule, with the
+// password of the session. Registering a pair again updates its schedule and
+// password.
+func (app *App) handleRegister(w http.ResponseWriter, r *http.Request) error {
+	sched, sess, err := app.registrationSession(r)
+	if err != nil {
+		return err
+	}
+	var req RegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return NewAppError(err, "Registrations: Could not decode request.", http.StatusBadRequest)
+	}
+	if req.KitsuUserID == "" {
+		err := errors.New("missing kitsuUserID")
+		return NewAppError(err, "Registrations: Please provide a Kitsu user ID.", http.StatusBadRequest)
+	}
+	now := time.Now()
+	s, err := parseRegistrationSchedule(req.Schedule, sched.minInterval, now)
+	if err != nil {
+		return NewAppError(err, "Registrations: Invalid schedule.", http.StatusBadRequest)
+	}
+	reg, created, err := sched.regs.put(sess.MALUsername, sess.MALPassword, req.KitsuUserID, req.Schedule, s, now)
+	if err != nil {
+		return NewAppError(err, "Registrations: Could not save registration.", http.StatusInternalServerError)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if created {
+		w.Header().Set("Location", apiBase(r)+"/registrations/"+reg.ID)
+		w.WriteHeader(http.StatusCreated)
+	}
+	writeJSON(w, newRegistrationResponse(reg))
+	return nil
+}
+
+// handleRegistration describes a registration of the account of the current
+// session.
+func (app *App) handleRegistration(w http.ResponseWriter, r *http.Request) error {
+	sched, sess, err := app.registrationSession(r)
+	if err != nil {
+		return err
+	}
+	reg, err := sched.regs.get(sess.MALUsername, r.PathValue("id"))
+	if err != nil {
+		return NewAppError(err, "Registrations: No such registration.", http.StatusNotFound)
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	writeJSON(w, newRegistrationResponse(reg))
+	return nil
+}
+
+// handleUnregister deletes a registration of the account of the current
+// session, along with its stored password.
+func (app *App) handleUnregister(w http.ResponseWriter, r *http.Request) error {
+	sched, sess, err := app.registrationSession(r)
+	if err != nil {
+		return err
+	}
+	err = sched.regs.delete(sess.MALUsername, r.PathValue("id"))
+	if errors.Is(err, errNoRegistration) {
+		return NewAppError(err, "Registrations: No such registration.", http.StatusNotFound)
+	}
+	if err != nil {
+		return NewAppError(err, "Registrations: Could not save registrations.", http.StatusInternalServerError)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handlePause returns a handler that pauses or resumes a registration of the
+// account of the current session.
+func (app *App) handlePause(paused bool) func(http.ResponseWriter, *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		sched, sess, err := app.registrationSession(r)
+		if err != nil {
+			return err
+		}
+		reg, err := sched.regs.setPaused(sess.MALUsername, r.PathValue("id"), paused, time.Now())
+		if errors.Is(err, errNoRegistration) {
+			return NewAppError(err, "Registrations: No such registration.", http.StatusNotFound)
+		}
+		if err != nil {
+			return NewAppError(err, "Registrations: Could not save registration.", http.StatusInternalServerError)
+		}
+		writeJSON(w, newRegistrationResponse(reg))
+		return nil
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync/schedule"
+)
+
+var testCredentialsKey = bytes.Repeat([]byte{7}, 32)
+
+func newTestRegistrationStore(t *testing.T) *registrationStore {
+	t.Helper()
+	s, err := newRegistrationStore(filepath.Join(t.TempDir(), "registrations.json"), testCredentialsKey)
+	if err != nil {
+		t.Fatal("newRegistrationStore returned err:", err)
+	}
+	return s
+}
+
+func putTestRegistration(t *testing.T, s *registrationStore, malUsername, password, kitsuUserID string, now time.Time) registration {
+	t.Helper()
+	sched, err := schedule.Parse("1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, _, err := s.put(malUsername, password, kitsuUserID, "1h", sched, now)
+	if err != nil {
+		t.Fatal("put returned err:", err)
+	}
+	return reg
+}
+
+func TestRegistrationPassword(t *testing.T) {
+	s := newTestRegistrationStore(t)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	reg := putTestRegistration(t, s, "TestUser", "TestPass", "42", now)
+
+	if bytes.Contains(reg.Password, []byte("TestPass")) {
+		t.Error("stored password is not encrypted")
+	}
+	if got, err := s.open(&reg); err != nil || got != "TestPass" {
+		t.Errorf("open = %q, %v, want %q", got, err, "TestPass")
+	}
+	// The password is sealed with the ID, so it cannot be moved to another
+	// registration.
+	other := reg
+	other.ID = "other"
+	if _, err := s.open(&other); err == nil {
+		t.Error("open of a password moved to another registration expected to return err")
+	}
+	other = reg
+	other.Password = other.Password[:4]
+	if _, err := s.open(&other); err == nil {
+		t.Error("open of a truncated password expected to return err")
+	}
+
+	// The registrations are loaded back with the same key only.
+	s2, err := newRegistrationStore(s.path, testCredentialsKey)
+	if err != nil {
+		t.Fatal("newRegistrationStore returned err:", err)
+	}
+	if got, err := s2.get("testuser", reg.ID); err != nil || got.KitsuUserID != "42" {
+		t.Errorf("get after reloading = %+v, %v, want the registration of Kitsu.io user 42", got, err)
+	}
+	if _, err := newRegistrationStore(s.path, bytes.Repeat([]byte{8}, 32)); err == nil {
+		t.Error("newRegistrationStore with another key expected to return err")
+	}
+	if _, err := newRegistrationStore(s.path, []byte("short")); err == nil {
+		t.Error("newRegistrationStore with a short key expected to return err")
+	}
+
+	// Registering the pair again replaces the password of the registration.
+	again := putTestRegistration(t, s, "testuser", "NewPass", "42", now)
+	if again.ID != reg.ID {
+		t.Errorf("registering again gave ID %s, want %s", again.ID, reg.ID)
+	}
+	if got, err := s.open(&again); err != nil || got != "NewPass" {
+		t.Errorf("open after registering again = %q, %v, want %q", got, err, "NewPass")
+	}
+	if b, err := os.ReadFile(s.path); err != nil || bytes.Contains(b, []byte("NewPass")) {
+		t.Errorf("registrations file holds the plain password or cannot be read: %v", err)
+	}
+}
+
+func TestRegistrationDueAndFinish(t *testing.T) {
+	s := newTestRegistrationStore(t)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	reg := putTestRegistration(t, s, "TestUser", "TestPass", "42", now)
+
+	if due := s.due(now); len(due) != 0 {
+		t.Fatalf("due before the next run = %v, want none", due)
+	}
+	later := now.Add(time.Hour)
+	if due := s.due(later); len(due) != 1 || due[0].ID != reg.ID {
+		t.Fatalf("due at the next run = %v, want the registration", due)
+	}
+	if due := s.due(later); len(due) != 0 {
+		t.Fatalf("due while running = %v, want none", due)
+	}
+
+	// A run that did not start is retried without counting as a failure.
+	retry := later.Add(time.Minute)
+	if err := s.finish(reg.ID, later, "", nil, retry); err != nil {
+		t.Fatal("finish returned err:", err)
+	}
+	got, _ := s.get("TestUser", reg.ID)
+	if !got.NextRun.Equal(retry) || got.Failures != 0 || got.LastJobID != "" {
+		t.Errorf("after a run that did not start got %+v, want next run at %v and no failures", got, retry)
+	}
+
+	// Failed runs are counted until a run succeeds.
+	for i := 1; i <= 2; i++ {
+		if err := s.finish(reg.ID, retry, "job", errors.New("sync failed"), retry); err != nil {
+			t.Fatal("finish returned err:", err)
+		}
+		got, _ = s.get("TestUser", reg.ID)
+		if got.Failures != i || got.LastError != "sync failed" || got.Paused {
+			t.Errorf("after %d failed runs got %+v, want %d failures", i, got, i)
+		}
+	}
+	if err := s.finish(reg.ID, retry, "job", nil, retry); err != nil {
+		t.Fatal("finish returned err:", err)
+	}
+	got, _ = s.get("TestUser", reg.ID)
+	if got.Failures != 0 || got.LastError != "" || got.LastJobID != "job" || !got.LastRun.Equal(retry) {
+		t.Errorf("after a successful run got %+v, want no failures", got)
+	}
+}
+
+func TestRegistrationAutoPause(t *testing.T) {
+	s := newTestRegistrationStore(t)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	reg := putTestRegistration(t, s, "TestUser", "TestPass", "42", now)
+
+	for i := 0; i < maxRegistrationFailures; i++ {
+		if err := s.finish(reg.ID, now, "job", errors.New("wrong password"), now); err != nil {
+			t.Fatal("finish returned err:", err)
+		}
+	}
+	got, _ := s.get("TestUser", reg.ID)
+	if !got.Paused || got.Failures != maxRegistrationFailures {
+		t.Fatalf("after %d failed runs got %+v, want it paused", maxRegistrationFailures, got)
+	}
+	if due := s.due(got.NextRun.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("due of a paused registration = %v, want none", due)
+	}
+
+	// Registering the pair again resumes it.
+	putTestRegistration(t, s, "TestUser", "TestPass", "42", now)
+	got, _ = s.get("TestUser", reg.ID)
+	if got.Paused || got.Failures != 0 {
+		t.Errorf("after registering again got %+v, want it resumed without failures", got)
+	}
+}
+
+func TestRegistrationPauseResume(t *testing.T) {
+	s := newTestRegistrationStore(t)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	reg := putTestRegistration(t, s, "TestUser", "TestPass", "42", now)
+	s.finish(reg.ID, now, "job", errors.New("sync failed"), now)
+
+	if _, err := s.setPaused("OtherUser", reg.ID, true, now); !errors.Is(err, errNoRegistration) {
+		t.Errorf("setPaused of another account returned err %v, want errNoRegistration", err)
+	}
+	got, err := s.setPaused("testuser", reg.ID, true, now)
+	if err != nil || !got.Paused {
+		t.Fatalf("setPaused(true) = %+v, %v, want it paused", got, err)
+	}
+	if due := s.due(now.Add(24 * time.Hour)); len(due) != 0 {
+		t.Errorf("due of a paused registration = %v, want none", due)
+	}
+
+	resumed := now.Add(24 * time.Hour)
+	got, err = s.setPaused("TestUser", reg.ID, false, resumed)
+	if err != nil || got.Paused || got.Failures != 0 || !got.NextRun.Equal(resumed.Add(time.Hour)) {
+		t.Fatalf("setPaused(false) = %+v, %v, want it resumed without failures and the next run an hour later", got, err)
+	}
+
+	// The state is saved.
+	s2, err := newRegistrationStore(s.path, testCredentialsKey)
+	if err != nil {
+		t.Fatal("newRegistrationStore returned err:", err)
+	}
+	if got, err := s2.get("TestUser", reg.ID); err != nil || got.Paused || !got.NextRun.Equal(resumed.Add(time.Hour)) {
+		t.Errorf("after reloading got %+v, %v, want the resumed registration", got, err)
+	}
+
+	if err := s.delete("TestUser", reg.ID); err != nil {
+		t.Fatal("delete returned err:", err)
+	}
+	if _, err := s.get("TestUser", reg.ID); !errors.Is(err, errNoRegistration) {
+		t.Errorf("get after delete returned err %v, want errNoRegistration", err)
+	}
+}
+
+func TestParseRegistrationSchedule(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"1h", false},
+		{"@every 15m", false},
+		{"@daily", false},
+		{"0 */6 * * *", false},
+		{"10m", true},
+		{"*/5 * * * *", true},
+		{"0,10 * * * *", true}, // Most gaps are long enough, but not all.
+		{"0 0 31 2 *", true},   // Never runs.
+		{"sometimes", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		_, err := parseRegistrationSchedule(tt.spec, 15*time.Minute, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRegistrationSchedule(%q) returned err %v, want err %v", tt.spec, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+// scenarioFiles holds the mock scenarios that are used when no -mock-dir is
+// given.
+//
+//go:embed scenarios
+var scenarioFiles embed.FS
+
+// scenario is a mock sync loaded from a JSON fixture. The name of the
+// scenario is the name of its file without the extension, and it is run by
+// using the name as both the Kitsu.io user ID and the MyAnimeList.net
+// username.
+type scenario struct {
+	Name        string
+	Description string
+	MAL         []mockAnime
+	Kitsu       []mockAnime
+	Failures    []failureRule   `json:",omitempty"`
+	Expect      *ScenarioExpect `json:",omitempty"`
+}
+
+// mockAnime is an anime of a scenario. Status is any name that
+// anisync.ParseStatus accepts and UpdatedAgo is how long before the scenario
+// is run that the anime was last updated, e.g. "24h".
+type mockAnime struct {
+	ID              int
+	Title           string
+	Status          string
+	EpisodesWatched int
+	Episodes        int
+	Rating          string
+	Rewatching      bool
+	UpdatedAgo      string
+	Image           string
+
+	status     anisync.Status
+	updatedAgo time.Duration
+}
+
+// failureRule injects failures and latency into the writes of a mock sync.
+// A rule applies to the writes of the anime in IDs, or all of them if empty,
+// with the operation Op, "add" or "update", or both if empty. A write that
+// the rule applies to is delayed by Latency and fails with Error with the
+// given Probability, which is 1 if omitted. Rules without an Error only add
+// latency.
+type failureRule struct {
+	IDs         []int    `json:",omitempty"`
+	Op          string   `json:",omitempty"`
+	Probability *float64 `json:",omitempty"`
+	Latency     string   `json:",omitempty"`
+	Error       string   `json:",omitempty"`
+
+	latency time.Duration
+}
+
+// ScenarioExpect is the number of writes of each outcome that a scenario is
+// expected to have when everything is synced. Scenarios with probabilistic
+// failures leave it out.
+type ScenarioExpect struct {
+	Adds        int
+	Updates     int
+	AddFails    int
+	UpdateFails int
+}
+
+// loadScenarios reads the scenarios from the .json files in the root of
+// fsys. YAML fixtures are not supported as they would need a YAML library,
+// which anisync does not otherwise depend on, and JSON serves the few
+// hand-written fixtures just as well.
+func loadScenarios(fsys fs.FS) (map[string]*scenario, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	scenarios := make(map[string]*scenario, len(names))
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		s := &scenario{}
+		if err := json.Unmarshal(b, s); err != nil {
+			return nil, fmt.Errorf("scenario %s: %v", name, err)
+		}
+		s.Name = strings.TrimSuffix(name, path.Ext(name))
+		if err := s.prepare(); err != nil {
+			return nil, fmt.Errorf("scenario %s: %v", name, err)
+		}
+		scenarios[s.Name] = s
+	}
+	return scenarios, nil
+}
+
+// prepare validates the scenario and parses its statuses and durations.
+func (s *scenario) prepare() error {
+	for _, list := range [][]mockAnime{s.MAL, s.Kitsu} {
+		for i := range list {
+			a := &list[i]
+			var err error
+			if a.Status != "" {
+				if a.status, err = anisync.ParseStatus(a.Status); err != nil {
+					return fmt.Errorf("anime %d: %v", a.ID, err)
+				}
+			}
+			if a.UpdatedAgo != "" {
+				if a.updatedAgo, err = time.ParseDuration(a.UpdatedAgo); err != nil {
+					return fmt.Errorf("anime %d: %v", a.ID, err)
+				}
+			}
+		}
+	}
+	for i := range s.Failures {
+		f := &s.Failures[i]
+		switch f.Op {
+		case "", "add", "update":
+		default:
+			return fmt.Errorf("failure %d: unknown operation %q", i, f.Op)
+		}
+		if f.Probability != nil && (*f.Probability < 0 || *f.Probability > 1) {
+			return fmt.Errorf("failure %d: probability must be between 0 and 1", i)
+		}
+		if f.Latency != "" {
+			var err error
+			if f.latency, err = time.ParseDuration(f.Latency); err != nil {
+				return fmt.Errorf("failure %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lists returns the MyAnimeList.net and Kitsu.io lists of the scenario, with
+// the update times relative to now.
+func (s *scenario) lists(now time.Time) (malist, kitsuList []anisync.Anime) {
+	return toAnime(s.MAL, now), toAnime(s.Kitsu, now)
+}
+
+func toAnime(list []mockAnime, now time.Time) []anisync.Anime {
+	anime := make([]anisync.Anime, 0, len(list))
+	for _, a := range list {
+		updated := now.Add(-a.updatedAgo)
+		img := a.Image
+		if img == "" {
+			img = imgPlaceholder
+		}
+		anime = append(anime, anisync.Anime{
+			ID:              a.ID,
+			Status:          a.status,
+			Title:           a.Title,
+			EpisodesWatched: a.EpisodesWatched,
+			Episodes:        a.Episodes,
+			LastUpdated:     &updated,
+			Rating:          a.Rating,
+			Rewatching:      a.Rewatching,
+			Image:           img,
+		})
+	}
+	return anime
+}
+
+// write applies the failure rules to a mock write of anime with op. It sleeps
+// for the latency of the rules that apply and returns the error of the first
+// rule that fails.
+func (s *scenario) write(op anisync.JournalOp, anime anisync.Anime) error {
+	var err error
+	for _, f := range s.Failures {
+		if !f.applies(op, anime.ID) {
+			continue
+		}
+		time.Sleep(f.latency)
+		if err == nil && f.Error != "" && (f.Probability == nil || rand.Float64() < *f.Probability) {
+			err = errors.New(f.Error)
+		}
+	}
+	return err
+}
+
+func (f failureRule) applies(op anisync.JournalOp, id int) bool {
+	switch {
+	case f.Op == "add" && op != anisync.JournalAdd:
+		return false
+	case f.Op == "update" && op != anisync.JournalUpdate:
+		return false
+	}
+	if len(f.IDs) == 0 {
+		return true
+	}
+	for _, fid := range f.IDs {
+		if fid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// check compares the result of a mock sync with the expected outcomes.
+func (s *scenario) check(res *anisync.SyncResult) error {
+	if s.Expect == nil {
+		return nil
+	}
+	got := ScenarioExpect{
+		Adds:        len(res.Adds),
+		Updates:     len(res.Updates),
+		AddFails:    len(res.AddFails),
+		UpdateFails: len(res.UpdateFails),
+	}
+	if got != *s.Expect {
+		return fmt.Errorf("scenario %s: got %+v, expected %+v", s.Name, got, *s.Expect)
+	}
+	return nil
+}
+
+// scenario returns the scenario that the Kitsu.io user ID and the
+// MyAnimeList.net username select.
+func (app *App) scenario(kitsuUserID, malUsername string) (*scenario, error) {
+	s, ok := app.scenarios[kitsuUserID]
+	if !ok || kitsuUserID != malUsername {
+		return nil, fmt.Errorf("accounts do not match or unknown scenario %q", kitsuUserID)
+	}
+	return s, nil
+}
+
+// ScenarioInfo describes a mock scenario.
+type ScenarioInfo struct {
+	Name        string
+	Description string
+	MALCount    int
+	KitsuCount  int
+	Expect      *ScenarioExpect `json:",omitempty"`
+}
+
+// handleScenarios lists the mock scenarios, sorted by name.
+func (app *App) handleScenarios(w http.ResponseWriter, r *http.Request) error {
+	list := make([]ScenarioInfo, 0, len(app.scenarios))
+	for _, s := range app.scenarios {
+		list = append(list, ScenarioInfo{
+			Name:        s.Name,
+			Description: s.Description,
+			MALCount:    len(s.MAL),
+			KitsuCount:  len(s.Kitsu),
+			Expect:      s.Expect,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	writeJSON(w, list)
+	return nil
+}
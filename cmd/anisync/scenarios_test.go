@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+)
+
+func TestEmbeddedScenarios(t *testing.T) {
+	fsys, err := fs.Sub(scenarioFiles, "scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenarios, err := loadScenarios(fsys)
+	if err != nil {
+		t.Fatal("loadScenarios returned err:", err)
+	}
+	if len(scenarios) != len(files) || len(scenarios) == 0 {
+		t.Fatalf("loaded %d scenarios from %d fixtures, want all of them", len(scenarios), len(files))
+	}
+
+	defer func(d time.Duration) { mockWriteDelay = d }(mockWriteDelay)
+	mockWriteDelay = 0
+	for name, sc := range scenarios {
+		if sc.Description == "" {
+			t.Errorf("scenario %s has no description", name)
+		}
+		// The outcomes of the scenarios with probabilistic failures vary.
+		if sc.Expect == nil {
+			continue
+		}
+		malist, kitsuList := sc.lists(time.Now())
+		diff := anisync.Compare(malist, kitsuList)
+		res := syncMALAnimeTest(diff, sc.write, func(anisync.SyncEvent) {})
+		if err := sc.check(res); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/history"
+	"github.com/nstratos/anisync/anisync/notify"
+)
+
+const (
+	// schedulerTick is how often the scheduler looks for registrations that
+	// are due.
+	schedulerTick = 30 * time.Second
+	// maxRegistrationFailures is how many consecutive runs of a registration
+	// can fail before it is paused, e.g. because the password was changed.
+	maxRegistrationFailures = 5
+	// upstreamBurst is how many requests the scheduled syncs can make at once
+	// to each upstream API.
+	upstreamBurst = 5
+	// notifyTimeout is how long the notifications of a run can take.
+	notifyTimeout = 30 * time.Second
+	// scheduledSyncTimeout is how long a scheduled sync can take. A sync
+	// that has started is not canceled when the server shuts down, so that
+	// it can be drained, but it cannot run forever.
+	scheduledSyncTimeout = time.Hour
+)
+
+// scheduler syncs the registered accounts on their schedules. The requests of
+// all the scheduled syncs to each upstream API share a rate limit, so that
+// many registrations do not flood them.
+type scheduler struct {
+	app         *App
+	regs        *registrationStore
+	minInterval time.Duration
+	mal, kitsu  *rateLimiter
+}
+
+// newScheduler creates a scheduler whose syncs make at most malRate and
+// kitsuRate requests per minute to each API.
+func newScheduler(app *App, regs *registrationStore, minInterval time.Duration, malRate, kitsuRate float64) *scheduler {
+	return &scheduler{
+		app:         app,
+		regs:        regs,
+		minInterval: minInterval,
+		mal:         newRateLimiter(malRate, upstreamBurst),
+		kitsu:       newRateLimiter(kitsuRate, upstreamBurst),
+	}
+}
+
+// run starts the syncs of the registrations as they become due until ctx is
+// done. The syncs run as jobs so that their events can be streamed and the
+// server waits for them when shutting down.
+func (s *scheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	for {
+		for _, reg := range s.regs.due(time.Now()) {
+			s.start(ctx, reg)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// start runs a sync of a registration as a job. If there is already a sync
+// running for the account, or ctx is done, it is retried on the next tick.
+// Once started, the sync is not canceled by ctx, and if it fails after ctx is
+// done, e.g. because the server is shutting down, it is retried on the next
+// tick too instead of counting as a failure of the registration.
+func (s *scheduler) start(ctx context.Context, reg registration) {
+	started := time.Now()
+	if ctx.Err() != nil || !s.app.limits.syncs.acquire(reg.MALUsername) {
+		s.finish(reg, started, "", nil)
+		return
+	}
+	j := s.app.jobs.start(func(j *job) (_ interface{}, err error) {
+		defer s.app.limits.syncs.release(reg.MALUsername)
+		var result *anisync.SyncResult
+		var diff *anisync.Diff
+		defer func() {
+			s.app.recordRun(history.MakeRun("scheduler", reg.MALUsername, anisync.ProviderKitsu, reg.KitsuUserID, started, result, err))
+			s.notify(notify.MakeEvent("scheduler", reg.MALUsername, anisync.ProviderKitsu, reg.KitsuUserID, started, diff, result, err))
+			if err != nil && ctx.Err() != nil {
+				log.Printf("Scheduled sync job %s failed while shutting down, it will be retried: %v", j.ID, err)
+				s.finish(reg, started, "", nil)
+				return
+			}
+			s.finish(reg, started, j.ID, err)
+		}()
+
+		password, err := s.regs.open(&reg)
+		if err != nil {
+			return nil, err
+		}
+		syncCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), scheduledSyncTimeout)
+		defer cancel()
+		c := s.app.newClientWith(s.throttled(syncCtx, s.mal), s.throttled(syncCtx, s.kitsu), reg.MALUsername, password)
+		result, diff, err = s.sync(c, reg, password, j)
+		if err != nil {
+			return nil, err
+		}
+		return SyncSummary{MalUsername: reg.MALUsername, Sync: result, Diff: diff}, nil
+	})
+	log.Printf("Scheduled sync of %s to %s started as job %s", reg.KitsuUserID, reg.MALUsername, j.ID)
+}
+
+// sync compares fresh lists and syncs them. It fails if the credentials are no
+// longer valid or if every write failed.
+func (s *scheduler) sync(c *anisync.Client, reg registration, password string, j *job) (*anisync.SyncResult, *anisync.Diff, error) {
+	s.app.lists.invalidate(anisync.ProviderMAL, reg.MALUsername)
+	s.app.lists.invalidate(anisync.ProviderKitsu, reg.KitsuUserID)
+	diff, _, err := s.app.getDiff(c, reg.MALUsername, listSource{anisync.ProviderKitsu, reg.KitsuUserID})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(diff.Missing) == 0 && len(diff.NeedUpdate) == 0 {
+		return &anisync.SyncResult{}, diff, nil
+	}
+	if _, resp, err := c.VerifyMALCredentials(reg.MALUsername, password); err != nil {
+		return nil, diff, NewMALError(resp, err, "Could not verify the MyAnimeList credentials of the registration.", http.StatusUnauthorized)
+	}
+	result := c.SyncMALAnimeFunc(*diff, func(e anisync.SyncEvent) {
+		j.emit(eventEntry, e)
+	})
+	s.app.metrics.observeSync(result)
+	s.app.lists.invalidate(anisync.ProviderMAL, reg.MALUsername)
+	if len(result.Adds) == 0 && len(result.Updates) == 0 {
+		return result, diff, fmt.Errorf("all %d writes to MyAnimeList.net failed", len(result.AddFails)+len(result.UpdateFails))
+	}
+	return result, diff, nil
+}
+
+// notify tells the notification targets of the server about a run.
+func (s *scheduler) notify(e notify.Event) {
+	if len(s.app.notify) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := s.app.notify.Notify(ctx, e); err != nil {
+		log.Println("Could not send notifications:", err)
+	}
+}
+
+func (s *scheduler) finish(reg registration, started time.Time, jobID string, err error) {
+	if err := s.regs.finish(reg.ID, started, jobID, err, time.Now().Add(schedulerTick)); err != nil {
+		log.Println("Could not save registrations:", err)
+	}
+}
+
+// throttled returns a copy of the HTTP client of the server that waits for
+// the rate limit l before each request, until ctx is done.
+func (s *scheduler) throttled(ctx context.Context, l *rateLimiter) *http.Client {
+	c := *s.app.httpClient
+	c.Transport = &throttledTransport{next: c.Transport, ctx: ctx, limit: l}
+	return &c
+}
+
+// throttledTransport waits for a rate limit before each request, so that the
+// pages of a list count as much as any other request.
+type throttledTransport struct {
+	next  http.RoundTripper // http.DefaultTransport if nil.
+	ctx   context.Context
+	limit *rateLimiter
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.wait(req.Context()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// wait waits until the rate limit allows a request, or until the context of
+// the transport or ctx is done.
+func (t *throttledTransport) wait(ctx context.Context) error {
+	for {
+		ok, d := t.limit.allow("", time.Now())
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-t.ctx.Done():
+			timer.Stop()
+			return t.ctx.Err()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nstratos/anisync/anisync"
+	"github.com/nstratos/anisync/anisync/anisynctest"
+)
+
+// newTestScheduler creates a scheduler whose syncs use the fakes of
+// MyAnimeList.net and Kitsu.io.
+func newTestScheduler(t *testing.T, malSrv *anisynctest.MALServer, kitsuSrv *anisynctest.KitsuServer) *scheduler {
+	t.Helper()
+	malURL, _ := url.Parse(malSrv.URL)
+	kitsuURL, _ := url.Parse(kitsuSrv.URL)
+	metrics := newAppMetrics()
+	app := &App{
+		httpClient: &http.Client{},
+		jobs:       newJobManager(metrics.jobs),
+		metrics:    metrics,
+		lists:      newListCache(time.Minute),
+		limits:     &limits{syncs: newSyncSlots(1)},
+		malURL:     malURL,
+		kitsuURL:   kitsuURL,
+	}
+	app.scheduler = newScheduler(app, newTestRegistrationStore(t), 15*time.Minute, 0, 0)
+	return app.scheduler
+}
+
+// runDue starts the syncs of the registrations that are due and waits for
+// them to finish.
+func runDue(t *testing.T, s *scheduler, now time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	for _, reg := range s.regs.due(now) {
+		s.start(ctx, reg)
+	}
+	if err := s.app.jobs.wait(ctx); err != nil {
+		t.Fatal("waiting for the syncs returned err:", err)
+	}
+}
+
+func TestSchedulerSync(t *testing.T) {
+	malSrv := anisynctest.NewMALServer()
+	defer malSrv.Close()
+	kitsuSrv := anisynctest.NewKitsuServer()
+	defer kitsuSrv.Close()
+	malSrv.AddUser("TestUser", "TestPass", anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 1})
+	kitsuSrv.AddLibrary("42",
+		anisync.Anime{ID: 1, Title: "Anime1", Status: anisync.Current, EpisodesWatched: 5},
+		anisync.Anime{ID: 2, Title: "Anime2", Status: anisync.Planned},
+	)
+	s := newTestScheduler(t, malSrv, kitsuSrv)
+	now := time.Now()
+	reg := putTestRegistration(t, s.regs, "TestUser", "TestPass", "42", now)
+
+	runDue(t, s, now.Add(time.Hour))
+
+	entries := malSrv.Entries("TestUser")
+	if len(entries) != 2 || entries[0].MyWatchedEpisodes != 5 || entries[1].SeriesAnimeDBID != 2 {
+		t.Errorf("MyAnimeList.net list after the scheduled sync = %+v, want anime 1 updated and anime 2 added", entries)
+	}
+	got, _ := s.regs.get("TestUser", reg.ID)
+	if got.LastJobID == "" || got.LastError != "" || got.Failures != 0 || !got.NextRun.After(now.Add(time.Hour)) {
+		t.Errorf("registration after the scheduled sync = %+v, want a successful run", got)
+	}
+}
+
+func TestSchedulerSyncFailure(t *testing.T) {
+	malSrv := anisynctest.NewMALServer()
+	defer malSrv.Close()
+	kitsuSrv := anisynctest.NewKitsuServer()
+	defer kitsuSrv.Close()
+	malSrv.AddUser("TestUser", "TestPass")
+	kitsuSrv.AddLibrary("42", anisync.Anime{ID: 2, Title: "Anime2", Status: anisync.Planned})
+	s := newTestScheduler(t, malSrv, kitsuSrv)
+	now := time.Now()
+	// The password was changed since the registration.
+	reg := putTestRegistration(t, s.regs, "TestUser", "OldPass", "42", now)
+
+	for i := 1; i <= maxRegistrationFailures; i++ {
+		got, _ := s.regs.get("TestUser", reg.ID)
+		runDue(t, s, got.NextRun)
+		got, _ = s.regs.get("TestUser", reg.ID)
+		if got.Failures != i || got.LastError == "" {
+			t.Fatalf("registration after %d failed syncs = %+v, want %d failures", i, got, i)
+		}
+		if paused := i == maxRegistrationFailures; got.Paused != paused {
+			t.Errorf("registration after %d failed syncs paused = %v, want %v", i, got.Paused, paused)
+		}
+	}
+	if entries := malSrv.Entries("TestUser"); len(entries) != 0 {
+		t.Errorf("MyAnimeList.net list after failed syncs = %+v, want it unchanged", entries)
+	}
+}
+
+func TestSchedulerSyncShutdown(t *testing.T) {
+	malSrv := anisynctest.NewMALServer()
+	defer malSrv.Close()
+	kitsuSrv := anisynctest.NewKitsuServer()
+	defer kitsuSrv.Close()
+	malSrv.AddUser("TestUser", "TestPass")
+	malSrv.AddUser("OtherUser", "OtherPass")
+	kitsuSrv.AddLibrary("42", anisync.Anime{ID: 2, Title: "Anime2", Status: anisync.Planned})
+	s := newTestScheduler(t, malSrv, kitsuSrv)
+	// The requests to MyAnimeList.net wait for the rate limit, which is when
+	// a canceled sync would fail.
+	s.mal = newRateLimiter(600, 1)
+	now := time.Now()
+	reg := putTestRegistration(t, s.regs, "TestUser", "TestPass", "42", now)
+	// The password of this one was changed since the registration.
+	bad := putTestRegistration(t, s.regs, "OtherUser", "OldPass", "42", now)
+
+	// The server starts shutting down right after the syncs started.
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, r := range s.regs.due(now.Add(time.Hour)) {
+		s.start(ctx, r)
+	}
+	cancel()
+	if err := s.app.jobs.wait(context.Background()); err != nil {
+		t.Fatal("waiting for the syncs returned err:", err)
+	}
+
+	// The started sync is drained instead of being canceled.
+	if entries := malSrv.Entries("TestUser"); len(entries) != 1 {
+		t.Errorf("MyAnimeList.net list after a sync during shutdown = %+v, want anime 2 added", entries)
+	}
+	if got, _ := s.regs.get("TestUser", reg.ID); got.Failures != 0 || got.LastError != "" {
+		t.Errorf("registration after a sync during shutdown = %+v, want a successful run", got)
+	}
+	// A sync that fails during shutdown does not count as a failure.
+	if got, _ := s.regs.get("OtherUser", bad.ID); got.Failures != 0 {
+		t.Errorf("registration after a failed sync during shutdown = %+v, want no failures", got)
+	}
+}
+
+func TestThrottledTransport(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer srv.Close()
+
+	// 600 requests per minute with a burst of 1 let a request through every
+	// 100ms.
+	l := newRateLimiter(600, 1)
+	c := &http.Client{Transport: &throttledTransport{ctx: context.Background(), limit: l}}
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatal("Get returned err:", err)
+		}
+		resp.Body.Close()
+	}
+	if d := time.Since(start); d < 250*time.Millisecond {
+		t.Errorf("4 requests took %v, want them to wait for the rate limit", d)
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("server got %d requests, want 4", n)
+	}
+
+	// Once the context is done, the requests that would wait fail.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c = &http.Client{Transport: &throttledTransport{ctx: ctx, limit: l}}
+	if _, err := c.Get(srv.URL); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get after the context is done returned err %v, want context.Canceled", err)
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("server got %d requests, want no more than 4", n)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sessionCookie = "anisync_session"
+
+var errNoSession = errors.New("no session or session has expired")
+
+// session keeps the MyAnimeList.net credentials of a user on the server after
+// they have been verified once, so that the client does not have to send the
+// password with every call.
+type session struct {
+	ID          string
+	MALUsername string
+	MALPassword string
+	Expires     time.Time
+}
+
+// sessionStore keeps the sessions in memory. The session IDs are sent to the
+// clients encrypted in a cookie.
+type sessionStore struct {
+	ttl  time.Duration
+	aead cipher.AEAD
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// newSessionStore creates a session store whose sessions expire after ttl. The
+// key is used to encrypt the session cookies and must be 32 bytes. If key is
+// nil, a random key is used.
+func newSessionStore(key []byte, ttl time.Duration) (*sessionStore, error) {
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("session key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionStore{ttl: ttl, aead: aead, sessions: make(map[string]*session)}, nil
+}
+
+// create starts a new session, replacing the session of the request if any,
+// and sets the session cookie.
+func (s *sessionStore) create(w http.ResponseWriter, r *http.Request, malUsername, malPassword string) (*session, error) {
+	if old, err := s.get(r); err == nil {
+		s.delete(old.ID)
+	}
+	sess := &session{
+		ID:          newJobID(),
+		MALUsername: malUsername,
+		MALPassword: malPassword,
+		Expires:     time.Now().Add(s.ttl),
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	value := s.aead.Seal(nonce, nonce, []byte(sess.ID), []byte(sessionCookie))
+
+	s.mu.Lock()
+	s.sessions[sess.ID] = sess
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/api/",
+		Expires:  sess.Expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return sess, nil
+}
+
+// get returns the session of the request if it exists and has not expired.
+func (s *sessionStore) get(r *http.Request) (*session, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, errNoSession
+	}
+	value, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil || len(value) < s.aead.NonceSize() {
+		return nil, errNoSession
+	}
+	nonce, ciphertext := value[:s.aead.NonceSize()], value[s.aead.NonceSize():]
+	id, err := s.aead.Open(nil, nonce, ciphertext, []byte(sessionCookie))
+	if err != nil {
+		return nil, errNoSession
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[string(id)]
+	if !ok {
+		return nil, errNoSession
+	}
+	if time.Now().After(sess.Expires) {
+		delete(s.sessions, sess.ID)
+		return nil, errNoSession
+	}
+	return sess, nil
+}
+
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// expire removes the expired sessions every interval. It never returns.
+func (s *sessionStore) expire(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+		s.mu.Lock()
+		for id, sess := range s.sessions {
+			if now.After(sess.Expires) {
+				delete(s.sessions, id)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/api/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+/*
+handleLogin verifies the MyAnimeList.net credentials once and starts a server
+side session for them. It expects a request body that looks like this:
+
+	{
+		"malPassword": "some-password",
+		"malUsername": "some-username"
+	}
+
+The session is kept in a cookie and is used by the calls that need the
+credentials, such as sync, until it expires or handleLogout is called.
+*/
+func (app *App) handleLogin(w http.ResponseWriter, r *http.Request) error {
+	// Receiving json from POST body.
+	var t LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		return NewAppError(err, "Login: Could not decode request.", http.StatusBadRequest)
+	}
+
+	c := app.newClient(r, t.MALUsername, t.MALPassword)
+
+	if _, resp, err := c.VerifyMALCredentials(t.MALUsername, t.MALPassword); err != nil {
+		return NewMALError(resp, err, "Login: Could not verify MyAnimeList credentials.", http.StatusUnauthorized)
+	}
+
+	sess, err := app.sessions.create(w, r, t.MALUsername, t.MALPassword)
+	if err != nil {
+		return NewAppError(err, "Login: Could not create session.", http.StatusInternalServerError)
+	}
+	return writeSession(w, sess)
+}
+
+// handleSession returns the MyAnimeList.net username and the expiration time
+// of the current session.
+func (app *App) handleSession(w http.ResponseWriter, r *http.Request) error {
+	sess, err := app.sessions.get(r)
+	if err != nil {
+		return NewAppError(err, "Session: Not logged in.", http.StatusUnauthorized)
+	}
+	return writeSession(w, sess)
+}
+
+// handleLogout ends the current session if any.
+func (app *App) handleLogout(w http.ResponseWriter, r *http.Request) error {
+	if sess, err := app.sessions.get(r); err == nil {
+		app.sessions.delete(sess.ID)
+	}
+	clearSessionCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func writeSession(w http.ResponseWriter, sess *session) error {
+	resp := SessionResponse{
+		MalUsername: sess.MALUsername,
+		Expires:     sess.Expires,
+	}
+	bytes, err := json.Marshal(resp)
+	if err != nil {
+		return NewAppError(err, "Session: Could not encode response.", http.StatusInternalServerError)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+	return nil
+}
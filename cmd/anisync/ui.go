@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// uiFiles holds the web UI so that the server does not depend on the
+// directory that it runs from.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// staticPrefix is the URL prefix under which the UI assets are served.
+const staticPrefix = "/static/"
+
+// hashLen is the number of hex digits of the content hash in asset URLs.
+const hashLen = 10
+
+// uiAsset is a file of the UI, ready to be served.
+type uiAsset struct {
+	name    string
+	hashed  string // Path with the content hash, e.g. assets/js/anisync.0123456789.js
+	hash    string
+	ctype   string
+	content []byte
+	gzip    []byte // Nil if compressing does not make the file smaller.
+	br      []byte // Nil if compressing does not make the file smaller than gzip.
+}
+
+// uiHandler serves the embedded UI. The assets are served both by their path
+// and by a path that includes a hash of their content. The HTML and CSS files
+// refer to the assets by their hashed paths, which never change, so they can
+// be cached for long.
+type uiHandler struct {
+	assets map[string]*uiAsset // By path and by hashed path.
+	hashed map[string]bool     // Whether a path is a hashed path.
+}
+
+// newUIHandler prepares the files of fsys to be served. Text files have their
+// references to other files, in the form /static/path, rewritten to the hashed
+// paths and are compressed with gzip and brotli.
+func newUIHandler(fsys fs.FS) (*uiHandler, error) {
+	raw := make(map[string][]byte)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		raw[p] = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Hashes change when the references of a file are rewritten, which in turn
+	// changes the files that refer to that file, so rewriting is repeated
+	// until the hashes settle.
+	hashes := make(map[string]string)
+	content := make(map[string][]byte)
+	for p, b := range raw {
+		content[p] = b
+		hashes[p] = contentHash(b)
+	}
+	for i := 0; i < 10; i++ {
+		changed := false
+		for p, b := range raw {
+			if !isText(p) {
+				continue
+			}
+			c := rewriteRefs(b, hashes)
+			content[p] = c
+			if h := contentHash(c); h != hashes[p] {
+				hashes[p] = h
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	h := &uiHandler{assets: make(map[string]*uiAsset), hashed: make(map[string]bool)}
+	for p, c := range content {
+		a := &uiAsset{
+			name:    p,
+			hashed:  hashedPath(p, hashes[p]),
+			hash:    hashes[p],
+			ctype:   mime.TypeByExtension(path.Ext(p)),
+			content: c,
+		}
+		if isText(p) {
+			if gz := gzipBytes(c); len(gz) < len(c) {
+				a.gzip = gz
+			}
+			if br := brotliBytes(c); a.gzip != nil && len(br) < len(a.gzip) {
+				a.br = br
+			}
+		}
+		h.assets[p] = a
+		h.assets[a.hashed] = a
+		h.hashed[a.hashed] = true
+	}
+	return h, nil
+}
+
+func contentHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:hashLen]
+}
+
+// hashedPath adds hash before the extension of p.
+func hashedPath(p, hash string) string {
+	ext := path.Ext(p)
+	return strings.TrimSuffix(p, ext) + "." + hash + ext
+}
+
+func isText(p string) bool {
+	switch path.Ext(p) {
+	case ".html", ".css", ".js", ".svg", ".json":
+		return true
+	}
+	return false
+}
+
+// rewriteRefs replaces the references to the files in b with their hashed
+// paths.
+func rewriteRefs(b []byte, hashes map[string]string) []byte {
+	paths := make([]string, 0, len(hashes))
+	for p := range hashes {
+		paths = append(paths, p)
+	}
+	// strings.Replacer tries the old strings in argument order so a path that
+	// is the prefix of another one must come after it.
+	sort.Slice(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) > len(paths[j])
+		}
+		return paths[i] < paths[j]
+	})
+	var pairs []string
+	for _, p := range paths {
+		pairs = append(pairs, staticPrefix+p, staticPrefix+hashedPath(p, hashes[p]))
+	}
+	return []byte(strings.NewReplacer(pairs...).Replace(string(b)))
+}
+
+func gzipBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func brotliBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	bw.Write(b)
+	bw.Close()
+	return buf.Bytes()
+}
+
+// ServeHTTP serves the asset of the request path, with the prefix already
+// stripped. The index is served for the root.
+func (h *uiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index.html"
+	}
+	a, ok := h.assets[p]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if h.hashed[p] {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if a.ctype != "" {
+		w.Header().Set("Content-Type", a.ctype)
+	}
+
+	// Each encoding is a different representation, so it gets its own ETag
+	// which caches must not mix up with the others.
+	body, etag := a.content, a.hash
+	if a.gzip != nil || a.br != nil {
+		w.Header().Add("Vary", "Accept-Encoding")
+		switch accept := r.Header.Get("Accept-Encoding"); {
+		case a.br != nil && acceptsEncoding(accept, "br"):
+			w.Header().Set("Content-Encoding", "br")
+			body, etag = a.br, a.hash+"-br"
+		case a.gzip != nil && acceptsEncoding(accept, "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			body, etag = a.gzip, a.hash+"-gz"
+		}
+	}
+	w.Header().Set("ETag", `"`+etag+`"`)
+	http.ServeContent(w, r, a.name, time.Time{}, bytes.NewReader(body))
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header accepts coding.
+func acceptsEncoding(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(name) != coding {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// noCache disables caching of the responses of next, used when the UI is
+// served from a directory during development.
+func noCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		next.ServeHTTP(w, r)
+	})
+}
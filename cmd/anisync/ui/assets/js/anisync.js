@@ -28,13 +28,22 @@ var anisyncServices = angular.module('anisyncServices', ['ngResource']);
 
 anisyncServices.factory('Anisync', ['$resource',
   function($resource) {
-    var checkURL = 'api/check';
-    var syncURL = 'api/sync';
+    var checkURL = 'api/v1/check';
+    var syncURL = 'api/v1/sync';
+    var loginURL = 'api/v1/login';
     if (window.location.search == "?testbed") {
-      checkURL = 'api/mock/check';
-      syncURL = 'api/mock/sync';
+      checkURL = 'api/v1/mock/check';
+      syncURL = 'api/v1/mock/sync';
+      loginURL = 'api/v1/mock/login';
     }
     return {
+      Scenarios: $resource('api/v1/mock/scenarios'),
+      Login: $resource(loginURL, {}, {
+        query: {
+          method: 'POST',
+          params: {}
+        },
+      }),
       Check: $resource(checkURL, {}, {
         query: {
           method: 'GET',
@@ -59,11 +68,18 @@ anisyncControllers.controller('AnisyncCtrl', ['$scope', 'Anisync', 'ngProgressFa
 
   function($scope, Anisync, ngProgressFactory, $window, $timeout) {
     // malVerify options for the password input
-    $scope.malVerifyURL = '/api/mal-verify';
+    $scope.malVerifyURL = '/api/v1/login';
     $scope.malVerifyDelay = 900;
     if (window.location.search == "?testbed") {
-      $scope.malVerifyURL = '/api/mock/mal-verify';
+      $scope.malVerifyURL = '/api/v1/mock/login';
       $scope.malVerifyDelay = 400;
+      // The mock scenarios are run by entering their name as both accounts.
+      $scope.scenarios = Anisync.Scenarios.query();
+      $scope.pickScenario = function(name) {
+        $scope.req = $scope.req || {};
+        $scope.req.kitsuUserID = name;
+        $scope.req.malUsername = name;
+      };
     }
     // clickNext
     $scope.clickNext = function() {
@@ -113,6 +129,7 @@ anisyncControllers.controller('AnisyncCtrl', ['$scope', 'Anisync', 'ngProgressFa
       $scope.loading = true;
       Anisync.Check.query(req).$promise.then(function(data) {
         $scope.checkResp = data;
+        $scope.selection = makeSelection(data);
         $scope.statusBar = makeStatusBar(data);
       }, function(error) {
         $scope.statusBar = makeStatusBarError(error);
@@ -121,25 +138,146 @@ anisyncControllers.controller('AnisyncCtrl', ['$scope', 'Anisync', 'ngProgressFa
         $scope.loading = false;
       });
     }
+    // nothingSelected reports whether every anime of the last check was
+    // unticked, in which case there is nothing to sync.
+    $scope.nothingSelected = function() {
+      var sel = selectedAnime($scope.checkResp, $scope.selection);
+      return sel !== undefined && sel.length == 0;
+    };
     $scope.sync = function(req) {
+      // The selection refers to the last check so it is kept before the
+      // results are cleared.
+      var checkResp = $scope.checkResp;
       $scope.statusBar = {};
       $scope.checkResp = {};
       $scope.progressbar.start();
       $scope.loading = true;
-      Anisync.Sync.query(req).$promise.then(function(data) {
-        $scope.checkResp = data;
-        //$scope.syncResp = data;
-        $scope.statusBar = makeStatusBarSync(data);
-      }, function(error) {
-        $scope.statusBar = makeStatusBarError(error);
-      }).finally(function() {
+      var finish = function() {
         $scope.progressbar.complete();
         $scope.loading = false;
+      };
+      // The password is sent only once to log in. Sync then uses the
+      // server-side session and starts a job whose progress and result are
+      // streamed as server-sent events.
+      Anisync.Login.query({
+        malUsername: req.malUsername,
+        malPassword: req.malPassword
+      }).$promise.then(function() {
+        return Anisync.Sync.query({
+          kitsuUserID: req.kitsuUserID,
+          malUsername: req.malUsername,
+          select: selectedAnime(checkResp, $scope.selection)
+        }).$promise;
+      }).then(function(job) {
+        var events = new EventSource(job.EventsURL);
+        events.addEventListener('entry', function(e) {
+          var entry = JSON.parse(e.data);
+          $scope.$apply(function() {
+            $scope.progressbar.set(100 * entry.Done / entry.Total);
+            $scope.statusBar = makeStatusBarProgress(entry);
+          });
+        });
+        events.addEventListener('summary', function(e) {
+          events.close();
+          var data = JSON.parse(e.data);
+          $scope.$apply(function() {
+            $scope.checkResp = data;
+            $scope.statusBar = makeStatusBarSync(data);
+            finish();
+          });
+        });
+        events.addEventListener('failure', function(e) {
+          events.close();
+          var data = JSON.parse(e.data);
+          $scope.$apply(function() {
+            $scope.statusBar = makeStatusBarError({
+              data: data
+            });
+            finish();
+          });
+        });
+      }, function(error) {
+        $scope.statusBar = makeStatusBarError(error);
+        finish();
       });
     }
   }
 ]);
 
+// makeSelection selects all the anime of a check and all their fields. The
+// selection is keyed by anime ID.
+function makeSelection(data) {
+  var selection = {};
+  angular.forEach(data.Missing, function(a) {
+    selection[a.ID] = {
+      on: true
+    };
+  });
+  angular.forEach(data.NeedUpdate, function(d) {
+    selection[d.Anime.ID] = {
+      on: true,
+      fields: {
+        Status: true,
+        EpisodesWatched: true,
+        Rating: true,
+        Rewatching: true
+      }
+    };
+  });
+  return selection;
+}
+
+// selectedAnime returns the selection in the form that sync expects or
+// undefined if everything is selected, to sync the whole difference.
+function selectedAnime(data, selection) {
+  if (!data || !selection) return undefined;
+  var sel = [];
+  var all = true;
+  angular.forEach(data.Missing, function(a) {
+    if (selection[a.ID] && selection[a.ID].on) {
+      sel.push({
+        ID: a.ID
+      });
+    } else {
+      all = false;
+    }
+  });
+  angular.forEach(data.NeedUpdate, function(d) {
+    var s = selection[d.Anime.ID];
+    if (!s || !s.on) {
+      all = false;
+      return;
+    }
+    var fields = [];
+    var allFields = true;
+    angular.forEach(['Status', 'EpisodesWatched', 'Rating', 'Rewatching'], function(f) {
+      if (!d[f]) return;
+      if (s.fields[f]) {
+        fields.push(f);
+      } else {
+        allFields = false;
+      }
+    });
+    if (fields.length == 0) {
+      all = false;
+      return;
+    }
+    if (allFields) {
+      sel.push({
+        ID: d.Anime.ID
+      });
+      return;
+    }
+    all = false;
+    sel.push({
+      ID: d.Anime.ID,
+      Fields: fields
+    });
+  });
+  if (all) return undefined;
+  return sel;
+}
+
 function makeStatusBarError(error) {
   var statusBar = {
     type: "simple",
@@ -151,12 +289,26 @@ function makeStatusBarError(error) {
     theme: "danger",
     buttonTheme: "danger"
   };
-  if (!error) {
+  if (!error || !error.data || !error.data.Error) {
     statusBar.message = "Aw, Snap! Something went horribly wrong.";
     return statusBar;
   }
-  statusBar.message = error.data.Message;
-  statusBar.cause = error.data.Cause;
+  // Errors of the API are wrapped in an envelope.
+  statusBar.message = error.data.Error.Message;
+  statusBar.cause = error.data.Error.Cause;
+  return statusBar;
+}
+
+function makeStatusBarProgress(entry) {
+  var action = entry.Op == "add" ? "Adding" : "Updating";
+  var statusBar = {
+    type: "simple",
+    message: action + " " + entry.Done + " of " + entry.Total + ": " + entry.Anime.Title,
+    cause: entry.Reason,
+    visible: true,
+    next: false,
+    theme: entry.Reason ? "danger" : "info"
+  };
   return statusBar;
 }
 
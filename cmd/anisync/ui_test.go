@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func newTestUIHandler(t *testing.T) *uiHandler {
+	t.Helper()
+	fsys, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := newUIHandler(fsys)
+	if err != nil {
+		t.Fatal("newUIHandler returned err:", err)
+	}
+	return h
+}
+
+func TestUIHandlerEncodings(t *testing.T) {
+	h := newTestUIHandler(t)
+	a := h.assets["assets/js/anisync.js"]
+	if a == nil || a.gzip == nil || a.br == nil {
+		t.Fatalf("anisync.js asset = %+v, want it compressed with gzip and brotli", a)
+	}
+
+	tests := []struct {
+		accept       string
+		wantEncoding string
+		decode       func(io.Reader) (io.Reader, error)
+	}{
+		{"", "", nil},
+		{"gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"gzip, deflate, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"br;q=0, gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+	}
+	etags := make(map[string]string)
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/"+a.hashed, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept-Encoding", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Accept-Encoding %q: status %d, want 200", tt.accept, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q, want %q", tt.accept, got, tt.wantEncoding)
+		}
+		var body io.Reader = rec.Body
+		if tt.decode != nil {
+			var err error
+			if body, err = tt.decode(body); err != nil {
+				t.Fatalf("Accept-Encoding %q: decoding body: %v", tt.accept, err)
+			}
+		}
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("Accept-Encoding %q: reading body: %v", tt.accept, err)
+		}
+		if !bytes.Equal(b, a.content) {
+			t.Errorf("Accept-Encoding %q: body differs from the asset", tt.accept)
+		}
+		etags[tt.wantEncoding] = rec.Header().Get("ETag")
+	}
+	if etags[""] == etags["gzip"] || etags[""] == etags["br"] || etags["gzip"] == etags["br"] {
+		t.Errorf("ETags of the encodings = %v, want a different one for each", etags)
+	}
+
+	// A cached encoding is only revalidated by its own ETag.
+	for enc, accept := range map[string]string{"gzip": "gzip", "br": "br"} {
+		req := httptest.NewRequest("GET", "/"+a.hashed, nil)
+		req.Header.Set("Accept-Encoding", accept)
+		req.Header.Set("If-None-Match", etags[enc])
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("%s with its ETag: status %d, want 304", enc, rec.Code)
+		}
+		req.Header.Set("If-None-Match", etags[""])
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s with the identity ETag: status %d, want 200", enc, rec.Code)
+		}
+	}
+}
+
+func TestUIHandlerHashedPaths(t *testing.T) {
+	h := newTestUIHandler(t)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("index: status %d, Cache-Control %q, want 200 and no-cache", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	css := h.assets["assets/css/main.css"]
+	if !strings.Contains(rec.Body.String(), staticPrefix+css.hashed) {
+		t.Errorf("index does not refer to the hashed path %s", css.hashed)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/"+css.hashed, nil))
+	if got := rec.Header().Get("Cache-Control"); !strings.Contains(got, "immutable") {
+		t.Errorf("hashed path Cache-Control = %q, want it immutable", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/missing.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing file: status %d, want 404", rec.Code)
+	}
+}
@@ -3,14 +3,15 @@ module github.com/nstratos/anisync
 go 1.24.0
 
 require (
+	github.com/andybalholm/brotli v1.1.0
 	github.com/nstratos/go-hummingbird v0.0.0-20160526073746-539715ff8e51
 	github.com/nstratos/go-kitsu v0.0.0-20180327171941-0c844854d3e1
 	github.com/nstratos/go-myanimelist v0.0.0-20200604201559-0ba19f529526
+	github.com/nstratos/jsonapi v0.0.0-20180216150350-8c8652d58474
 	golang.org/x/crypto v0.45.0
 )
 
 require (
-	github.com/nstratos/jsonapi v0.0.0-20180216150350-8c8652d58474 // indirect
 	golang.org/x/oauth2 v0.27.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/term v0.37.0 // indirect
@@ -0,0 +1,29 @@
+// Package baseurl parses the base URLs of the APIs that the commands can be
+// pointed at, e.g. fake servers for testing.
+package baseurl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Parse parses the base URL of an API, adding the trailing slash that the
+// paths of the API clients are resolved against. It returns nil for an empty
+// URL.
+func Parse(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasSuffix(s, "/") {
+		s += "/"
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute URL", s)
+	}
+	return u, nil
+}
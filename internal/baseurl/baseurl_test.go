@@ -0,0 +1,36 @@
+package baseurl_test
+
+import (
+	"testing"
+
+	"github.com/nstratos/anisync/internal/baseurl"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"http://127.0.0.1:8080", "http://127.0.0.1:8080/", false},
+		{"https://example.com/api/", "https://example.com/api/", false},
+		{"example.com/api", "", true},
+		{"/api", "", true},
+		{"http://[::1", "", true},
+	}
+	for _, tt := range tests {
+		u, err := baseurl.Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) returned err %v, want err %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}